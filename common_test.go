@@ -174,6 +174,8 @@ func likeString(rand *rand.Rand, ex string) string {
 	case "URL":
 		u := randURL(rand)
 		s = u.String()
+	case "hostname":
+		s = randString(rand, loalpha+digit+"-") + "." + randString(rand, loalpha)
 	case "_obfID":
 		s = "_" + randString(rand, alnum+"._-")
 	default:
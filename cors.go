@@ -0,0 +1,384 @@
+package httpheader
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Origin parses the Origin header from h (RFC 6454 Section 7; Fetch Standard
+// Section 3.1). The result is a serialized origin like "https://example.com",
+// or "null" for an opaque origin, or an empty string if there is no Origin.
+func Origin(h http.Header) string {
+	return strings.TrimSpace(h.Get("Origin"))
+}
+
+// SetOrigin replaces the Origin header in h (RFC 6454 Section 7).
+func SetOrigin(h http.Header, origin string) {
+	if origin == "" {
+		h.Del("Origin")
+		return
+	}
+	h.Set("Origin", origin)
+}
+
+// AccessControlRequestMethod parses the Access-Control-Request-Method header
+// from h (Fetch Standard Section 3.2.2). Methods are case-sensitive.
+func AccessControlRequestMethod(h http.Header) string {
+	return strings.TrimSpace(h.Get("Access-Control-Request-Method"))
+}
+
+// SetAccessControlRequestMethod replaces the Access-Control-Request-Method
+// header in h (Fetch Standard Section 3.2.2).
+func SetAccessControlRequestMethod(h http.Header, method string) {
+	if method == "" {
+		h.Del("Access-Control-Request-Method")
+		return
+	}
+	h.Set("Access-Control-Request-Method", method)
+}
+
+// AccessControlRequestHeaders parses the Access-Control-Request-Headers header
+// from h (Fetch Standard Section 3.2.2). Names are canonicalized with
+// http.CanonicalHeaderKey.
+func AccessControlRequestHeaders(h http.Header) []string {
+	return parseNameList(h["Access-Control-Request-Headers"])
+}
+
+// SetAccessControlRequestHeaders replaces the Access-Control-Request-Headers
+// header in h (Fetch Standard Section 3.2.2). Browsers send names
+// in lowercase and sorted.
+func SetAccessControlRequestHeaders(h http.Header, names []string) {
+	setNameList(h, "Access-Control-Request-Headers", names)
+}
+
+// AccessControlRequestPrivateNetwork parses
+// the Access-Control-Request-Private-Network header from h (WICG Private
+// Network Access, Section 3.1), which a browser sends in a preflight request
+// to a more private network.
+func AccessControlRequestPrivateNetwork(h http.Header) bool {
+	return h.Get("Access-Control-Request-Private-Network") == "true"
+}
+
+// SetAccessControlRequestPrivateNetwork replaces
+// the Access-Control-Request-Private-Network header in h.
+func SetAccessControlRequestPrivateNetwork(h http.Header, request bool) {
+	setTrue(h, "Access-Control-Request-Private-Network", request)
+}
+
+// AccessControlAllowOrigin parses the Access-Control-Allow-Origin header
+// from h (Fetch Standard Section 3.2.3). The result is "*", "null",
+// a serialized origin, or an empty string if there is no such header.
+func AccessControlAllowOrigin(h http.Header) string {
+	return strings.TrimSpace(h.Get("Access-Control-Allow-Origin"))
+}
+
+// SetAccessControlAllowOrigin replaces the Access-Control-Allow-Origin header
+// in h (Fetch Standard Section 3.2.3). If origin depends on the request,
+// remember to also AddVary(h, "Origin").
+func SetAccessControlAllowOrigin(h http.Header, origin string) {
+	if origin == "" {
+		h.Del("Access-Control-Allow-Origin")
+		return
+	}
+	h.Set("Access-Control-Allow-Origin", origin)
+}
+
+// AccessControlAllowCredentials parses the Access-Control-Allow-Credentials
+// header from h (Fetch Standard Section 3.2.3). Only the exact value ``true''
+// counts, as in browsers.
+func AccessControlAllowCredentials(h http.Header) bool {
+	return h.Get("Access-Control-Allow-Credentials") == "true"
+}
+
+// SetAccessControlAllowCredentials replaces the Access-Control-Allow-Credentials
+// header in h (Fetch Standard Section 3.2.3). If allow is false,
+// the header is deleted, because ``false'' is not a valid value.
+func SetAccessControlAllowCredentials(h http.Header, allow bool) {
+	setTrue(h, "Access-Control-Allow-Credentials", allow)
+}
+
+// AccessControlAllowMethods parses the Access-Control-Allow-Methods header
+// from h (Fetch Standard Section 3.2.3). Methods are case-sensitive.
+// A "*" means any method, but only for requests without credentials.
+func AccessControlAllowMethods(h http.Header) []string {
+	return parseTokenList(h["Access-Control-Allow-Methods"])
+}
+
+// SetAccessControlAllowMethods replaces the Access-Control-Allow-Methods header
+// in h (Fetch Standard Section 3.2.3).
+func SetAccessControlAllowMethods(h http.Header, methods []string) {
+	setNameList(h, "Access-Control-Allow-Methods", methods)
+}
+
+// AccessControlAllowHeaders parses the Access-Control-Allow-Headers header
+// from h (Fetch Standard Section 3.2.3). Names are canonicalized with
+// http.CanonicalHeaderKey. A "*" means any header except Authorization,
+// but only for requests without credentials.
+func AccessControlAllowHeaders(h http.Header) []string {
+	return parseNameList(h["Access-Control-Allow-Headers"])
+}
+
+// SetAccessControlAllowHeaders replaces the Access-Control-Allow-Headers header
+// in h (Fetch Standard Section 3.2.3).
+func SetAccessControlAllowHeaders(h http.Header, names []string) {
+	setNameList(h, "Access-Control-Allow-Headers", names)
+}
+
+// AccessControlExposeHeaders parses the Access-Control-Expose-Headers header
+// from h (Fetch Standard Section 3.2.3). Names are canonicalized with
+// http.CanonicalHeaderKey. A "*" means any header, but only for requests
+// without credentials.
+func AccessControlExposeHeaders(h http.Header) []string {
+	return parseNameList(h["Access-Control-Expose-Headers"])
+}
+
+// SetAccessControlExposeHeaders replaces the Access-Control-Expose-Headers
+// header in h (Fetch Standard Section 3.2.3).
+func SetAccessControlExposeHeaders(h http.Header, names []string) {
+	setNameList(h, "Access-Control-Expose-Headers", names)
+}
+
+// AccessControlMaxAge parses the Access-Control-Max-Age header from h
+// (Fetch Standard Section 3.2.3).
+func AccessControlMaxAge(h http.Header) Delta {
+	if seconds, ok := parseLength(strings.TrimSpace(h.Get("Access-Control-Max-Age"))); ok {
+		return DeltaSeconds(seconds)
+	}
+	return Delta{}
+}
+
+// SetAccessControlMaxAge replaces the Access-Control-Max-Age header in h
+// (Fetch Standard Section 3.2.3). Browsers cap it at a few hours at most.
+func SetAccessControlMaxAge(h http.Header, maxAge Delta) {
+	if !maxAge.ok {
+		h.Del("Access-Control-Max-Age")
+		return
+	}
+	h.Set("Access-Control-Max-Age", strconv.Itoa(maxAge.seconds))
+}
+
+// AccessControlAllowPrivateNetwork parses
+// the Access-Control-Allow-Private-Network header from h (WICG Private
+// Network Access, Section 3.2).
+func AccessControlAllowPrivateNetwork(h http.Header) bool {
+	return h.Get("Access-Control-Allow-Private-Network") == "true"
+}
+
+// SetAccessControlAllowPrivateNetwork replaces
+// the Access-Control-Allow-Private-Network header in h.
+func SetAccessControlAllowPrivateNetwork(h http.Header, allow bool) {
+	setTrue(h, "Access-Control-Allow-Private-Network", allow)
+}
+
+func parseTokenList(values []string) []string {
+	if values == nil {
+		return nil
+	}
+	tokens := make([]string, 0, estimateElems(values))
+	for v, vs := iterElems("", values); v != ""; v, vs = iterElems(v, vs) {
+		var token string
+		token, v = consumeItem(v)
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
+func parseNameList(values []string) []string {
+	names := parseTokenList(values)
+	for i := range names {
+		names[i] = http.CanonicalHeaderKey(names[i])
+	}
+	return names
+}
+
+func setNameList(h http.Header, name string, tokens []string) {
+	if len(tokens) == 0 {
+		h.Del(name)
+		return
+	}
+	h.Set(name, strings.Join(tokens, ", "))
+}
+
+func setTrue(h http.Header, name string, value bool) {
+	if !value {
+		h.Del(name)
+		return
+	}
+	h.Set(name, "true")
+}
+
+// A CORSPolicy describes which cross-origin requests a server allows
+// (Fetch Standard Section 3.2). Its Apply method computes the response
+// headers for a given request.
+type CORSPolicy struct {
+	// AllowedOrigins lists serialized origins like "https://example.com".
+	// An origin may have a wildcard host prefix like "https://*.example.com",
+	// which matches subdomains (but not example.com itself). "*" matches
+	// any origin; if AllowCredentials is also true, "*" cannot be sent to
+	// the browser, so the request's origin is reflected instead, which means
+	// that any site can make credentialed requests: use with care.
+	AllowedOrigins []string
+
+	// AllowedMethods lists methods allowed in addition to the CORS-safelisted
+	// GET, HEAD and POST. "*" means any method.
+	AllowedMethods []string
+
+	// AllowedHeaders lists request headers allowed in addition to
+	// the CORS-safelisted ones. "*" means any header except Authorization,
+	// which must be listed explicitly (as in the Fetch Standard).
+	AllowedHeaders []string
+
+	// ExposedHeaders lists response headers that scripts may read in addition
+	// to the CORS-safelisted ones. Browsers treat "*" as a literal name
+	// in responses to credentialed requests, so Apply omits it when
+	// AllowCredentials is true.
+	ExposedHeaders []string
+
+	AllowCredentials    bool
+	MaxAge              Delta
+	AllowPrivateNetwork bool
+}
+
+// Apply adds to resp the CORS headers for the request r according to policy.
+// It returns true if r is a CORS preflight request, in which case the caller
+// should respond immediately, usually with 204 (No Content).
+//
+// If r's origin is not allowed, or a preflight requests a method or headers
+// that are not allowed, no CORS headers are added, so the browser will fail
+// the request. Vary is updated whenever the response depends on the request
+// (see AddVary).
+//
+// Preflight responses list the requested method and headers rather than
+// everything that is allowed, which works with and without credentials.
+func (policy CORSPolicy) Apply(r *http.Request, resp http.Header) (preflight bool) {
+	preflight = r.Method == http.MethodOptions &&
+		AccessControlRequestMethod(r.Header) != ""
+	if !policy.anyOrigin() {
+		AddVary(resp, "Origin")
+	}
+	if preflight {
+		AddVary(resp, "Access-Control-Request-Method",
+			"Access-Control-Request-Headers")
+	}
+	origin := Origin(r.Header)
+	if origin == "" || !policy.allowsOrigin(origin) {
+		return preflight
+	}
+
+	var method string
+	var names []string
+	if preflight {
+		method = AccessControlRequestMethod(r.Header)
+		if !policy.allowsMethod(method) {
+			return preflight
+		}
+		for _, name := range AccessControlRequestHeaders(r.Header) {
+			if !policy.allowsHeader(name) {
+				return preflight
+			}
+			names = append(names, strings.ToLower(name))
+		}
+	}
+
+	if policy.anyOrigin() {
+		SetAccessControlAllowOrigin(resp, "*")
+	} else {
+		SetAccessControlAllowOrigin(resp, origin)
+	}
+	SetAccessControlAllowCredentials(resp, policy.AllowCredentials)
+	if !preflight {
+		exposed := make([]string, 0, len(policy.ExposedHeaders))
+		for _, name := range policy.ExposedHeaders {
+			if name != "*" || !policy.AllowCredentials {
+				exposed = append(exposed, name)
+			}
+		}
+		SetAccessControlExposeHeaders(resp, exposed)
+		return false
+	}
+	if !isSafelistedMethod(method) {
+		SetAccessControlAllowMethods(resp, []string{method})
+	}
+	SetAccessControlAllowHeaders(resp, names)
+	SetAccessControlMaxAge(resp, policy.MaxAge)
+	if policy.AllowPrivateNetwork && AccessControlRequestPrivateNetwork(r.Header) {
+		SetAccessControlAllowPrivateNetwork(resp, true)
+	}
+	return true
+}
+
+// anyOrigin reports whether policy responds identically to every origin.
+func (policy CORSPolicy) anyOrigin() bool {
+	if policy.AllowCredentials {
+		return false
+	}
+	for _, allowed := range policy.AllowedOrigins {
+		if allowed == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func (policy CORSPolicy) allowsOrigin(origin string) bool {
+	serialized, ok := serializeOrigin(origin)
+	if !ok {
+		serialized = origin // such as "null"
+	}
+	for _, allowed := range policy.AllowedOrigins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+		i := strings.Index(allowed, "://*.")
+		if i == -1 {
+			if norm, ok := serializeOrigin(allowed); ok && norm == serialized {
+				return true
+			}
+			continue
+		}
+		scheme, suffix := strings.ToLower(allowed[:i+3]), strings.ToLower(allowed[i+4:])
+		if strings.HasPrefix(serialized, scheme) &&
+			strings.HasSuffix(serialized[len(scheme):], suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (policy CORSPolicy) allowsMethod(method string) bool {
+	if isSafelistedMethod(method) {
+		return true
+	}
+	for _, allowed := range policy.AllowedMethods {
+		if allowed == "*" || allowed == method {
+			return true
+		}
+	}
+	return false
+}
+
+func (policy CORSPolicy) allowsHeader(name string) bool {
+	for _, allowed := range policy.AllowedHeaders {
+		if strings.EqualFold(allowed, name) ||
+			allowed == "*" && !strings.EqualFold(name, "Authorization") {
+			return true
+		}
+	}
+	return isSafelistedHeader(name)
+}
+
+func isSafelistedMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead ||
+		method == http.MethodPost
+}
+
+// isSafelistedHeader reports whether name is a CORS-safelisted request-header
+// (Fetch Standard Section 2.2.2), ignoring restrictions on its value.
+func isSafelistedHeader(name string) bool {
+	switch http.CanonicalHeaderKey(name) {
+	case "Accept", "Accept-Language", "Content-Language", "Content-Type", "Range":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,339 @@
+package httpheader
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func ExampleCORSPolicy_Apply() {
+	policy := CORSPolicy{
+		AllowedOrigins:   []string{"https://app.example.com"},
+		AllowedMethods:   []string{http.MethodPut, http.MethodDelete},
+		AllowedHeaders:   []string{"Authorization", "Content-Type"},
+		AllowCredentials: true,
+		MaxAge:           DeltaSeconds(600),
+	}
+	r := httptest.NewRequest(http.MethodOptions, "https://api.example.com/items/1", nil)
+	SetOrigin(r.Header, "https://app.example.com")
+	SetAccessControlRequestMethod(r.Header, http.MethodPut)
+	SetAccessControlRequestHeaders(r.Header, []string{"authorization", "content-type"})
+	resp := http.Header{}
+	if policy.Apply(r, resp) {
+		fmt.Println(AccessControlAllowOrigin(resp))
+		fmt.Println(AccessControlAllowMethods(resp))
+		fmt.Println(AccessControlAllowHeaders(resp))
+		fmt.Println(resp.Get("Vary"))
+	}
+	// Output: https://app.example.com
+	// [PUT]
+	// [Authorization Content-Type]
+	// Origin
+}
+
+func TestCORSHeaders(t *testing.T) {
+	h := http.Header{
+		"Origin":                                 {" https://example.com "},
+		"Access-Control-Request-Method":          {"PATCH"},
+		"Access-Control-Request-Headers":         {"x-foo,x-bar", "content-type"},
+		"Access-Control-Request-Private-Network": {"true"},
+		"Access-Control-Allow-Origin":            {"*"},
+		"Access-Control-Allow-Credentials":       {"True"},
+		"Access-Control-Allow-Methods":           {"GET, patch ,*"},
+		"Access-Control-Allow-Headers":           {"X-Foo, *"},
+		"Access-Control-Expose-Headers":          {"etag,,x-request-id"},
+		"Access-Control-Max-Age":                 {"600"},
+		"Access-Control-Allow-Private-Network":   {"false"},
+	}
+	checkParse(t, h,
+		"https://example.com", Origin(h),
+		"PATCH", AccessControlRequestMethod(h),
+		[]string{"X-Foo", "X-Bar", "Content-Type"}, AccessControlRequestHeaders(h),
+		true, AccessControlRequestPrivateNetwork(h),
+		"*", AccessControlAllowOrigin(h),
+		false, AccessControlAllowCredentials(h),
+		[]string{"GET", "patch", "*"}, AccessControlAllowMethods(h),
+		[]string{"X-Foo", "*"}, AccessControlAllowHeaders(h),
+		[]string{"Etag", "X-Request-Id"}, AccessControlExposeHeaders(h),
+		DeltaSeconds(600), AccessControlMaxAge(h),
+		false, AccessControlAllowPrivateNetwork(h),
+	)
+
+	h = http.Header{"Access-Control-Max-Age": {"-1"}}
+	checkParse(t, h,
+		"", Origin(h),
+		[]string(nil), AccessControlAllowMethods(h),
+		Delta{}, AccessControlMaxAge(h),
+	)
+}
+
+func TestSetCORSHeaders(t *testing.T) {
+	h := http.Header{}
+	SetOrigin(h, "null")
+	SetAccessControlRequestMethod(h, "PUT")
+	SetAccessControlRequestHeaders(h, []string{"content-type", "x-foo"})
+	SetAccessControlRequestPrivateNetwork(h, true)
+	SetAccessControlAllowOrigin(h, "https://example.com")
+	SetAccessControlAllowCredentials(h, true)
+	SetAccessControlAllowMethods(h, []string{"PUT", "DELETE"})
+	SetAccessControlAllowHeaders(h, []string{"X-Foo"})
+	SetAccessControlExposeHeaders(h, []string{"Etag", "X-Request-Id"})
+	SetAccessControlMaxAge(h, DeltaSeconds(0))
+	SetAccessControlAllowPrivateNetwork(h, true)
+	checkGenerate(t, nil, http.Header{
+		"Origin":                                 {"null"},
+		"Access-Control-Request-Method":          {"PUT"},
+		"Access-Control-Request-Headers":         {"content-type, x-foo"},
+		"Access-Control-Request-Private-Network": {"true"},
+		"Access-Control-Allow-Origin":            {"https://example.com"},
+		"Access-Control-Allow-Credentials":       {"true"},
+		"Access-Control-Allow-Methods":           {"PUT, DELETE"},
+		"Access-Control-Allow-Headers":           {"X-Foo"},
+		"Access-Control-Expose-Headers":          {"Etag, X-Request-Id"},
+		"Access-Control-Max-Age":                 {"0"},
+		"Access-Control-Allow-Private-Network":   {"true"},
+	}, h)
+
+	SetOrigin(h, "")
+	SetAccessControlRequestMethod(h, "")
+	SetAccessControlRequestHeaders(h, nil)
+	SetAccessControlRequestPrivateNetwork(h, false)
+	SetAccessControlAllowOrigin(h, "")
+	SetAccessControlAllowCredentials(h, false)
+	SetAccessControlAllowMethods(h, nil)
+	SetAccessControlAllowHeaders(h, nil)
+	SetAccessControlExposeHeaders(h, nil)
+	SetAccessControlMaxAge(h, Delta{})
+	SetAccessControlAllowPrivateNetwork(h, false)
+	checkGenerate(t, nil, http.Header{}, h)
+}
+
+func TestCORSPolicyApply(t *testing.T) {
+	strict := CORSPolicy{
+		AllowedOrigins:      []string{"https://app.example.com", "https://*.example.net", "null"},
+		AllowedMethods:      []string{"PUT"},
+		AllowedHeaders:      []string{"X-Foo"},
+		ExposedHeaders:      []string{"*", "X-Request-Id"},
+		AllowCredentials:    true,
+		MaxAge:              DeltaSeconds(60),
+		AllowPrivateNetwork: true,
+	}
+	open := CORSPolicy{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{"*"},
+		AllowedHeaders: []string{"*"},
+		ExposedHeaders: []string{"*"},
+	}
+	tests := []struct {
+		policy    CORSPolicy
+		method    string
+		request   http.Header
+		preflight bool
+		result    http.Header
+	}{
+		// Not a CORS request.
+		{
+			strict,
+			"GET",
+			http.Header{},
+			false,
+			http.Header{"Vary": {"Origin"}},
+		},
+		{
+			open,
+			"OPTIONS",
+			http.Header{},
+			false,
+			http.Header{},
+		},
+
+		// Actual requests.
+		{
+			strict,
+			"GET",
+			http.Header{"Origin": {"https://APP.example.com:443"}},
+			false,
+			http.Header{
+				"Vary":                             {"Origin"},
+				"Access-Control-Allow-Origin":      {"https://APP.example.com:443"},
+				"Access-Control-Allow-Credentials": {"true"},
+				"Access-Control-Expose-Headers":    {"X-Request-Id"},
+			},
+		},
+		{
+			strict,
+			"POST",
+			http.Header{"Origin": {"https://a.b.example.net"}},
+			false,
+			http.Header{
+				"Vary":                             {"Origin"},
+				"Access-Control-Allow-Origin":      {"https://a.b.example.net"},
+				"Access-Control-Allow-Credentials": {"true"},
+				"Access-Control-Expose-Headers":    {"X-Request-Id"},
+			},
+		},
+		{
+			strict,
+			"POST",
+			http.Header{"Origin": {"null"}},
+			false,
+			http.Header{
+				"Vary":                             {"Origin"},
+				"Access-Control-Allow-Origin":      {"null"},
+				"Access-Control-Allow-Credentials": {"true"},
+				"Access-Control-Expose-Headers":    {"X-Request-Id"},
+			},
+		},
+		{
+			strict,
+			"GET",
+			http.Header{"Origin": {"https://example.net"}},
+			false,
+			http.Header{"Vary": {"Origin"}},
+		},
+		{
+			CORSPolicy{AllowedOrigins: []string{"http://[::1]:8080"}},
+			"GET",
+			http.Header{"Origin": {"http://[::1]:8080"}},
+			false,
+			http.Header{
+				"Vary":                        {"Origin"},
+				"Access-Control-Allow-Origin": {"http://[::1]:8080"},
+			},
+		},
+		{
+			CORSPolicy{AllowedOrigins: []string{"http://[::1]:8080"}},
+			"GET",
+			http.Header{"Origin": {"http://[::1:8080]"}},
+			false,
+			http.Header{"Vary": {"Origin"}},
+		},
+		{
+			strict,
+			"GET",
+			http.Header{"Origin": {"http://app.example.com"}},
+			false,
+			http.Header{"Vary": {"Origin"}},
+		},
+		{
+			strict,
+			"GET",
+			http.Header{"Origin": {"https://app.example.com.evil.example"}},
+			false,
+			http.Header{"Vary": {"Origin"}},
+		},
+		{
+			open,
+			"DELETE",
+			http.Header{"Origin": {"https://anything.example"}},
+			false,
+			http.Header{
+				"Access-Control-Allow-Origin":   {"*"},
+				"Access-Control-Expose-Headers": {"*"},
+			},
+		},
+		{
+			CORSPolicy{AllowedOrigins: []string{"*"}, AllowCredentials: true},
+			"GET",
+			http.Header{"Origin": {"https://anything.example"}},
+			false,
+			http.Header{
+				"Vary":                             {"Origin"},
+				"Access-Control-Allow-Origin":      {"https://anything.example"},
+				"Access-Control-Allow-Credentials": {"true"},
+			},
+		},
+
+		// Preflight requests.
+		{
+			strict,
+			"OPTIONS",
+			http.Header{
+				"Origin":                                 {"https://app.example.com"},
+				"Access-Control-Request-Method":          {"PUT"},
+				"Access-Control-Request-Headers":         {"content-type,x-foo"},
+				"Access-Control-Request-Private-Network": {"true"},
+			},
+			true,
+			http.Header{
+				"Vary": {
+					"Origin",
+					"Access-Control-Request-Method, Access-Control-Request-Headers",
+				},
+				"Access-Control-Allow-Origin":          {"https://app.example.com"},
+				"Access-Control-Allow-Credentials":     {"true"},
+				"Access-Control-Allow-Methods":         {"PUT"},
+				"Access-Control-Allow-Headers":         {"content-type, x-foo"},
+				"Access-Control-Max-Age":               {"60"},
+				"Access-Control-Allow-Private-Network": {"true"},
+			},
+		},
+		{
+			strict,
+			"OPTIONS",
+			http.Header{
+				"Origin":                        {"https://app.example.com"},
+				"Access-Control-Request-Method": {"PATCH"},
+			},
+			true,
+			http.Header{"Vary": {
+				"Origin",
+				"Access-Control-Request-Method, Access-Control-Request-Headers",
+			}},
+		},
+		{
+			strict,
+			"OPTIONS",
+			http.Header{
+				"Origin":                         {"https://app.example.com"},
+				"Access-Control-Request-Method":  {"POST"},
+				"Access-Control-Request-Headers": {"x-bar"},
+			},
+			true,
+			http.Header{"Vary": {
+				"Origin",
+				"Access-Control-Request-Method, Access-Control-Request-Headers",
+			}},
+		},
+		{
+			open,
+			"OPTIONS",
+			http.Header{
+				"Origin":                         {"https://anything.example"},
+				"Access-Control-Request-Method":  {"PROPFIND"},
+				"Access-Control-Request-Headers": {"x-bar"},
+			},
+			true,
+			http.Header{
+				"Vary":                         {"Access-Control-Request-Method, Access-Control-Request-Headers"},
+				"Access-Control-Allow-Origin":  {"*"},
+				"Access-Control-Allow-Methods": {"PROPFIND"},
+				"Access-Control-Allow-Headers": {"x-bar"},
+			},
+		},
+		{
+			open,
+			"OPTIONS",
+			http.Header{
+				"Origin":                         {"https://anything.example"},
+				"Access-Control-Request-Method":  {"GET"},
+				"Access-Control-Request-Headers": {"authorization"},
+			},
+			true,
+			http.Header{"Vary": {"Access-Control-Request-Method, Access-Control-Request-Headers"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			r := httptest.NewRequest(test.method, "https://api.example.com/", nil)
+			r.Header = test.request
+			resp := http.Header{}
+			preflight := test.policy.Apply(r, resp)
+			if preflight != test.preflight {
+				t.Errorf("got preflight %v, wanted %v", preflight, test.preflight)
+			}
+			checkGenerate(t, test.request, test.result, resp)
+		})
+	}
+}
@@ -0,0 +1,798 @@
+package httpheader
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// A CSPPolicy represents one policy of the Content-Security-Policy header
+// (W3C Content Security Policy Level 3, Section 2.2). Directives are kept
+// in the order they appear.
+type CSPPolicy []CSPDirective
+
+// A CSPDirective represents one directive of a CSPPolicy. Name is lowercase.
+// Value holds the whitespace-separated tokens of the directive's value,
+// such as source expressions; see also the Sources method.
+type CSPDirective struct {
+	Name  string
+	Value []string
+}
+
+// ContentSecurityPolicy parses the Content-Security-Policy header from h
+// (CSP3 Section 3.1). A user agent enforces each of the returned policies,
+// so a resource must be allowed by all of them.
+//
+// As required by CSP3 Section 2.2.1, if a directive appears more than once
+// in a policy, only the first occurrence is kept, and directives with invalid
+// names are skipped.
+func ContentSecurityPolicy(h http.Header) []CSPPolicy {
+	return parseCSP(h["Content-Security-Policy"])
+}
+
+// SetContentSecurityPolicy replaces the Content-Security-Policy header in h
+// (CSP3 Section 3.1).
+func SetContentSecurityPolicy(h http.Header, policies []CSPPolicy) {
+	setCSP(h, "Content-Security-Policy", policies)
+}
+
+// ContentSecurityPolicyReportOnly parses the Content-Security-Policy-Report-Only
+// header from h (CSP3 Section 3.2). See ContentSecurityPolicy for details.
+func ContentSecurityPolicyReportOnly(h http.Header) []CSPPolicy {
+	return parseCSP(h["Content-Security-Policy-Report-Only"])
+}
+
+// SetContentSecurityPolicyReportOnly replaces
+// the Content-Security-Policy-Report-Only header in h (CSP3 Section 3.2).
+func SetContentSecurityPolicyReportOnly(h http.Header, policies []CSPPolicy) {
+	setCSP(h, "Content-Security-Policy-Report-Only", policies)
+}
+
+func parseCSP(values []string) []CSPPolicy {
+	var policies []CSPPolicy
+	for _, v := range values {
+		for _, serialized := range strings.Split(v, ",") {
+			if policy := parseCSPPolicy(serialized); len(policy) > 0 {
+				policies = append(policies, policy)
+			}
+		}
+	}
+	return policies
+}
+
+func parseCSPPolicy(serialized string) CSPPolicy {
+	var policy CSPPolicy
+	for _, token := range strings.Split(serialized, ";") {
+		fields := strings.FieldsFunc(token, isCSPSpace)
+		if len(fields) == 0 {
+			continue
+		}
+		name := strings.ToLower(fields[0])
+		if !isCSPDirectiveName(name) || policy.index(name) != -1 {
+			continue
+		}
+		var value []string
+		if len(fields) > 1 {
+			value = fields[1:]
+		}
+		policy = append(policy, CSPDirective{Name: name, Value: value})
+	}
+	return policy
+}
+
+func isCSPSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '\f' || r == '\r'
+}
+
+func isCSPDirectiveName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if !('a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-') {
+			return false
+		}
+	}
+	return name != ""
+}
+
+func setCSP(h http.Header, name string, policies []CSPPolicy) {
+	b := &strings.Builder{}
+	for _, policy := range policies {
+		if len(policy) == 0 {
+			continue
+		}
+		if b.Len() > 0 {
+			write(b, ", ")
+		}
+		for i, directive := range policy {
+			if i > 0 {
+				write(b, "; ")
+			}
+			write(b, directive.Name)
+			for _, token := range directive.Value {
+				write(b, " ", token)
+			}
+		}
+	}
+	if b.Len() == 0 {
+		h.Del(name)
+		return
+	}
+	h.Set(name, b.String())
+}
+
+func (policy CSPPolicy) index(name string) int {
+	for i, directive := range policy {
+		if directive.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Directive returns the directive with the given lowercase name from policy.
+// It doesn't consider fallback directives.
+func (policy CSPPolicy) Directive(name string) (CSPDirective, bool) {
+	if i := policy.index(name); i != -1 {
+		return policy[i], true
+	}
+	return CSPDirective{}, false
+}
+
+// cspFallback lists the directives that a fetch directive falls back to
+// when it's missing (CSP3 Section 6.8.3).
+var cspFallback = map[string][]string{
+	"default-src":     nil,
+	"script-src":      {"default-src"},
+	"script-src-elem": {"script-src", "default-src"},
+	"script-src-attr": {"script-src", "default-src"},
+	"style-src":       {"default-src"},
+	"style-src-elem":  {"style-src", "default-src"},
+	"style-src-attr":  {"style-src", "default-src"},
+	"child-src":       {"default-src"},
+	"worker-src":      {"child-src", "script-src", "default-src"},
+	"frame-src":       {"child-src", "default-src"},
+	"connect-src":     {"default-src"},
+	"font-src":        {"default-src"},
+	"img-src":         {"default-src"},
+	"manifest-src":    {"default-src"},
+	"media-src":       {"default-src"},
+	"object-src":      {"default-src"},
+}
+
+// cspFetchOrder lists the keys of cspFallback so that every directive
+// comes after those it falls back to.
+var cspFetchOrder = []string{
+	"default-src", "script-src", "style-src", "child-src",
+	"connect-src", "font-src", "frame-src", "img-src", "manifest-src",
+	"media-src", "object-src", "script-src-attr", "script-src-elem",
+	"style-src-attr", "style-src-elem", "worker-src",
+}
+
+// isCSPSourceList reports whether the directive with the given name
+// has a source list as its value.
+func isCSPSourceList(name string) bool {
+	if _, ok := cspFallback[name]; ok {
+		return true
+	}
+	return name == "base-uri" || name == "form-action" ||
+		name == "frame-ancestors"
+}
+
+// isCSPScriptDirective reports whether 'strict-dynamic' is honored
+// in the directive with the given name (CSP3 Section 8.2).
+func isCSPScriptDirective(name string) bool {
+	return strings.HasPrefix(name, "script-src") ||
+		name == "worker-src" || name == "default-src"
+}
+
+// effective returns the directive that governs name in policy: either name
+// itself or the first of its fallback directives that is present.
+func (policy CSPPolicy) effective(name string) (CSPDirective, bool) {
+	if directive, ok := policy.Directive(name); ok {
+		return directive, true
+	}
+	for _, fallback := range cspFallback[name] {
+		if directive, ok := policy.Directive(fallback); ok {
+			return directive, true
+		}
+	}
+	return CSPDirective{}, false
+}
+
+// A CSPSource represents one source expression (CSP3 Section 2.3.1).
+// Exactly one kind of expression is represented, depending on which fields
+// are set:
+//
+//	'self', 'unsafe-inline' etc.: Keyword without quotes, lowercase
+//	'nonce-...': Nonce
+//	'sha256-...' etc.: HashAlgorithm (lowercase) and Hash
+//	https: (scheme-source): Scheme (lowercase)
+//	https://*.example.com:443/path (host-source): Host, optionally
+//	    with Scheme, Port and Path
+//	*: Host "*"
+type CSPSource struct {
+	Keyword       string
+	Nonce         string
+	HashAlgorithm string
+	Hash          string
+	Scheme        string
+	Host          string
+	Port          string
+	Path          string
+}
+
+// Sources parses the value of directive as a source list. Invalid source
+// expressions are skipped, as they match nothing.
+func (directive CSPDirective) Sources() []CSPSource {
+	var sources []CSPSource
+	for _, token := range directive.Value {
+		if src, ok := parseCSPSource(token); ok {
+			sources = append(sources, src)
+		}
+	}
+	return sources
+}
+
+func parseCSPSource(s string) (src CSPSource, ok bool) {
+	if len(s) > 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		inner := s[1 : len(s)-1]
+		lower := strings.ToLower(inner)
+		if strings.HasPrefix(lower, "nonce-") {
+			src.Nonce = inner[len("nonce-"):]
+			return src, isBase64Value(src.Nonce)
+		}
+		for _, alg := range []string{"sha256", "sha384", "sha512"} {
+			if strings.HasPrefix(lower, alg+"-") {
+				src.HashAlgorithm, src.Hash = alg, inner[len(alg)+1:]
+				return src, isBase64Value(src.Hash)
+			}
+		}
+		src.Keyword = lower
+		return src, isCSPDirectiveName(lower)
+	}
+
+	rest := s
+	if i := strings.IndexByte(rest, ':'); i != -1 && isCSPScheme(rest[:i]) {
+		switch {
+		case i == len(rest)-1:
+			src.Scheme = strings.ToLower(rest[:i])
+			return src, true
+		case strings.HasPrefix(rest[i:], "://"):
+			src.Scheme = strings.ToLower(rest[:i])
+			rest = rest[i+3:]
+		}
+	}
+	end := strings.IndexAny(rest, ":/")
+	if end == -1 {
+		end = len(rest)
+	}
+	src.Host, rest = rest[:end], rest[end:]
+	if !isCSPHost(src.Host) {
+		return CSPSource{}, false
+	}
+	if strings.HasPrefix(rest, ":") {
+		end = strings.IndexByte(rest, '/')
+		if end == -1 {
+			end = len(rest)
+		}
+		src.Port, rest = rest[1:end], rest[end:]
+		if src.Port != "*" && !isDigits(src.Port) {
+			return CSPSource{}, false
+		}
+	}
+	src.Path = rest
+	return src, true
+}
+
+func isBase64Value(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '+' || c == '/' || c == '-' || c == '_' || c == '=') {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func isCSPScheme(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z':
+		case i > 0 && ('0' <= c && c <= '9' || c == '+' || c == '-' || c == '.'):
+		default:
+			return false
+		}
+	}
+	return s != ""
+}
+
+func isCSPHost(s string) bool {
+	if s == "*" {
+		return true
+	}
+	s = strings.TrimPrefix(s, "*.")
+	for _, label := range strings.Split(s, ".") {
+		if label == "" {
+			return false
+		}
+		for i := 0; i < len(label); i++ {
+			c := label[i]
+			if !('A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' ||
+				'0' <= c && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// String serializes src as a source expression.
+func (src CSPSource) String() string {
+	switch {
+	case src.Keyword != "":
+		return "'" + src.Keyword + "'"
+	case src.Nonce != "":
+		return "'nonce-" + src.Nonce + "'"
+	case src.HashAlgorithm != "":
+		return "'" + src.HashAlgorithm + "-" + src.Hash + "'"
+	case src.Host == "":
+		return src.Scheme + ":"
+	}
+	b := &strings.Builder{}
+	if src.Scheme != "" {
+		write(b, src.Scheme, "://")
+	}
+	write(b, src.Host)
+	if src.Port != "" {
+		write(b, ":", src.Port)
+	}
+	write(b, src.Path)
+	return b.String()
+}
+
+func (src CSPSource) isWildcard() bool {
+	return src.Host == "*" && src.Scheme == "" && src.Port == "" && src.Path == ""
+}
+
+// NewCSPNonce returns a new random value suitable for AddNonce.
+func NewCSPNonce() (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(nonce), nil
+}
+
+// AddNonce adds a 'nonce-...' source expression to the directive with
+// the given name in policy, such as script-src, which must be a fetch
+// directive. If that directive is missing but one of its fallback directives
+// (such as default-src) is present, a copy of the latter is added under name,
+// so that other directives are unaffected. If none of them is present,
+// policy doesn't restrict the directive, and nothing needs to be added.
+// A 'none' expression in the directive is removed.
+func (policy *CSPPolicy) AddNonce(name, nonce string) {
+	directive, ok := policy.effective(name)
+	if !ok {
+		return
+	}
+	expr := CSPSource{Nonce: nonce}.String()
+	value := make([]string, 0, len(directive.Value)+1)
+	for _, token := range directive.Value {
+		if token == expr {
+			return
+		}
+		if !strings.EqualFold(token, "'none'") {
+			value = append(value, token)
+		}
+	}
+	value = append(value, expr)
+	if i := policy.index(name); i != -1 {
+		(*policy)[i].Value = value
+	} else {
+		*policy = append(*policy, CSPDirective{Name: name, Value: value})
+	}
+}
+
+// Allows reports whether policy allows fetching u under the directive
+// with the given name, such as img-src or script-src-elem, taking into
+// account fallback directives (CSP3 Section 6.7.2.5). self is the URL
+// of the protected resource, against which 'self' and host-sources without
+// a scheme are matched; it may be nil if unknown.
+//
+// If the directive's source list contains 'strict-dynamic', URL-based
+// expressions are ignored for scripts (CSP3 Section 8.2), so Allows returns
+// false, although the script may still be allowed by a nonce or a hash.
+func (policy CSPPolicy) Allows(name string, u, self *url.URL) bool {
+	directive, ok := policy.effective(name)
+	if !ok {
+		return true
+	}
+	sources := directive.Sources()
+	if isCSPScriptDirective(name) {
+		for _, src := range sources {
+			if src.Keyword == "strict-dynamic" {
+				return false
+			}
+		}
+	}
+	for _, src := range sources {
+		if src.matches(u, self) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches implements CSP3 Section 6.7.2.8.
+func (src CSPSource) matches(u, self *url.URL) bool {
+	switch {
+	case src.Keyword == "self":
+		return self != nil && sameCSPOrigin(u, self)
+	case src.Keyword != "" || src.Nonce != "" || src.HashAlgorithm != "":
+		return false
+	case src.isWildcard():
+		scheme := strings.ToLower(u.Scheme)
+		return scheme == "http" || scheme == "https" ||
+			self != nil && strings.EqualFold(scheme, self.Scheme)
+	case src.Host == "":
+		return schemePartMatch(src.Scheme, u.Scheme)
+	}
+	if u.Host == "" {
+		return false
+	}
+	if src.Scheme == "" {
+		if self == nil || !schemePartMatch(self.Scheme, u.Scheme) {
+			return false
+		}
+	} else if !schemePartMatch(src.Scheme, u.Scheme) {
+		return false
+	}
+	return hostPartMatch(src.Host, u.Hostname()) &&
+		portPartMatch(src.Port, u) &&
+		pathPartMatch(src.Path, u.Path)
+}
+
+func schemePartMatch(pattern, scheme string) bool {
+	pattern, scheme = strings.ToLower(pattern), strings.ToLower(scheme)
+	switch {
+	case pattern == scheme:
+		return true
+	case pattern == "http":
+		return scheme == "https"
+	case pattern == "ws":
+		return scheme == "wss" || scheme == "http" || scheme == "https"
+	case pattern == "wss":
+		return scheme == "https"
+	}
+	return false
+}
+
+func hostPartMatch(pattern, host string) bool {
+	if pattern == "*" {
+		return true
+	}
+	if strings.HasPrefix(pattern, "*.") {
+		return hasSuffixFold(host, pattern[1:])
+	}
+	return strings.EqualFold(pattern, host)
+}
+
+func hasSuffixFold(s, suffix string) bool {
+	return len(s) >= len(suffix) &&
+		strings.EqualFold(s[len(s)-len(suffix):], suffix)
+}
+
+func portPartMatch(pattern string, u *url.URL) bool {
+	port := effectivePort(u)
+	switch pattern {
+	case "*":
+		return true
+	case "":
+		return port == defaultPort(u.Scheme)
+	case "80":
+		return port == "80" || port == "443"
+	}
+	return strings.TrimLeft(pattern, "0") == strings.TrimLeft(port, "0")
+}
+
+func pathPartMatch(pattern, path string) bool {
+	if pattern == "" || pattern == "/" && path == "" {
+		return true
+	}
+	if unescaped, err := url.PathUnescape(pattern); err == nil {
+		pattern = unescaped
+	}
+	if strings.HasSuffix(pattern, "/") {
+		return strings.HasPrefix(path, pattern)
+	}
+	return path == pattern
+}
+
+func sameCSPOrigin(u, self *url.URL) bool {
+	if !strings.EqualFold(u.Hostname(), self.Hostname()) {
+		return false
+	}
+	scheme, selfScheme := strings.ToLower(u.Scheme), strings.ToLower(self.Scheme)
+	port, selfPort := effectivePort(u), effectivePort(self)
+	if scheme == selfScheme && port == selfPort {
+		return true
+	}
+	// An upgrade to a secure scheme is also allowed (CSP3 Section 6.7.2.8).
+	if scheme == "https" || scheme == "wss" ||
+		selfScheme == "http" && scheme == "ws" {
+		return port == selfPort ||
+			port == defaultPort(scheme) && selfPort == defaultPort(selfScheme)
+	}
+	return false
+}
+
+func effectivePort(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+	return defaultPort(u.Scheme)
+}
+
+func defaultPort(scheme string) string {
+	switch strings.ToLower(scheme) {
+	case "http", "ws":
+		return "80"
+	case "https", "wss":
+		return "443"
+	case "ftp":
+		return "21"
+	}
+	return ""
+}
+
+// MergeCSP combines policies into one policy that allows only what
+// is allowed by all of them, as when they are all enforced together.
+// This is useful for assembling a single policy from the requirements
+// of several components.
+//
+// Source lists are intersected expression by expression. When the exact
+// intersection cannot be expressed (such as between a nonce and
+// 'unsafe-inline'), the result is stricter than necessary, never more
+// permissive. Flags of the sandbox directive are intersected likewise.
+// Other directives, such as report-uri or upgrade-insecure-requests,
+// are taken from the first policy that has them.
+func MergeCSP(policies ...CSPPolicy) CSPPolicy {
+	var merged CSPPolicy
+	for i, policy := range policies {
+		if i == 0 {
+			merged = append(CSPPolicy(nil), policy...)
+		} else {
+			merged = mergeCSP(merged, policy)
+		}
+	}
+	return merged
+}
+
+func mergeCSP(a, b CSPPolicy) CSPPolicy {
+	var merged CSPPolicy
+	names := make([]string, 0, len(a)+len(b))
+	for _, directive := range a {
+		names = append(names, directive.Name)
+	}
+	for _, directive := range b {
+		if a.index(directive.Name) == -1 {
+			names = append(names, directive.Name)
+		}
+	}
+	for _, name := range names {
+		var value []string
+		switch {
+		case isCSPSourceList(name):
+			value, _ = intersectCSPEffective(a, b, name)
+		case name == "sandbox":
+			da, okA := a.Directive(name)
+			db, okB := b.Directive(name)
+			switch {
+			case !okA:
+				value = db.Value
+			case !okB:
+				value = da.Value
+			default:
+				value = intersectFold(da.Value, db.Value)
+			}
+		default:
+			directive, ok := a.Directive(name)
+			if !ok {
+				directive, _ = b.Directive(name)
+			}
+			value = directive.Value
+		}
+		merged = append(merged, CSPDirective{Name: name, Value: value})
+	}
+
+	// The fallback chains of a and b may combine in such a way that some
+	// directive missing from merged would fall back to the wrong value.
+	for _, name := range cspFetchOrder {
+		if merged.index(name) != -1 {
+			continue
+		}
+		want, ok := intersectCSPEffective(a, b, name)
+		if !ok {
+			continue
+		}
+		if got, _ := merged.effective(name); !equalStrings(got.Value, want) {
+			merged = append(merged, CSPDirective{Name: name, Value: want})
+		}
+	}
+	return merged
+}
+
+// intersectCSPEffective returns the intersection of the source lists
+// that govern name in a and b, or false if neither restricts name.
+func intersectCSPEffective(a, b CSPPolicy, name string) ([]string, bool) {
+	da, okA := a.effective(name)
+	db, okB := b.effective(name)
+	switch {
+	case !okA && !okB:
+		return nil, false
+	case !okA:
+		return db.Value, true
+	case !okB:
+		return da.Value, true
+	}
+	return intersectSources(name, da.Sources(), db.Sources()), true
+}
+
+func intersectSources(name string, a, b []CSPSource) []string {
+	a, b = normalizeSources(name, a), normalizeSources(name, b)
+	var value []string
+	add := func(src CSPSource) {
+		s := src.String()
+		for _, other := range value {
+			if other == s {
+				return
+			}
+		}
+		value = append(value, s)
+	}
+	for _, src := range a {
+		for _, other := range b {
+			if other.subsumes(src) {
+				add(src)
+				break
+			}
+		}
+	}
+	for _, src := range b {
+		for _, other := range a {
+			if other.subsumes(src) {
+				add(src)
+				break
+			}
+		}
+	}
+	if len(value) == 0 {
+		value = []string{"'none'"}
+	}
+	return value
+}
+
+// normalizeSources removes source expressions that have no effect
+// in the directive with the given name, so that the remaining expressions
+// can be compared independently.
+func normalizeSources(name string, sources []CSPSource) []CSPSource {
+	var hasNonceOrHash, strictDynamic bool
+	for _, src := range sources {
+		if src.Nonce != "" || src.HashAlgorithm != "" {
+			hasNonceOrHash = true
+		}
+		if src.Keyword == "strict-dynamic" && isCSPScriptDirective(name) {
+			strictDynamic = true
+		}
+	}
+	normalized := make([]CSPSource, 0, len(sources))
+	for _, src := range sources {
+		switch {
+		case src.Keyword == "none":
+			continue
+		case src.Keyword == "unsafe-inline" && (hasNonceOrHash || strictDynamic):
+			continue
+		case strictDynamic && (src.Keyword == "self" || src.Host != "" || src.Scheme != ""):
+			continue
+		}
+		normalized = append(normalized, src)
+	}
+	return normalized
+}
+
+// subsumes reports whether src matches everything that other matches.
+// It may return false negatives, but never false positives.
+func (src CSPSource) subsumes(other CSPSource) bool {
+	if src == other {
+		return true
+	}
+	if other.Keyword != "" || other.Nonce != "" || other.HashAlgorithm != "" {
+		return src.Keyword == other.Keyword && src.Nonce == other.Nonce &&
+			src.HashAlgorithm == other.HashAlgorithm && src.Hash == other.Hash
+	}
+	switch {
+	case src.Keyword != "" || src.Nonce != "" || src.HashAlgorithm != "":
+		return false
+	case other.isWildcard():
+		return src.isWildcard()
+	case src.isWildcard():
+		return other.Scheme == "" ||
+			schemeSubsumes("http", other.Scheme)
+	case other.Scheme == "":
+		// Depends on the scheme of the protected resource.
+		return src.Host != "" && src.Scheme == "" && hostSubsumes(src, other)
+	case src.Host == "":
+		return schemeSubsumes(src.Scheme, other.Scheme)
+	case other.Host == "":
+		return false
+	}
+	return schemeSubsumes(src.Scheme, other.Scheme) && hostSubsumes(src, other)
+}
+
+// schemeSubsumes reports whether every URL scheme matched by other
+// is also matched by pattern.
+func schemeSubsumes(pattern, other string) bool {
+	for _, scheme := range []string{other, "http", "https", "ws", "wss"} {
+		if schemePartMatch(other, scheme) && !schemePartMatch(pattern, scheme) {
+			return false
+		}
+	}
+	return true
+}
+
+func hostSubsumes(src, other CSPSource) bool {
+	switch {
+	case src.Host == "*":
+	case other.Host == "*":
+		return false
+	case strings.HasPrefix(src.Host, "*."):
+		if !hasSuffixFold(other.Host, src.Host[1:]) {
+			return false
+		}
+	case !strings.EqualFold(src.Host, other.Host):
+		return false
+	}
+	if src.Port != "*" && src.Port != other.Port {
+		return false
+	}
+	return src.Path == "" || src.Path == other.Path ||
+		strings.HasSuffix(src.Path, "/") && strings.HasPrefix(other.Path, src.Path)
+}
+
+func intersectFold(a, b []string) []string {
+	value := []string{}
+	for _, s := range a {
+		for _, t := range b {
+			if strings.EqualFold(s, t) {
+				value = append(value, s)
+				break
+			}
+		}
+	}
+	return value
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
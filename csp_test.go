@@ -0,0 +1,419 @@
+package httpheader
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func ExampleMergeCSP() {
+	app := CSPPolicy{
+		{Name: "default-src", Value: []string{"'self'"}},
+		{Name: "img-src", Value: []string{"'self'", "https:"}},
+	}
+	widget := CSPPolicy{
+		{Name: "img-src", Value: []string{"https://img.example.com"}},
+	}
+	policy := MergeCSP(app, widget)
+	policy.AddNonce("script-src", "dGhlIHNhbXBsZSBub25jZQ==")
+	header := http.Header{}
+	SetContentSecurityPolicy(header, []CSPPolicy{policy})
+	header.Write(os.Stdout)
+	// Output: Content-Security-Policy: default-src 'self'; img-src https://img.example.com; script-src 'self' 'nonce-dGhlIHNhbXBsZSBub25jZQ=='
+}
+
+func ExampleCSPPolicy_Allows() {
+	header := http.Header{"Content-Security-Policy": {
+		"default-src 'self'; script-src https://cdn.example.com/js/",
+	}}
+	self, _ := url.Parse("https://www.example.com/")
+	script, _ := url.Parse("https://cdn.example.com/js/app.js")
+	for _, policy := range ContentSecurityPolicy(header) {
+		fmt.Println(policy.Allows("script-src-elem", script, self))
+		fmt.Println(policy.Allows("img-src", script, self))
+	}
+	// Output: true
+	// false
+}
+
+func TestContentSecurityPolicy(t *testing.T) {
+	tests := []struct {
+		header http.Header
+		result []CSPPolicy
+	}{
+		// Valid headers.
+		{
+			http.Header{"Content-Security-Policy": {"default-src 'self'"}},
+			[]CSPPolicy{
+				{{Name: "default-src", Value: []string{"'self'"}}},
+			},
+		},
+		{
+			http.Header{"Content-Security-Policy": {
+				"Script-Src 'self'  https://cdn.example.com;upgrade-insecure-requests; ",
+				"img-src *, frame-ancestors 'none'",
+			}},
+			[]CSPPolicy{
+				{
+					{Name: "script-src", Value: []string{"'self'", "https://cdn.example.com"}},
+					{Name: "upgrade-insecure-requests"},
+				},
+				{
+					{Name: "img-src", Value: []string{"*"}},
+				},
+				{
+					{Name: "frame-ancestors", Value: []string{"'none'"}},
+				},
+			},
+		},
+		{
+			http.Header{"Content-Security-Policy": {
+				"script-src 'nonce-abc'; script-src 'unsafe-inline'; report-to csp",
+			}},
+			[]CSPPolicy{
+				{
+					{Name: "script-src", Value: []string{"'nonce-abc'"}},
+					{Name: "report-to", Value: []string{"csp"}},
+				},
+			},
+		},
+
+		// Invalid headers.
+		// Precise outputs on them are not a guaranteed part of the API.
+		// They may change as convenient for the parsing code.
+		{
+			http.Header{"Content-Security-Policy": {";;, ,"}},
+			nil,
+		},
+		{
+			http.Header{"Content-Security-Policy": {
+				"img_src 'self'; img-src data:",
+			}},
+			[]CSPPolicy{
+				{{Name: "img-src", Value: []string{"data:"}}},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			checkParse(t, test.header, test.result, ContentSecurityPolicy(test.header))
+		})
+	}
+}
+
+func TestSetContentSecurityPolicyReportOnly(t *testing.T) {
+	tests := []struct {
+		input  []CSPPolicy
+		result http.Header
+	}{
+		{
+			nil,
+			http.Header{},
+		},
+		{
+			[]CSPPolicy{{}},
+			http.Header{},
+		},
+		{
+			[]CSPPolicy{
+				{
+					{Name: "default-src", Value: []string{"'none'"}},
+					{Name: "block-all-mixed-content"},
+					{Name: "report-uri", Value: []string{"/csp", "https://example.com/csp"}},
+				},
+				{
+					{Name: "sandbox"},
+				},
+			},
+			http.Header{"Content-Security-Policy-Report-Only": {
+				"default-src 'none'; block-all-mixed-content; report-uri /csp https://example.com/csp, sandbox",
+			}},
+		},
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			header := http.Header{}
+			SetContentSecurityPolicyReportOnly(header, test.input)
+			checkGenerate(t, test.input, test.result, header)
+		})
+	}
+}
+
+func TestCSPDirectiveSources(t *testing.T) {
+	tests := []struct {
+		input  string
+		result CSPSource
+		ok     bool
+	}{
+		{"'self'", CSPSource{Keyword: "self"}, true},
+		{"'Unsafe-Inline'", CSPSource{Keyword: "unsafe-inline"}, true},
+		{"'nonce-dGhl+IHN/hbX=='", CSPSource{Nonce: "dGhl+IHN/hbX=="}, true},
+		{"'sha256-abc_-='", CSPSource{HashAlgorithm: "sha256", Hash: "abc_-="}, true},
+		{"'SHA512-abc'", CSPSource{HashAlgorithm: "sha512", Hash: "abc"}, true},
+		{"HTTPS:", CSPSource{Scheme: "https"}, true},
+		{"data:", CSPSource{Scheme: "data"}, true},
+		{"*", CSPSource{Host: "*"}, true},
+		{"example.com", CSPSource{Host: "example.com"}, true},
+		{"localhost:8080", CSPSource{Host: "localhost", Port: "8080"}, true},
+		{
+			"https://*.example.com:*/static/",
+			CSPSource{Scheme: "https", Host: "*.example.com", Port: "*", Path: "/static/"},
+			true,
+		},
+		{
+			"wss://example.com/socket",
+			CSPSource{Scheme: "wss", Host: "example.com", Path: "/socket"},
+			true,
+		},
+		{"'nonce-'", CSPSource{}, false},
+		{"'nonce-a b'", CSPSource{}, false},
+		{"'self", CSPSource{}, false},
+		{"https://", CSPSource{}, false},
+		{"example..com", CSPSource{}, false},
+		{"example.com:http", CSPSource{}, false},
+		{"ex*mple.com", CSPSource{}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			directive := CSPDirective{Name: "default-src", Value: []string{test.input}}
+			sources := directive.Sources()
+			if !test.ok {
+				if len(sources) != 0 {
+					t.Errorf("got %#v, wanted nothing", sources)
+				}
+				return
+			}
+			if len(sources) != 1 || sources[0] != test.result {
+				t.Fatalf("got %#v, wanted %#v", sources, test.result)
+			}
+			reparsed, _ := parseCSPSource(sources[0].String())
+			if reparsed != test.result {
+				t.Errorf("round trip via %q: got %#v", sources[0].String(), reparsed)
+			}
+		})
+	}
+}
+
+func TestCSPPolicyAddNonce(t *testing.T) {
+	tests := []struct {
+		policy CSPPolicy
+		name   string
+		result CSPPolicy
+	}{
+		{
+			CSPPolicy{{Name: "img-src", Value: []string{"*"}}},
+			"script-src",
+			CSPPolicy{{Name: "img-src", Value: []string{"*"}}},
+		},
+		{
+			CSPPolicy{{Name: "script-src", Value: []string{"'self'", "'unsafe-inline'"}}},
+			"script-src",
+			CSPPolicy{{Name: "script-src", Value: []string{"'self'", "'unsafe-inline'", "'nonce-abc'"}}},
+		},
+		{
+			CSPPolicy{{Name: "script-src", Value: []string{"'nonce-abc'"}}},
+			"script-src",
+			CSPPolicy{{Name: "script-src", Value: []string{"'nonce-abc'"}}},
+		},
+		{
+			CSPPolicy{{Name: "default-src", Value: []string{"'none'"}}},
+			"style-src-elem",
+			CSPPolicy{
+				{Name: "default-src", Value: []string{"'none'"}},
+				{Name: "style-src-elem", Value: []string{"'nonce-abc'"}},
+			},
+		},
+		{
+			CSPPolicy{
+				{Name: "default-src", Value: []string{"'none'"}},
+				{Name: "script-src", Value: []string{"'self'"}},
+			},
+			"worker-src",
+			CSPPolicy{
+				{Name: "default-src", Value: []string{"'none'"}},
+				{Name: "script-src", Value: []string{"'self'"}},
+				{Name: "worker-src", Value: []string{"'self'", "'nonce-abc'"}},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			policy := append(CSPPolicy(nil), test.policy...)
+			policy.AddNonce(test.name, "abc")
+			if !reflect.DeepEqual(policy, test.result) {
+				t.Errorf("adding nonce to %s in %#v\ngot:    %#v\nwanted: %#v",
+					test.name, test.policy, policy, test.result)
+			}
+		})
+	}
+}
+
+func TestNewCSPNonce(t *testing.T) {
+	nonce1, err := NewCSPNonce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce2, _ := NewCSPNonce()
+	if nonce1 == nonce2 {
+		t.Errorf("got the same nonce twice: %q", nonce1)
+	}
+	if _, ok := parseCSPSource("'nonce-" + nonce1 + "'"); !ok {
+		t.Errorf("bad nonce %q", nonce1)
+	}
+}
+
+func TestCSPPolicyAllows(t *testing.T) {
+	tests := []struct {
+		policy string
+		name   string
+		url    string
+		self   string
+		result bool
+	}{
+		{"img-src 'self'", "script-src", "https://evil.example/", "", true},
+		{"default-src 'none'", "img-src", "https://example.com/", "", false},
+		{"default-src", "img-src", "https://example.com/", "", false},
+		{"default-src 'self'", "img-src", "https://example.com/a.png", "https://example.com/", true},
+		{"default-src 'self'", "img-src", "https://example.com:443/a.png", "https://example.com/", true},
+		{"default-src 'self'", "img-src", "https://example.com/a.png", "http://example.com/", true},
+		{"default-src 'self'", "img-src", "http://example.com/a.png", "https://example.com/", false},
+		{"default-src 'self'", "img-src", "https://example.com:8443/a.png", "https://example.com/", false},
+		{"default-src 'self'", "img-src", "https://example.com/a.png", "", false},
+		{"default-src *", "img-src", "https://example.com/a.png", "", true},
+		{"default-src *", "img-src", "data:image/png;base64,AAAA", "https://example.com/", false},
+		{"default-src * data:", "img-src", "data:image/png;base64,AAAA", "https://example.com/", true},
+		{"default-src http:", "img-src", "https://example.com/", "", true},
+		{"default-src https:", "img-src", "http://example.com/", "", false},
+		{"connect-src ws:", "connect-src", "wss://example.com/", "", true},
+		{"img-src *.example.com", "img-src", "https://a.b.example.com/", "https://example.com/", true},
+		{"img-src *.example.com", "img-src", "https://example.com/", "https://example.com/", false},
+		{"img-src example.com", "img-src", "https://EXAMPLE.com/", "https://example.com/", true},
+		{"img-src example.com", "img-src", "ftp://example.com/", "https://example.com/", false},
+		{"img-src example.com", "img-src", "https://example.com/", "", false},
+		{"img-src https://example.com", "img-src", "https://example.com:8443/", "", false},
+		{"img-src https://example.com:*", "img-src", "https://example.com:8443/", "", true},
+		{"img-src http://example.com:80", "img-src", "https://example.com/", "", true},
+		{"img-src https://example.com/img/", "img-src", "https://example.com/img/a.png", "", true},
+		{"img-src https://example.com/img/", "img-src", "https://example.com/img", "", false},
+		{"img-src https://example.com/a%20b.png", "img-src", "https://example.com/a%20b.png", "", true},
+		{"img-src https://example.com/a.png", "img-src", "https://example.com/a.png/b", "", false},
+		{"script-src 'self' 'nonce-abc'", "script-src-elem", "https://example.com/a.js", "https://example.com/", true},
+		{"script-src 'self' 'strict-dynamic'", "script-src-elem", "https://example.com/a.js", "https://example.com/", false},
+		{"default-src 'self' 'strict-dynamic'", "img-src", "https://example.com/a.png", "https://example.com/", true},
+		{"default-src 'none'; child-src 'self'", "worker-src", "https://example.com/w.js", "https://example.com/", true},
+		{"child-src 'none'; script-src 'self'", "worker-src", "https://example.com/w.js", "https://example.com/", false},
+		{"default-src 'none'", "base-uri", "https://example.com/", "", true},
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			policy := parseCSPPolicy(test.policy)
+			u, err := url.Parse(test.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var self *url.URL
+			if test.self != "" {
+				self, _ = url.Parse(test.self)
+			}
+			if got := policy.Allows(test.name, u, self); got != test.result {
+				t.Errorf("%q %s %s from %s: got %v, wanted %v",
+					test.policy, test.name, test.url, test.self, got, test.result)
+			}
+		})
+	}
+}
+
+func TestMergeCSP(t *testing.T) {
+	tests := []struct {
+		policies []string
+		result   string
+	}{
+		{
+			nil,
+			"",
+		},
+		{
+			[]string{"default-src 'self'"},
+			"default-src 'self'",
+		},
+		{
+			[]string{"default-src 'self' https://cdn.example.com", "default-src 'self'"},
+			"default-src 'self'",
+		},
+		{
+			[]string{"img-src https:", "img-src https://img.example.com data:"},
+			"img-src https://img.example.com",
+		},
+		{
+			[]string{"img-src http:", "img-src https://img.example.com http:"},
+			"img-src http: https://img.example.com",
+		},
+		{
+			[]string{"img-src *", "img-src example.com wss: https://*.example.com/img/"},
+			"img-src example.com https://*.example.com/img/",
+		},
+		{
+			[]string{"img-src *.example.com", "img-src *.cdn.example.com example.com:443"},
+			"img-src *.cdn.example.com",
+		},
+		{
+			[]string{"img-src https://example.com/img/", "img-src https://example.com/img/a.png https://example.com/"},
+			"img-src https://example.com/img/ https://example.com/img/a.png",
+		},
+		{
+			[]string{"script-src 'self'", "script-src https://cdn.example.com"},
+			"script-src 'none'",
+		},
+		{
+			[]string{"default-src 'self'", "script-src 'self' https://cdn.example.com"},
+			"default-src 'self'; script-src 'self'",
+		},
+		{
+			[]string{"script-src 'unsafe-inline' 'self'", "script-src 'nonce-abc' 'unsafe-inline' 'self'"},
+			"script-src 'self'",
+		},
+		{
+			[]string{"script-src 'strict-dynamic' 'nonce-abc' https:", "script-src 'nonce-abc' https:"},
+			"script-src 'nonce-abc'",
+		},
+		{
+			[]string{"script-src 'none'", "script-src 'self'"},
+			"script-src 'none'",
+		},
+		{
+			// Without an explicit worker-src, workers would fall back
+			// to child-src, ignoring the restriction from the first policy.
+			[]string{"script-src 'self'", "child-src 'self' https://example.com"},
+			"script-src 'self'; child-src 'self' https://example.com; worker-src 'self'",
+		},
+		{
+			[]string{"sandbox allow-scripts allow-forms; report-uri /a", "sandbox allow-forms; report-uri /b; upgrade-insecure-requests"},
+			"sandbox allow-forms; report-uri /a; upgrade-insecure-requests",
+		},
+		{
+			[]string{"sandbox allow-scripts", "sandbox"},
+			"sandbox",
+		},
+		{
+			[]string{"default-src 'self' https:", "img-src *", "img-src https://example.com 'self'"},
+			"default-src 'self' https:; img-src https://example.com",
+		},
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			var policies []CSPPolicy
+			for _, s := range test.policies {
+				policies = append(policies, parseCSPPolicy(s))
+			}
+			header := http.Header{}
+			SetContentSecurityPolicy(header, []CSPPolicy{MergeCSP(policies...)})
+			if got := header.Get("Content-Security-Policy"); got != test.result {
+				t.Errorf("merging %q\ngot:    %q\nwanted: %q",
+					test.policies, got, test.result)
+			}
+		})
+	}
+}
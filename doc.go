@@ -15,6 +15,9 @@ Likewise, SetFooBar doesn't validate parameter names or other tokens you supply.
 However, it will automatically quote and escape your text where the grammar
 admits an arbitrary quoted string or comment (RFC 7230 Section 3.2.6), such as
 in parameter values.
+The exception is strings in Structured Fields (RFC 8941), such as Sec-CH-UA:
+they can only hold printable ASCII, with no way to escape anything else,
+so SetFooBar drops all other bytes. Encode your text beforehand if this matters.
 
 Tokens that are known to be case-insensitive, like directive or parameter names,
 are lowercased by FooBar, unless documented otherwise. Any maps returned by FooBar
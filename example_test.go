@@ -24,7 +24,7 @@ Forwarded: for="198.51.100.30:14852";by="[2001:db8::ae:56]";proto=https
 	fmt.Println("received request from user at", forwarded[0].For.IP)
 
 	for _, product := range httpheader.UserAgent(r.Header) {
-		if product.Name == "MyApp" && product.Version < "2.0" {
+		if product.Name == "MyApp" && httpheader.Version(product.Version).Compare("2.0") < 0 {
 			fmt.Println("enabling compatibility mode for", product)
 		}
 	}
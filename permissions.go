@@ -0,0 +1,237 @@
+package httpheader
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// An Allowlist specifies the origins in which a policy-controlled feature
+// is enabled (W3C Permissions Policy, Section 4.5).
+//
+// All corresponds to *, which matches every origin. Self matches the origin
+// of the document that received the policy. Src is only meaningful in the
+// allow attribute of an iframe, where it matches the origin of the iframe's
+// src URL. Origins are serialized like "https://example.com", with default
+// ports omitted. An empty Allowlist disables the feature everywhere.
+type Allowlist struct {
+	All     bool
+	Self    bool
+	Src     bool
+	Origins []string
+}
+
+// PermissionsPolicy parses the Permissions-Policy header from h
+// (W3C Permissions Policy, Section 5.2), which maps feature names to their
+// allowlists. The header is a Structured Fields Dictionary (RFC 8941);
+// if it is invalid, the entire header is ignored and nil is returned.
+// Invalid allowlist members, such as strings that are not valid origins,
+// are skipped. Parameters, such as report-to, are ignored.
+func PermissionsPolicy(h http.Header) map[string]Allowlist {
+	values := h["Permissions-Policy"]
+	if values == nil {
+		return nil
+	}
+	dict, ok := parseSFDictionary(values)
+	if !ok || len(dict) == 0 {
+		return nil
+	}
+	policy := make(map[string]Allowlist, len(dict))
+	for _, member := range dict {
+		items, ok := member.value.([]sfItem)
+		if !ok {
+			items = []sfItem{member.sfItem}
+		}
+		var allowlist Allowlist
+		for _, item := range items {
+			switch value := item.value.(type) {
+			case sfToken:
+				switch value {
+				case "*":
+					allowlist.All = true
+				case "self":
+					allowlist.Self = true
+				case "src":
+					allowlist.Src = true
+				}
+			case string:
+				if origin, ok := serializeOrigin(value); ok {
+					allowlist.Origins = append(allowlist.Origins, origin)
+				}
+			}
+		}
+		policy[member.key] = allowlist
+	}
+	return policy
+}
+
+// SetPermissionsPolicy replaces the Permissions-Policy header in h
+// (W3C Permissions Policy, Section 5.2). Features are serialized in sorted
+// order. Feature names must be lowercase, as required by Structured Fields.
+func SetPermissionsPolicy(h http.Header, policy map[string]Allowlist) {
+	if len(policy) == 0 {
+		h.Del("Permissions-Policy")
+		return
+	}
+	features := make([]string, 0, len(policy))
+	for feature := range policy {
+		features = append(features, feature)
+	}
+	sort.Strings(features)
+	dict := make([]sfMember, 0, len(policy))
+	for _, feature := range features {
+		allowlist := policy[feature]
+		member := sfMember{key: feature}
+		if allowlist.All {
+			member.value = sfToken("*")
+		} else {
+			items := make([]sfItem, 0, len(allowlist.Origins)+2)
+			if allowlist.Self {
+				items = append(items, sfItem{value: sfToken("self")})
+			}
+			if allowlist.Src {
+				items = append(items, sfItem{value: sfToken("src")})
+			}
+			for _, origin := range allowlist.Origins {
+				items = append(items, sfItem{value: origin})
+			}
+			member.value = items
+		}
+		dict = append(dict, member)
+	}
+	b := &strings.Builder{}
+	writeSFDictionary(b, dict)
+	h.Set("Permissions-Policy", b.String())
+}
+
+// FeaturePolicy parses the legacy Feature-Policy header from h, which has
+// been superseded by Permissions-Policy, into the same form as
+// PermissionsPolicy. This is useful for converting a policy to the new
+// syntax with SetPermissionsPolicy.
+//
+// In Feature-Policy, keywords are quoted: 'self', 'src', 'none', and
+// the directive for a feature is like:
+//
+//	geolocation 'self' https://example.com
+//
+// If a feature appears more than once, only the first occurrence is kept.
+func FeaturePolicy(h http.Header) map[string]Allowlist {
+	values := h["Feature-Policy"]
+	if values == nil {
+		return nil
+	}
+	var policy map[string]Allowlist
+	for _, v := range values {
+		for _, serialized := range strings.Split(v, ",") {
+			for _, directive := range strings.Split(serialized, ";") {
+				fields := strings.Fields(directive)
+				if len(fields) == 0 {
+					continue
+				}
+				feature := strings.ToLower(fields[0])
+				if _, seen := policy[feature]; seen {
+					continue
+				}
+				var allowlist Allowlist
+				for _, field := range fields[1:] {
+					switch strings.ToLower(field) {
+					case "*":
+						allowlist.All = true
+					case "'self'":
+						allowlist.Self = true
+					case "'src'":
+						allowlist.Src = true
+					case "'none'":
+					default:
+						if origin, ok := serializeOrigin(field); ok {
+							allowlist.Origins = append(allowlist.Origins, origin)
+						}
+					}
+				}
+				if policy == nil {
+					policy = make(map[string]Allowlist)
+				}
+				policy[feature] = allowlist
+			}
+		}
+	}
+	return policy
+}
+
+// serializeOrigin returns the ASCII serialization of the origin of the URL s,
+// like "https://example.com:8443".
+func serializeOrigin(s string) (string, bool) {
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" || u.Host == "" || u.Opaque != "" {
+		return "", false
+	}
+	host := strings.ToLower(u.Hostname())
+	if port := u.Port(); port != "" && port != defaultPort(u.Scheme) {
+		host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	return strings.ToLower(u.Scheme) + "://" + host, true
+}
+
+// sameOrigin reports whether URLs a and b have the same origin.
+func sameOrigin(a, b string) bool {
+	oa, okA := serializeOrigin(a)
+	ob, okB := serializeOrigin(b)
+	return okA && okB && oa == ob
+}
+
+// Allows reports whether allowlist matches origin (W3C Permissions Policy,
+// Section 9.5). self is the origin of the document that declared the policy,
+// and src is the origin of the iframe's src URL when allowlist comes from
+// an allow attribute (empty otherwise). Any of them may be given as a full
+// URL instead of an origin.
+func (allowlist Allowlist) Allows(origin, self, src string) bool {
+	if allowlist.All {
+		return true
+	}
+	if allowlist.Self && sameOrigin(origin, self) {
+		return true
+	}
+	if allowlist.Src && sameOrigin(origin, src) {
+		return true
+	}
+	for _, allowed := range allowlist.Origins {
+		if sameOrigin(origin, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultAllowAll lists the features whose default allowlist is *
+// rather than 'self' (W3C Permissions Policy, Section 4.3, as specified
+// by each feature).
+var defaultAllowAll = map[string]bool{
+	"browsing-topics":       true,
+	"ch-ua":                 true,
+	"ch-ua-mobile":          true,
+	"ch-ua-platform":        true,
+	"document-domain":       true,
+	"shared-storage":        true,
+	"sync-xhr":              true,
+	"attribution-reporting": true,
+}
+
+// FeatureAllowed reports whether policy, such as returned by PermissionsPolicy,
+// allows feature in a document or frame with the given origin, where self
+// is the origin of the document that received the policy. If the policy
+// doesn't mention feature, the feature's default allowlist applies, which is
+// * for a few features (such as sync-xhr) and 'self' for the rest.
+//
+// This checks only the policy declared in the header. A browser also considers
+// the policy inherited from the parent document and the iframe's allow
+// attribute, which are beyond the scope of HTTP headers.
+func FeatureAllowed(policy map[string]Allowlist, feature, origin, self string) bool {
+	if allowlist, ok := policy[feature]; ok {
+		return allowlist.Allows(origin, self, "")
+	}
+	return defaultAllowAll[feature] || sameOrigin(origin, self)
+}
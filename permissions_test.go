@@ -0,0 +1,198 @@
+package httpheader
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+)
+
+func ExampleFeaturePolicy() {
+	header := http.Header{"Feature-Policy": {
+		"geolocation 'self' https://maps.example.com; camera 'none'",
+	}}
+	policy := FeaturePolicy(header)
+	header.Del("Feature-Policy")
+	SetPermissionsPolicy(header, policy)
+	header.Write(os.Stdout)
+	// Output: Permissions-Policy: camera=(), geolocation=(self "https://maps.example.com")
+}
+
+func ExampleFeatureAllowed() {
+	header := http.Header{"Permissions-Policy": {`geolocation=(self "https://maps.example.com")`}}
+	policy := PermissionsPolicy(header)
+	self := "https://www.example.com"
+	fmt.Println(FeatureAllowed(policy, "geolocation", "https://maps.example.com", self))
+	fmt.Println(FeatureAllowed(policy, "geolocation", "https://ads.example.net", self))
+	fmt.Println(FeatureAllowed(policy, "camera", "https://www.example.com", self))
+	// Output: true
+	// false
+	// true
+}
+
+func TestPermissionsPolicy(t *testing.T) {
+	tests := []struct {
+		header http.Header
+		result map[string]Allowlist
+	}{
+		// Valid headers.
+		{
+			http.Header{"Permissions-Policy": {"geolocation=()"}},
+			map[string]Allowlist{"geolocation": {}},
+		},
+		{
+			http.Header{"Permissions-Policy": {
+				`fullscreen=*, camera=self, microphone=(self "https://a.example.com:443/path" "HTTPS://B.example.com:8443")`,
+				`payment=(src);report-to=main`,
+			}},
+			map[string]Allowlist{
+				"fullscreen": {All: true},
+				"camera":     {Self: true},
+				"microphone": {
+					Self:    true,
+					Origins: []string{"https://a.example.com", "https://b.example.com:8443"},
+				},
+				"payment": {Src: true},
+			},
+		},
+		{
+			http.Header{"Permissions-Policy": {"usb=*, usb=()"}},
+			map[string]Allowlist{"usb": {}},
+		},
+		{
+			http.Header{"Permissions-Policy": {`camera=("https://[::1]:8443" "http://[2001:DB8::1]:80/")`}},
+			map[string]Allowlist{
+				"camera": {Origins: []string{"https://[::1]:8443", "http://[2001:db8::1]"}},
+			},
+		},
+
+		// Invalid headers.
+		// Precise outputs on them are not a guaranteed part of the API.
+		// They may change as convenient for the parsing code.
+		{
+			http.Header{"Permissions-Policy": {"geolocation=(self), Camera=()"}},
+			nil,
+		},
+		{
+			http.Header{"Permissions-Policy": {`camera=("not an origin" 42 none), midi`}},
+			map[string]Allowlist{"camera": {}, "midi": {}},
+		},
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			checkParse(t, test.header, test.result, PermissionsPolicy(test.header))
+		})
+	}
+}
+
+func TestSetPermissionsPolicy(t *testing.T) {
+	tests := []struct {
+		input  map[string]Allowlist
+		result http.Header
+	}{
+		{
+			nil,
+			http.Header{},
+		},
+		{
+			map[string]Allowlist{
+				"geolocation": {},
+				"fullscreen":  {All: true, Self: true},
+				"payment":     {Self: true, Src: true, Origins: []string{"https://pay.example"}},
+			},
+			http.Header{"Permissions-Policy": {
+				`fullscreen=*, geolocation=(), payment=(self src "https://pay.example")`,
+			}},
+		},
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			header := http.Header{}
+			SetPermissionsPolicy(header, test.input)
+			checkGenerate(t, test.input, test.result, header)
+		})
+	}
+}
+
+func TestFeaturePolicy(t *testing.T) {
+	tests := []struct {
+		header http.Header
+		result map[string]Allowlist
+	}{
+		// Valid headers.
+		{
+			http.Header{"Feature-Policy": {"fullscreen *; Camera 'SELF' 'src'"}},
+			map[string]Allowlist{
+				"fullscreen": {All: true},
+				"camera":     {Self: true, Src: true},
+			},
+		},
+		{
+			http.Header{"Feature-Policy": {
+				"geolocation 'none'",
+				"geolocation *; payment https://pay.example:443 https://pay.example:8443",
+			}},
+			map[string]Allowlist{
+				"geolocation": {},
+				"payment": {Origins: []string{
+					"https://pay.example", "https://pay.example:8443",
+				}},
+			},
+		},
+
+		// Invalid headers.
+		// Precise outputs on them are not a guaranteed part of the API.
+		// They may change as convenient for the parsing code.
+		{
+			http.Header{"Feature-Policy": {";; , usb self example.com"}},
+			map[string]Allowlist{"usb": {}},
+		},
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			checkParse(t, test.header, test.result, FeaturePolicy(test.header))
+		})
+	}
+}
+
+func TestFeatureAllowed(t *testing.T) {
+	policy := map[string]Allowlist{
+		"camera":      {},
+		"fullscreen":  {All: true},
+		"geolocation": {Self: true, Origins: []string{"https://maps.example"}},
+		"payment":     {Src: true},
+		"usb":         {Origins: []string{"https://[::1]:8443"}},
+	}
+	self := "https://www.example.com"
+	tests := []struct {
+		feature string
+		origin  string
+		result  bool
+	}{
+		{"camera", self, false},
+		{"fullscreen", "https://other.example", true},
+		{"geolocation", "https://www.example.com/page", true},
+		{"geolocation", "http://www.example.com", false},
+		{"geolocation", "https://www.example.com:8443", false},
+		{"geolocation", "https://maps.example:443", true},
+		{"geolocation", "https://other.example", false},
+		{"payment", self, false},
+		{"microphone", self, true},
+		{"microphone", "https://other.example", false},
+		{"sync-xhr", "https://other.example", true},
+		{"usb", "https://[::1]:8443/device", true},
+		{"usb", "https://[::1:8443]", false},
+		{"usb", "https://[::1]", false},
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			if got := FeatureAllowed(policy, test.feature, test.origin, self); got != test.result {
+				t.Errorf("%s for %s: got %v, wanted %v", test.feature, test.origin, got, test.result)
+			}
+		})
+	}
+	allowlist := Allowlist{Src: true}
+	if !allowlist.Allows("https://frame.example", self, "https://frame.example/embed") {
+		t.Errorf("src did not match the iframe's origin")
+	}
+}
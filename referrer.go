@@ -0,0 +1,149 @@
+package httpheader
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ReferrerPolicy parses the Referrer-Policy header from h (W3C Referrer Policy,
+// Section 4.1). The header may list several policies, so that browsers that
+// don't support newer ones fall back to older ones; the last recognized policy
+// wins. The result is lowercase, or an empty string if there is no recognized
+// policy, in which case the default strict-origin-when-cross-origin applies.
+func ReferrerPolicy(h http.Header) string {
+	var policy string
+	for v, vs := iterElems("", h["Referrer-Policy"]); v != ""; v, vs = iterElems(v, vs) {
+		var token string
+		token, v = consumeItem(v)
+		token = strings.ToLower(token)
+		if isReferrerPolicy(token) {
+			policy = token
+		}
+	}
+	return policy
+}
+
+// SetReferrerPolicy replaces the Referrer-Policy header in h
+// (W3C Referrer Policy, Section 4.1). To send fallbacks for older browsers,
+// list several policies, the preferred one last.
+func SetReferrerPolicy(h http.Header, policies ...string) {
+	if len(policies) == 0 {
+		h.Del("Referrer-Policy")
+		return
+	}
+	h.Set("Referrer-Policy", strings.Join(policies, ", "))
+}
+
+func isReferrerPolicy(s string) bool {
+	switch s {
+	case "no-referrer", "no-referrer-when-downgrade", "same-origin", "origin",
+		"strict-origin", "origin-when-cross-origin", "strict-origin-when-cross-origin",
+		"unsafe-url":
+		return true
+	}
+	return false
+}
+
+// RefererFor computes the value of the Referer header for a request to target
+// initiated from the document at referrer under the given policy, following
+// W3C Referrer Policy, Section 8.3. An empty policy means the default,
+// strict-origin-when-cross-origin. An empty result means that Referer must not
+// be sent.
+//
+// Credentials and fragments are always stripped from referrer. Depending
+// on the policy, so are its path and query, leaving only the origin;
+// and nothing is sent when downgrading from a potentially trustworthy URL
+// (such as https:) to one that is not (such as http:).
+func RefererFor(referrer, target *url.URL, policy string) string {
+	full := stripReferrer(referrer, false)
+	if full == "" {
+		return ""
+	}
+	origin := stripReferrer(referrer, true)
+	if len(full) > 4096 {
+		full = origin
+	}
+	downgrade := isTrustworthy(referrer) && !isTrustworthy(target)
+	same := sameOrigin(referrer.String(), target.String())
+	switch strings.ToLower(policy) {
+	case "no-referrer":
+		return ""
+	case "origin":
+		return origin
+	case "unsafe-url":
+		return full
+	case "strict-origin":
+		if downgrade {
+			return ""
+		}
+		return origin
+	case "same-origin":
+		if same {
+			return full
+		}
+		return ""
+	case "origin-when-cross-origin":
+		if same {
+			return full
+		}
+		return origin
+	case "no-referrer-when-downgrade":
+		if downgrade {
+			return ""
+		}
+		return full
+	}
+	// strict-origin-when-cross-origin, which is also the default.
+	switch {
+	case same:
+		return full
+	case downgrade:
+		return ""
+	}
+	return origin
+}
+
+// stripReferrer implements W3C Referrer Policy, Section 8.4.
+func stripReferrer(u *url.URL, originOnly bool) string {
+	switch strings.ToLower(u.Scheme) {
+	case "", "about", "blob", "data":
+		return ""
+	}
+	stripped := *u
+	stripped.Scheme = strings.ToLower(u.Scheme)
+	stripped.User = nil
+	stripped.Fragment = ""
+	if u.Host != "" {
+		stripped.Host = strings.ToLower(u.Hostname())
+		if port := u.Port(); port != "" && port != defaultPort(u.Scheme) {
+			stripped.Host = net.JoinHostPort(stripped.Host, port)
+		} else if strings.Contains(stripped.Host, ":") {
+			stripped.Host = "[" + stripped.Host + "]"
+		}
+	}
+	if originOnly {
+		stripped.Opaque = ""
+		stripped.Path, stripped.RawPath = "/", ""
+		stripped.RawQuery, stripped.ForceQuery = "", false
+	} else if stripped.Opaque == "" && stripped.Path == "" {
+		stripped.Path = "/"
+	}
+	return stripped.String()
+}
+
+// isTrustworthy reports whether u is a potentially trustworthy URL
+// (W3C Secure Contexts, Section 3.1).
+func isTrustworthy(u *url.URL) bool {
+	switch strings.ToLower(u.Scheme) {
+	case "https", "wss", "file":
+		return true
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
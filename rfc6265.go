@@ -0,0 +1,531 @@
+package httpheader
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Cookie represents an HTTP cookie as sent in the Set-Cookie header,
+// or just its Name and Value as sent in the Cookie header (RFC 6265 and
+// draft-ietf-httpbis-rfc6265bis, referred to here as RFC 6265bis).
+//
+// Expires is zero if absent. Domain is lowercased and stripped of any leading
+// dot; empty means a host-only cookie. Path is empty if absent or invalid,
+// meaning the default path. SameSite is "strict", "lax", "none", or empty
+// if absent or unrecognized (meaning the browser's default enforcement).
+// Priority is "low", "medium", "high" (a Chrome extension), or empty.
+type Cookie struct {
+	Name        string
+	Value       string
+	Expires     time.Time
+	MaxAge      Delta
+	Domain      string
+	Path        string
+	Secure      bool
+	HTTPOnly    bool
+	SameSite    string
+	Partitioned bool // CHIPS, draft-cutler-httpbis-partitioned-cookies
+	Priority    string
+}
+
+// SetCookieHeaders parses all Set-Cookie headers from h, using the lenient
+// algorithm that browsers apply (RFC 6265bis Section 5.6). Like a browser,
+// it skips cookies that are malformed beyond repair or too large,
+// and cookies violating the rules for the __Secure- and __Host- name prefixes
+// (RFC 6265bis Section 4.1.3). Unknown attributes are ignored.
+// If an attribute occurs more than once, the last occurrence wins.
+//
+// Set-Cookie is an exception to the usual rules of header syntax: it may not
+// be combined into a comma-separated list, because its Expires attribute
+// contains a comma. Each line of Set-Cookie is a separate cookie.
+func SetCookieHeaders(h http.Header) []Cookie {
+	values := h["Set-Cookie"]
+	if values == nil {
+		return nil
+	}
+	cookies := make([]Cookie, 0, len(values))
+	for _, v := range values {
+		if cookie, ok := parseSetCookie(v); ok {
+			cookies = append(cookies, cookie)
+		}
+	}
+	return cookies
+}
+
+func parseSetCookie(v string) (Cookie, bool) {
+	var cookie Cookie
+	for i := 0; i < len(v); i++ {
+		if v[i] < 0x20 && v[i] != '\t' || v[i] == 0x7F {
+			return cookie, false
+		}
+	}
+	var pair string
+	pair, v = consumeTo(v, ';', false)
+	cookie.Name, cookie.Value = splitCookiePair(pair)
+	if cookie.Name == "" && cookie.Value == "" {
+		return cookie, false
+	}
+	if len(cookie.Name)+len(cookie.Value) > 4096 {
+		return cookie, false
+	}
+	if cookie.Name == "" && (hasPrefixFold(cookie.Value, "__Secure-") ||
+		hasPrefixFold(cookie.Value, "__Host-")) {
+		// Would be serialized to a Cookie header indistinguishable
+		// from a prefixed cookie.
+		return cookie, false
+	}
+
+	for v != "" {
+		var av, name, value string
+		av, v = consumeTo(v, ';', false)
+		name, value = consumeTo(av, '=', false)
+		name = strings.ToLower(trimWSP(name))
+		value = trimWSP(value)
+		if len(value) > 1024 {
+			continue
+		}
+		switch name {
+		case "expires":
+			if expires, ok := parseCookieDate(value); ok {
+				cookie.Expires = expires
+			}
+		case "max-age":
+			if seconds, ok := parseMaxAge(value); ok {
+				cookie.MaxAge = DeltaSeconds(seconds)
+			}
+		case "domain":
+			if value != "" {
+				cookie.Domain = strings.ToLower(strings.TrimPrefix(value, "."))
+			}
+		case "path":
+			if peek(value) == '/' {
+				cookie.Path = value
+			} else {
+				cookie.Path = ""
+			}
+		case "secure":
+			cookie.Secure = true
+		case "httponly":
+			cookie.HTTPOnly = true
+		case "partitioned":
+			cookie.Partitioned = true
+		case "samesite":
+			switch value = strings.ToLower(value); value {
+			case "strict", "lax", "none":
+				cookie.SameSite = value
+			default:
+				cookie.SameSite = ""
+			}
+		case "priority":
+			switch value = strings.ToLower(value); value {
+			case "low", "medium", "high":
+				cookie.Priority = value
+			default:
+				cookie.Priority = ""
+			}
+		}
+	}
+
+	if checkCookiePrefix(cookie) != nil {
+		return cookie, false
+	}
+	return cookie, true
+}
+
+// splitCookiePair splits a cookie-pair like the browsers do: a pair without
+// an equal sign is a cookie with an empty name.
+func splitCookiePair(pair string) (name, value string) {
+	if strings.IndexByte(pair, '=') == -1 {
+		return "", trimWSP(pair)
+	}
+	name, value = consumeTo(pair, '=', false)
+	return trimWSP(name), trimWSP(value)
+}
+
+func trimWSP(s string) string {
+	return strings.Trim(s, " \t")
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+func parseMaxAge(v string) (seconds int, ok bool) {
+	// RFC 6265bis Section 5.6.2: "If the first character of the attribute-value
+	// is neither a DIGIT, nor a "-" character followed by a DIGIT, ignore
+	// the cookie-av. If the remainder of attribute-value contains a non-DIGIT
+	// character, ignore the cookie-av."
+	digits := strings.TrimPrefix(v, "-")
+	if digits == "" {
+		return 0, false
+	}
+	for i := 0; i < len(digits); i++ {
+		if digits[i] < '0' || '9' < digits[i] {
+			return 0, false
+		}
+	}
+	seconds, err := strconv.Atoi(v)
+	if err != nil {
+		// Too many digits for an int. The sign is what matters.
+		if v[0] == '-' {
+			return -1, true
+		}
+		return maxInt, true
+	}
+	return seconds, true
+}
+
+// parseCookieDate implements the cookie-date algorithm
+// from RFC 6265bis Section 5.1.1.
+func parseCookieDate(v string) (time.Time, bool) {
+	var (
+		foundTime, foundDay, foundMonth, foundYear bool
+
+		hour, minute, second, day, year int
+		month                           time.Month
+	)
+	for v != "" {
+		var token string
+		token, v = consumeDateToken(v)
+		switch {
+		case !foundTime && parseCookieTime(token, &hour, &minute, &second):
+			foundTime = true
+		case !foundDay && parseDigits(token, 1, 2, &day):
+			foundDay = true
+		case !foundMonth && parseCookieMonth(token, &month):
+			foundMonth = true
+		case !foundYear && parseDigits(token, 2, 4, &year):
+			foundYear = true
+		}
+	}
+	switch {
+	case 70 <= year && year <= 99:
+		year += 1900
+	case 0 <= year && year <= 69:
+		year += 2000
+	}
+	if !foundTime || !foundDay || !foundMonth || !foundYear ||
+		day < 1 || day > 31 || year < 1601 ||
+		hour > 23 || minute > 59 || second > 59 {
+		return time.Time{}, false
+	}
+	t := time.Date(year, month, day, hour, minute, second, 0, time.UTC)
+	if t.Day() != day {
+		// Nonexistent date, like February 30.
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// consumeDateToken skips any delimiters at the beginning of v and returns
+// the following run of non-delimiters.
+func consumeDateToken(v string) (token, newv string) {
+	i := 0
+	for i < len(v) && isDateDelimiter(v[i]) {
+		i++
+	}
+	v = v[i:]
+	i = 0
+	for i < len(v) && !isDateDelimiter(v[i]) {
+		i++
+	}
+	return v[:i], v[i:]
+}
+
+func isDateDelimiter(b byte) bool {
+	return b == 0x09 || 0x20 <= b && b <= 0x2F || 0x3B <= b && b <= 0x40 ||
+		0x5B <= b && b <= 0x60 || 0x7B <= b && b <= 0x7E
+}
+
+// parseDigits parses between minDigits and maxDigits digits at the beginning
+// of token into *n, if they are followed by the end of token or a non-digit.
+func parseDigits(token string, minDigits, maxDigits int, n *int) bool {
+	i := 0
+	value := 0
+	for i < len(token) && i <= maxDigits && '0' <= token[i] && token[i] <= '9' {
+		value = value*10 + int(token[i]-'0')
+		i++
+	}
+	if i < minDigits || i > maxDigits {
+		return false
+	}
+	*n = value
+	return true
+}
+
+func parseCookieTime(token string, hour, minute, second *int) bool {
+	var h, m string
+	h, token = consumeTo(token, ':', false)
+	m, token = consumeTo(token, ':', false)
+	var hh, mm, ss int
+	if !isTimeField(h) || !isTimeField(m) ||
+		!parseDigits(h, 1, 2, &hh) || !parseDigits(m, 1, 2, &mm) ||
+		!parseDigits(token, 1, 2, &ss) {
+		return false
+	}
+	*hour, *minute, *second = hh, mm, ss
+	return true
+}
+
+func isTimeField(s string) bool {
+	if len(s) < 1 || len(s) > 2 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || '9' < s[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func parseCookieMonth(token string, month *time.Month) bool {
+	if len(token) < 3 {
+		return false
+	}
+	switch strings.ToLower(token[:3]) {
+	case "jan":
+		*month = time.January
+	case "feb":
+		*month = time.February
+	case "mar":
+		*month = time.March
+	case "apr":
+		*month = time.April
+	case "may":
+		*month = time.May
+	case "jun":
+		*month = time.June
+	case "jul":
+		*month = time.July
+	case "aug":
+		*month = time.August
+	case "sep":
+		*month = time.September
+	case "oct":
+		*month = time.October
+	case "nov":
+		*month = time.November
+	case "dec":
+		*month = time.December
+	default:
+		return false
+	}
+	return true
+}
+
+// Expiry returns the time when cookie, received at now, expires, and true;
+// or a zero Time and false if cookie is a session cookie (RFC 6265bis
+// Section 5.7). MaxAge takes precedence over Expires. If MaxAge is 0 or
+// negative, the cookie has already expired, and Expiry returns a zero Time
+// and true. As required by RFC 6265bis, Expiry is never more than 400 days
+// after now.
+func (cookie Cookie) Expiry(now time.Time) (expiry time.Time, persistent bool) {
+	switch {
+	case cookie.MaxAge.ok && cookie.MaxAge.seconds <= 0:
+		return time.Time{}, true
+	case cookie.MaxAge.ok:
+		if cookie.MaxAge.seconds > maxCookieAge {
+			expiry = now.Add(maxCookieAge * time.Second)
+		} else {
+			expiry = now.Add(time.Duration(cookie.MaxAge.seconds) * time.Second)
+		}
+	case !cookie.Expires.IsZero():
+		expiry = cookie.Expires
+	default:
+		return time.Time{}, false
+	}
+	if limit := now.Add(maxCookieAge * time.Second); expiry.After(limit) {
+		expiry = limit
+	}
+	return expiry, true
+}
+
+const maxCookieAge = 400 * 24 * 60 * 60
+
+// AddSetCookie appends a Set-Cookie header with cookie to h
+// (RFC 6265bis Section 4.1). Unlike most functions in this package,
+// it validates its input, and returns an error without touching h if:
+// Name is not a token (RFC 7230 Section 3.2.6); Value contains characters
+// not allowed in a cookie-value (it may, however, be enclosed in double quotes);
+// the cookie violates the rules for the __Secure- and __Host- name prefixes
+// (RFC 6265bis Section 4.1.3); or it has SameSite "none" or Partitioned
+// without Secure, which browsers reject.
+//
+// Expires is serialized only if non-zero, and MaxAge only if present.
+// A MaxAge of 0 or less is serialized as Max-Age=0.
+func AddSetCookie(h http.Header, cookie Cookie) error {
+	if err := checkCookie(cookie); err != nil {
+		return err
+	}
+	b := &strings.Builder{}
+	write(b, cookie.Name, "=", cookie.Value)
+	if !cookie.Expires.IsZero() {
+		write(b, "; Expires=", cookie.Expires.UTC().Format(http.TimeFormat))
+	}
+	if cookie.MaxAge.ok {
+		seconds := cookie.MaxAge.seconds
+		if seconds < 0 {
+			seconds = 0
+		}
+		write(b, "; Max-Age=", strconv.Itoa(seconds))
+	}
+	if cookie.Domain != "" {
+		write(b, "; Domain=", cookie.Domain)
+	}
+	if cookie.Path != "" {
+		write(b, "; Path=", cookie.Path)
+	}
+	if cookie.Secure {
+		write(b, "; Secure")
+	}
+	if cookie.HTTPOnly {
+		write(b, "; HttpOnly")
+	}
+	switch cookie.SameSite {
+	case "strict":
+		write(b, "; SameSite=Strict")
+	case "lax":
+		write(b, "; SameSite=Lax")
+	case "none":
+		write(b, "; SameSite=None")
+	}
+	if cookie.Partitioned {
+		write(b, "; Partitioned")
+	}
+	switch cookie.Priority {
+	case "low":
+		write(b, "; Priority=Low")
+	case "medium":
+		write(b, "; Priority=Medium")
+	case "high":
+		write(b, "; Priority=High")
+	}
+	h.Add("Set-Cookie", b.String())
+	return nil
+}
+
+func checkCookie(cookie Cookie) error {
+	if !isToken(cookie.Name) {
+		return fmt.Errorf("httpheader: cookie name %q is not a token", cookie.Name)
+	}
+	if !isCookieValue(cookie.Value) {
+		return fmt.Errorf("httpheader: invalid character in value of cookie %q",
+			cookie.Name)
+	}
+	for _, attr := range []string{cookie.Domain, cookie.Path} {
+		if strings.IndexByte(attr, ';') != -1 || !isCookieAttrValue(attr) {
+			return fmt.Errorf("httpheader: invalid attribute %q of cookie %q",
+				attr, cookie.Name)
+		}
+	}
+	if err := checkCookiePrefix(cookie); err != nil {
+		return err
+	}
+	if cookie.SameSite == "none" && !cookie.Secure {
+		return errors.New("httpheader: cookie with SameSite=None must be Secure")
+	}
+	if cookie.Partitioned && !cookie.Secure {
+		return errors.New("httpheader: Partitioned cookie must be Secure")
+	}
+	return nil
+}
+
+func checkCookiePrefix(cookie Cookie) error {
+	switch {
+	case hasPrefixFold(cookie.Name, "__Secure-"):
+		if !cookie.Secure {
+			return errors.New("httpheader: __Secure- cookie must be Secure")
+		}
+	case hasPrefixFold(cookie.Name, "__Host-"):
+		if !cookie.Secure {
+			return errors.New("httpheader: __Host- cookie must be Secure")
+		}
+		if cookie.Domain != "" {
+			return errors.New("httpheader: __Host- cookie must not have Domain")
+		}
+		if cookie.Path != "/" {
+			return errors.New(`httpheader: __Host- cookie must have Path "/"`)
+		}
+	}
+	return nil
+}
+
+// isCookieValue checks that s is a cookie-value (RFC 6265 Section 4.1.1).
+func isCookieValue(s string) bool {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		s = s[1 : len(s)-1]
+	}
+	for i := 0; i < len(s); i++ {
+		// cookie-octet is any token or quoted-string character
+		// except whitespace, DQUOTE, comma, semicolon, and backslash.
+		switch {
+		case byteClass[s[i]] == cTokenOK:
+		case byteClass[s[i]] == cQuotedSafe && s[i] != ' ' && s[i] != '\\':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func isCookieAttrValue(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if byteClass[s[i]] == cUnsafe {
+			return false
+		}
+	}
+	return true
+}
+
+// Cookies parses the Cookie header from h (RFC 6265bis Section 5.8),
+// returning cookies with only Name and Value set. Like in Set-Cookie,
+// a cookie-pair without an equal sign has an empty Name. Any double quotes
+// around Value are preserved, because browsers treat them as part of the value.
+func Cookies(h http.Header) []Cookie {
+	values := h["Cookie"]
+	if values == nil {
+		return nil
+	}
+	var cookies []Cookie
+	for _, v := range values {
+		for v != "" {
+			var pair string
+			var cookie Cookie
+			pair, v = consumeTo(v, ';', false)
+			cookie.Name, cookie.Value = splitCookiePair(pair)
+			if cookie.Name == "" && cookie.Value == "" {
+				continue
+			}
+			cookies = append(cookies, cookie)
+		}
+	}
+	return cookies
+}
+
+// SetCookies replaces the Cookie header in h (RFC 6265bis Section 4.2),
+// serializing Name and Value of each cookie. Other fields are ignored.
+// It returns an error if any Name or Value is invalid (see AddSetCookie),
+// in which case h is not changed.
+func SetCookies(h http.Header, cookies []Cookie) error {
+	if len(cookies) == 0 {
+		h.Del("Cookie")
+		return nil
+	}
+	b := &strings.Builder{}
+	for i, cookie := range cookies {
+		if !isToken(cookie.Name) || !isCookieValue(cookie.Value) {
+			return fmt.Errorf("httpheader: invalid cookie %q", cookie.Name)
+		}
+		if i > 0 {
+			write(b, "; ")
+		}
+		write(b, cookie.Name, "=", cookie.Value)
+	}
+	h.Set("Cookie", b.String())
+	return nil
+}
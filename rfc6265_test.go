@@ -0,0 +1,413 @@
+package httpheader
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func ExampleSetCookieHeaders() {
+	header := http.Header{"Set-Cookie": {
+		"sid=31d4d96e407aad42; Path=/; Secure; HttpOnly; SameSite=Lax",
+		"__Host-csrf=x9f2; Path=/app", // invalid, ignored
+	}}
+	for _, cookie := range SetCookieHeaders(header) {
+		fmt.Println(cookie.Name, cookie.SameSite)
+	}
+	// Output: sid lax
+}
+
+func TestSetCookieHeaders(t *testing.T) {
+	tests := []struct {
+		header http.Header
+		result []Cookie
+	}{
+		// Valid headers.
+		{
+			http.Header{"Set-Cookie": {"SID=31d4d96e407aad42"}},
+			[]Cookie{{Name: "SID", Value: "31d4d96e407aad42"}},
+		},
+		{
+			http.Header{"Set-Cookie": {
+				"SID=31d4d96e407aad42; Path=/; Domain=Example.COM",
+				"lang=en-US; Expires=Wed, 09 Jun 2021 10:18:14 GMT",
+				"sess=; Max-Age=3600; Secure; HttpOnly; SameSite=Strict",
+			}},
+			[]Cookie{
+				{
+					Name:   "SID",
+					Value:  "31d4d96e407aad42",
+					Path:   "/",
+					Domain: "example.com",
+				},
+				{
+					Name:    "lang",
+					Value:   "en-US",
+					Expires: time.Date(2021, time.June, 9, 10, 18, 14, 0, time.UTC),
+				},
+				{
+					Name:     "sess",
+					MaxAge:   DeltaSeconds(3600),
+					Secure:   true,
+					HTTPOnly: true,
+					SameSite: "strict",
+				},
+			},
+		},
+		{
+			http.Header{"Set-Cookie": {
+				`id="a3fWa"; Domain=.example.net; secure; samesite=none; PARTITIONED; Priority=HIGH`,
+			}},
+			[]Cookie{{
+				Name:        "id",
+				Value:       `"a3fWa"`,
+				Domain:      "example.net",
+				Secure:      true,
+				SameSite:    "none",
+				Partitioned: true,
+				Priority:    "high",
+			}},
+		},
+		{
+			http.Header{"Set-Cookie": {
+				"__Secure-id=1; Secure; Domain=example.com",
+				"__Host-id=2; Secure; Path=/",
+				"__host-id=3; Secure; Path=/",
+			}},
+			[]Cookie{
+				{Name: "__Secure-id", Value: "1", Secure: true, Domain: "example.com"},
+				{Name: "__Host-id", Value: "2", Secure: true, Path: "/"},
+				{Name: "__host-id", Value: "3", Secure: true, Path: "/"},
+			},
+		},
+
+		// Lenient parsing.
+		{
+			// Last occurrence of an attribute wins.
+			http.Header{"Set-Cookie": {
+				"a=b; Max-Age=10; Path=/foo; max-age=-5; path=bar; SameSite=Lax; SameSite=bogus",
+			}},
+			[]Cookie{{Name: "a", Value: "b", MaxAge: DeltaSeconds(-5)}},
+		},
+		{
+			http.Header{"Set-Cookie": {
+				"  a b = c d ; ; =; Max-Age=1e3; Max-Age=-; Domain=; Expires=never",
+			}},
+			[]Cookie{{Name: "a b", Value: "c d"}},
+		},
+		{
+			// No equal sign means empty name.
+			http.Header{"Set-Cookie": {"foobar; Secure"}},
+			[]Cookie{{Value: "foobar", Secure: true}},
+		},
+		{
+			http.Header{"Set-Cookie": {"a=b=c,d"}},
+			[]Cookie{{Name: "a", Value: "b=c,d"}},
+		},
+		{
+			http.Header{"Set-Cookie": {"a=b; Max-Age=99999999999999999999999"}},
+			[]Cookie{{Name: "a", Value: "b", MaxAge: DeltaSeconds(maxInt)}},
+		},
+		{
+			http.Header{"Set-Cookie": {
+				"a=1; Expires=Thu, 01-Jan-70 00:00:01 GMT",
+				"b=2; Expires=Sunday, 06-Nov-94 08:49:37 GMT",
+				"c=3; expires=Sun Nov  6 08:49:37 1994",
+				"d=4; Expires=2 jan 2030 1:2:3",
+				"e=5; Expires=Fri, 31 Feb 2023 10:00:00 GMT",
+				"f=6; Expires=Mon, 01 Jan 1600 00:00:00 GMT",
+				"g=7; Expires=Mon, 01 Jan 2024 24:00:00 GMT",
+				"h=8; Expires=Mon, 01 Jan 2024 10:00",
+			}},
+			[]Cookie{
+				{Name: "a", Value: "1", Expires: time.Date(1970, time.January, 1, 0, 0, 1, 0, time.UTC)},
+				{Name: "b", Value: "2", Expires: time.Date(1994, time.November, 6, 8, 49, 37, 0, time.UTC)},
+				{Name: "c", Value: "3", Expires: time.Date(1994, time.November, 6, 8, 49, 37, 0, time.UTC)},
+				{Name: "d", Value: "4", Expires: time.Date(2030, time.January, 2, 1, 2, 3, 0, time.UTC)},
+				{Name: "e", Value: "5"},
+				{Name: "f", Value: "6"},
+				{Name: "g", Value: "7"},
+				{Name: "h", Value: "8"},
+			},
+		},
+
+		// Ignored cookies.
+		{
+			http.Header{"Set-Cookie": {
+				"",
+				";Secure",
+				"a=b\x01c",
+				"__Secure-id=1",
+				"__Host-id=2; Secure",
+				"__Host-id=3; Secure; Path=/; Domain=example.com",
+				"__HOST-id=4; Path=/",
+				"=__Secure-id=5; Secure",
+				"__Host-id=6",
+				"big=" + strings.Repeat("x", 4096),
+			}},
+			[]Cookie{},
+		},
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			checkParse(t, test.header, test.result, SetCookieHeaders(test.header))
+		})
+	}
+}
+
+func ExampleCookie_Expiry() {
+	header := http.Header{"Set-Cookie": {
+		"sid=1; Max-Age=60; Expires=Wed, 09 Jun 2021 10:18:14 GMT",
+	}}
+	cookie := SetCookieHeaders(header)[0]
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	fmt.Println(cookie.Expiry(now))
+	// Output: 2020-01-01 00:01:00 +0000 UTC true
+}
+
+func TestCookieExpiry(t *testing.T) {
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	future := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		cookie     Cookie
+		expiry     time.Time
+		persistent bool
+	}{
+		{
+			Cookie{},
+			time.Time{},
+			false,
+		},
+		{
+			Cookie{Expires: now.Add(time.Hour)},
+			now.Add(time.Hour),
+			true,
+		},
+		{
+			Cookie{Expires: now.Add(time.Hour), MaxAge: DeltaSeconds(60)},
+			now.Add(time.Minute),
+			true,
+		},
+		{
+			Cookie{Expires: now.Add(time.Hour), MaxAge: DeltaSeconds(0)},
+			time.Time{},
+			true,
+		},
+		{
+			Cookie{MaxAge: DeltaSeconds(-1)},
+			time.Time{},
+			true,
+		},
+		{
+			Cookie{Expires: future},
+			now.Add(400 * 24 * time.Hour),
+			true,
+		},
+		{
+			Cookie{MaxAge: DeltaSeconds(maxInt)},
+			now.Add(400 * 24 * time.Hour),
+			true,
+		},
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			expiry, persistent := test.cookie.Expiry(now)
+			if !expiry.Equal(test.expiry) || persistent != test.persistent {
+				t.Errorf("expiry of %#v\nexpected: %v, %v\nactual:   %v, %v",
+					test.cookie, test.expiry, test.persistent, expiry, persistent)
+			}
+		})
+	}
+}
+
+func ExampleAddSetCookie() {
+	header := http.Header{}
+	err := AddSetCookie(header, Cookie{
+		Name:     "__Host-sid",
+		Value:    "31d4d96e407aad42",
+		Path:     "/",
+		Secure:   true,
+		HTTPOnly: true,
+		SameSite: "lax",
+	})
+	if err == nil {
+		header.Write(os.Stdout)
+	}
+	// Output: Set-Cookie: __Host-sid=31d4d96e407aad42; Path=/; Secure; HttpOnly; SameSite=Lax
+}
+
+func TestAddSetCookie(t *testing.T) {
+	tests := []struct {
+		input  Cookie
+		result http.Header
+	}{
+		{
+			Cookie{Name: "a", Value: ""},
+			http.Header{"Set-Cookie": {"a="}},
+		},
+		{
+			Cookie{
+				Name:        "id",
+				Value:       `"a3fWa"`,
+				Expires:     time.Date(2021, time.June, 9, 10, 18, 14, 0, time.FixedZone("X", 3600)),
+				MaxAge:      DeltaSeconds(-1),
+				Domain:      "example.com",
+				Path:        "/docs",
+				Secure:      true,
+				SameSite:    "none",
+				Partitioned: true,
+				Priority:    "medium",
+			},
+			http.Header{"Set-Cookie": {`id="a3fWa"; Expires=Wed, 09 Jun 2021 09:18:14 GMT; Max-Age=0; Domain=example.com; Path=/docs; Secure; SameSite=None; Partitioned; Priority=Medium`}},
+		},
+		{
+			Cookie{Name: "a", Value: "b", MaxAge: DeltaSeconds(0), SameSite: "strict"},
+			http.Header{"Set-Cookie": {"a=b; Max-Age=0; SameSite=Strict"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			header := http.Header{}
+			if err := AddSetCookie(header, test.input); err != nil {
+				t.Fatal(err)
+			}
+			checkGenerate(t, test.input, test.result, header)
+		})
+	}
+}
+
+func TestAddSetCookieInvalid(t *testing.T) {
+	tests := []struct {
+		input Cookie
+		err   string
+	}{
+		{Cookie{Name: "", Value: "b"}, "not a token"},
+		{Cookie{Name: "a b", Value: "c"}, "not a token"},
+		{Cookie{Name: "a", Value: "b c"}, "invalid character"},
+		{Cookie{Name: "a", Value: "b;c"}, "invalid character"},
+		{Cookie{Name: "a", Value: `b\c`}, "invalid character"},
+		{Cookie{Name: "a", Value: `"b"c"`}, "invalid character"},
+		{Cookie{Name: "a", Path: "/; Domain=evil.test"}, "invalid attribute"},
+		{Cookie{Name: "a", Domain: "example.com\n"}, "invalid attribute"},
+		{Cookie{Name: "__Secure-a"}, "must be Secure"},
+		{Cookie{Name: "__Host-a", Path: "/"}, "must be Secure"},
+		{Cookie{Name: "__Host-a", Secure: true}, `must have Path "/"`},
+		{
+			Cookie{Name: "__Host-a", Secure: true, Path: "/", Domain: "example.com"},
+			"must not have Domain",
+		},
+		{Cookie{Name: "a", SameSite: "none"}, "must be Secure"},
+		{Cookie{Name: "a", Partitioned: true}, "must be Secure"},
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			header := http.Header{}
+			err := AddSetCookie(header, test.input)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("adding %#v\nexpected error: %s\nactual error:   %v",
+					test.input, test.err, err)
+			}
+			if len(header) > 0 {
+				t.Errorf("header modified despite error: %#v", header)
+			}
+		})
+	}
+}
+
+func TestSetCookieRoundTrip(t *testing.T) {
+	tests := []Cookie{
+		{Name: "a", Value: "b"},
+		{Name: "a", Value: "", MaxAge: DeltaSeconds(0)},
+		{
+			Name:     "__Host-sid",
+			Value:    `"x/y:z"`,
+			Expires:  time.Date(2030, time.March, 1, 13, 0, 59, 0, time.UTC),
+			MaxAge:   DeltaSeconds(86400),
+			Path:     "/",
+			Secure:   true,
+			HTTPOnly: true,
+			SameSite: "lax",
+			Priority: "low",
+		},
+		{
+			Name:        "__Secure-c",
+			Value:       "!#$%&'()*+-./:<=>?@[]^_`{|}~",
+			Domain:      "sub.example.com",
+			Path:        "/foo/bar",
+			Secure:      true,
+			SameSite:    "none",
+			Partitioned: true,
+		},
+	}
+	for _, cookie := range tests {
+		t.Run("", func(t *testing.T) {
+			header := http.Header{}
+			if err := AddSetCookie(header, cookie); err != nil {
+				t.Fatal(err)
+			}
+			t.Logf("generated: %#v", header)
+			checkParse(t, header, []Cookie{cookie}, SetCookieHeaders(header))
+		})
+	}
+}
+
+func TestCookies(t *testing.T) {
+	tests := []struct {
+		header http.Header
+		result []Cookie
+	}{
+		// Valid headers.
+		{
+			http.Header{"Cookie": {"SID=31d4d96e407aad42; lang=en-US"}},
+			[]Cookie{
+				{Name: "SID", Value: "31d4d96e407aad42"},
+				{Name: "lang", Value: "en-US"},
+			},
+		},
+		{
+			http.Header{"Cookie": {`a="b"`, "c=d"}},
+			[]Cookie{{Name: "a", Value: `"b"`}, {Name: "c", Value: "d"}},
+		},
+
+		// Invalid headers.
+		// Precise outputs on them are not a guaranteed part of the API.
+		// They may change as convenient for the parsing code.
+		{
+			http.Header{"Cookie": {"a=b;c;; d = e f ;=;"}},
+			[]Cookie{
+				{Name: "a", Value: "b"},
+				{Value: "c"},
+				{Name: "d", Value: "e f"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			checkParse(t, test.header, test.result, Cookies(test.header))
+		})
+	}
+}
+
+func TestSetCookies(t *testing.T) {
+	header := http.Header{}
+	err := SetCookies(header, []Cookie{
+		{Name: "a", Value: "b", Secure: true},
+		{Name: "c", Value: `"d"`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGenerate(t, nil, http.Header{"Cookie": {`a=b; c="d"`}}, header)
+
+	err = SetCookies(header, []Cookie{{Name: "a", Value: "b;c"}})
+	if err == nil {
+		t.Error("expected error")
+	}
+	checkGenerate(t, nil, http.Header{"Cookie": {`a=b; c="d"`}}, header)
+
+	SetCookies(header, nil)
+	checkGenerate(t, nil, http.Header{}, header)
+}
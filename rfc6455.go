@@ -0,0 +1,281 @@
+package httpheader
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// SecWebSocketKey parses the Sec-WebSocket-Key header from h
+// (RFC 6455 Section 11.3.1).
+func SecWebSocketKey(h http.Header) string {
+	return h.Get("Sec-Websocket-Key")
+}
+
+// SetSecWebSocketKey replaces the Sec-WebSocket-Key header in h
+// (RFC 6455 Section 11.3.1). See also NewWebSocketKey.
+func SetSecWebSocketKey(h http.Header, key string) {
+	h.Set("Sec-Websocket-Key", key)
+}
+
+// NewWebSocketKey returns a new random value for the Sec-WebSocket-Key header
+// (RFC 6455 Section 4.1).
+func NewWebSocketKey() (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(nonce), nil
+}
+
+// SecWebSocketAccept parses the Sec-WebSocket-Accept header from h
+// (RFC 6455 Section 11.3.3). A client must check that it is equal to
+// WebSocketAccept of the key it sent.
+func SecWebSocketAccept(h http.Header) string {
+	return h.Get("Sec-Websocket-Accept")
+}
+
+// SetSecWebSocketAccept replaces the Sec-WebSocket-Accept header in h
+// (RFC 6455 Section 11.3.3). Normally, accept is WebSocketAccept of the key
+// received from the client.
+func SetSecWebSocketAccept(h http.Header, accept string) {
+	h.Set("Sec-Websocket-Accept", accept)
+}
+
+// WebSocketAccept computes the value of the Sec-WebSocket-Accept header
+// corresponding to the given Sec-WebSocket-Key (RFC 6455 Section 4.2.2).
+func WebSocketAccept(key string) string {
+	hash := sha1.New()
+	hash.Write([]byte(key))
+	hash.Write([]byte("258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+	return base64.StdEncoding.EncodeToString(hash.Sum(nil))
+}
+
+// SecWebSocketVersion parses the Sec-WebSocket-Version header from h
+// (RFC 6455 Section 11.3.5). A client sends only one version, but a server
+// may respond with a list of versions it supports. Any values that are not
+// numbers are skipped.
+func SecWebSocketVersion(h http.Header) []int {
+	values := h["Sec-Websocket-Version"]
+	if values == nil {
+		return nil
+	}
+	versions := make([]int, 0, estimateElems(values))
+	for v, vs := iterElems("", values); v != ""; v, vs = iterElems(v, vs) {
+		var item string
+		item, v = consumeItem(v)
+		if version, err := strconv.Atoi(item); err == nil {
+			versions = append(versions, version)
+		}
+	}
+	return versions
+}
+
+// SetSecWebSocketVersion replaces the Sec-WebSocket-Version header in h
+// (RFC 6455 Section 11.3.5).
+func SetSecWebSocketVersion(h http.Header, versions []int) {
+	if len(versions) == 0 {
+		h.Del("Sec-Websocket-Version")
+		return
+	}
+	b := &strings.Builder{}
+	for i, version := range versions {
+		if i > 0 {
+			write(b, ", ")
+		}
+		write(b, strconv.Itoa(version))
+	}
+	h.Set("Sec-Websocket-Version", b.String())
+}
+
+// SecWebSocketProtocol parses the Sec-WebSocket-Protocol header from h
+// (RFC 6455 Section 11.3.4). Subprotocol names are case-sensitive.
+func SecWebSocketProtocol(h http.Header) []string {
+	values := h["Sec-Websocket-Protocol"]
+	if values == nil {
+		return nil
+	}
+	protos := make([]string, 0, estimateElems(values))
+	for v, vs := iterElems("", values); v != ""; v, vs = iterElems(v, vs) {
+		var proto string
+		proto, v = consumeItem(v)
+		protos = append(protos, proto)
+	}
+	return protos
+}
+
+// SetSecWebSocketProtocol replaces the Sec-WebSocket-Protocol header in h
+// (RFC 6455 Section 11.3.4). A server must send at most one subprotocol.
+func SetSecWebSocketProtocol(h http.Header, protos []string) {
+	if len(protos) == 0 {
+		h.Del("Sec-Websocket-Protocol")
+		return
+	}
+	h.Set("Sec-Websocket-Protocol", strings.Join(protos, ", "))
+}
+
+// A WebSocketExtension represents one element of the Sec-WebSocket-Extensions
+// header (RFC 6455 Section 9.1). A parameter without a value, such as
+// server_no_context_takeover, maps to an empty string in Params.
+//
+// If a parameter occurs more than once, only its first occurrence is kept
+// in Params, and its name is listed in RepeatedParams. Such an element is
+// usually invalid: for example, RFC 7692 Section 7 requires declining
+// a permessage-deflate offer with repeated parameters. RepeatedParams
+// is ignored when generating a header.
+type WebSocketExtension struct {
+	Name           string
+	Params         map[string]string
+	RepeatedParams []string
+}
+
+// SecWebSocketExtensions parses the Sec-WebSocket-Extensions header from h
+// (RFC 6455 Section 11.3.2). A client may offer the same extension several
+// times with different parameters, in order of preference.
+func SecWebSocketExtensions(h http.Header) []WebSocketExtension {
+	values := h["Sec-Websocket-Extensions"]
+	if values == nil {
+		return nil
+	}
+	exts := make([]WebSocketExtension, 0, estimateElems(values))
+	for v, vs := iterElems("", values); v != ""; v, vs = iterElems(v, vs) {
+		var ext WebSocketExtension
+		ext.Name, v = consumeItem(v)
+		for {
+			var name, value string
+			name, value, v = consumeParam(v)
+			if name == "" {
+				break
+			}
+			if _, seen := ext.Params[name]; seen {
+				if !containsFold(ext.RepeatedParams, name) {
+					ext.RepeatedParams = append(ext.RepeatedParams, name)
+				}
+				continue
+			}
+			if ext.Params == nil {
+				ext.Params = make(map[string]string)
+			}
+			ext.Params[name] = value
+		}
+		exts = append(exts, ext)
+	}
+	return exts
+}
+
+// SetSecWebSocketExtensions replaces the Sec-WebSocket-Extensions header in h
+// (RFC 6455 Section 11.3.2).
+func SetSecWebSocketExtensions(h http.Header, exts []WebSocketExtension) {
+	if len(exts) == 0 {
+		h.Del("Sec-Websocket-Extensions")
+		return
+	}
+	b := &strings.Builder{}
+	for i, ext := range exts {
+		if i > 0 {
+			write(b, ", ")
+		}
+		write(b, ext.Name)
+		writeNullableParams(b, ext.Params)
+	}
+	h.Set("Sec-Websocket-Extensions", b.String())
+}
+
+// PerMessageDeflate represents parameters of the permessage-deflate
+// WebSocket extension (RFC 7692 Section 7).
+//
+// ServerMaxWindowBits and ClientMaxWindowBits are 0 if absent. In an offer,
+// client_max_window_bits may be sent without a value, meaning the client
+// supports any window size that the server chooses; this is represented as
+// a ClientMaxWindowBits of 15, which is equivalent.
+type PerMessageDeflate struct {
+	ServerNoContextTakeover bool
+	ClientNoContextTakeover bool
+	ServerMaxWindowBits     int
+	ClientMaxWindowBits     int
+}
+
+// PerMessageDeflate interprets the Params of ext as permessage-deflate
+// parameters (RFC 7692 Section 7.1). It returns false if ext is not
+// permessage-deflate, or if its parameters are invalid (such as unknown
+// or repeated parameters, or window sizes outside 8..15), in which case
+// RFC 7692 requires declining the offer or failing the connection.
+func (ext WebSocketExtension) PerMessageDeflate() (PerMessageDeflate, bool) {
+	var p PerMessageDeflate
+	if !strings.EqualFold(ext.Name, "permessage-deflate") || len(ext.RepeatedParams) > 0 {
+		return p, false
+	}
+	for name, value := range ext.Params {
+		switch name {
+		case "server_no_context_takeover":
+			if value != "" {
+				return p, false
+			}
+			p.ServerNoContextTakeover = true
+		case "client_no_context_takeover":
+			if value != "" {
+				return p, false
+			}
+			p.ClientNoContextTakeover = true
+		case "server_max_window_bits":
+			bits, ok := parseWindowBits(value)
+			if !ok || value == "" {
+				return p, false
+			}
+			p.ServerMaxWindowBits = bits
+		case "client_max_window_bits":
+			bits, ok := parseWindowBits(value)
+			if !ok {
+				return p, false
+			}
+			p.ClientMaxWindowBits = bits
+		default:
+			return p, false
+		}
+	}
+	return p, true
+}
+
+func parseWindowBits(value string) (bits int, ok bool) {
+	if value == "" {
+		return 15, true
+	}
+	// RFC 7692 Section 7.1.2.1 requires a decimal integer from 8 to 15
+	// without leading zeros.
+	if value[0] == '0' {
+		return 0, false
+	}
+	bits, err := strconv.Atoi(value)
+	if err != nil || bits < 8 || bits > 15 {
+		return 0, false
+	}
+	return bits, true
+}
+
+// Extension returns a WebSocketExtension representing p,
+// suitable for SetSecWebSocketExtensions.
+func (p PerMessageDeflate) Extension() WebSocketExtension {
+	ext := WebSocketExtension{Name: "permessage-deflate"}
+	set := func(name, value string) {
+		if ext.Params == nil {
+			ext.Params = make(map[string]string)
+		}
+		ext.Params[name] = value
+	}
+	if p.ServerNoContextTakeover {
+		set("server_no_context_takeover", "")
+	}
+	if p.ClientNoContextTakeover {
+		set("client_no_context_takeover", "")
+	}
+	if p.ServerMaxWindowBits != 0 {
+		set("server_max_window_bits", strconv.Itoa(p.ServerMaxWindowBits))
+	}
+	if p.ClientMaxWindowBits != 0 {
+		set("client_max_window_bits", strconv.Itoa(p.ClientMaxWindowBits))
+	}
+	return ext
+}
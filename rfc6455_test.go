@@ -0,0 +1,261 @@
+package httpheader
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func ExampleWebSocketAccept() {
+	request := http.Header{"Sec-Websocket-Key": {"dGhlIHNhbXBsZSBub25jZQ=="}}
+	response := http.Header{}
+	SetSecWebSocketAccept(response, WebSocketAccept(SecWebSocketKey(request)))
+	fmt.Println(response)
+	// Output: map[Sec-Websocket-Accept:[s3pPLMBiTxaQ9kYGzzhZRbK+xOo=]]
+}
+
+func TestNewWebSocketKey(t *testing.T) {
+	key1, err := NewWebSocketKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key2, _ := NewWebSocketKey()
+	if key1 == key2 {
+		t.Errorf("got the same key twice: %q", key1)
+	}
+	nonce, err := base64.StdEncoding.DecodeString(key1)
+	if err != nil || len(nonce) != 16 {
+		t.Errorf("bad key %q: %v", key1, err)
+	}
+}
+
+func TestSecWebSocketVersion(t *testing.T) {
+	tests := []struct {
+		header http.Header
+		result []int
+	}{
+		// Valid headers.
+		{
+			http.Header{"Sec-Websocket-Version": {"13"}},
+			[]int{13},
+		},
+		{
+			http.Header{"Sec-Websocket-Version": {"13, 8", "7"}},
+			[]int{13, 8, 7},
+		},
+
+		// Invalid headers.
+		// Precise outputs on them are not a guaranteed part of the API.
+		// They may change as convenient for the parsing code.
+		{
+			http.Header{"Sec-Websocket-Version": {"13, hybi-10"}},
+			[]int{13},
+		},
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			checkParse(t, test.header, test.result, SecWebSocketVersion(test.header))
+		})
+	}
+}
+
+func TestSetSecWebSocketVersion(t *testing.T) {
+	header := http.Header{}
+	SetSecWebSocketVersion(header, []int{13, 8})
+	checkGenerate(t, []int{13, 8},
+		http.Header{"Sec-Websocket-Version": {"13, 8"}}, header)
+}
+
+func TestSecWebSocketProtocolRoundTrip(t *testing.T) {
+	checkRoundTrip(t, SetSecWebSocketProtocol, SecWebSocketProtocol,
+		[]string{"token"})
+}
+
+func TestSecWebSocketExtensions(t *testing.T) {
+	tests := []struct {
+		header http.Header
+		result []WebSocketExtension
+	}{
+		// Valid headers.
+		{
+			http.Header{"Sec-Websocket-Extensions": {"permessage-deflate"}},
+			[]WebSocketExtension{{Name: "permessage-deflate"}},
+		},
+		{
+			http.Header{"Sec-Websocket-Extensions": {
+				"permessage-deflate; client_max_window_bits; server_max_window_bits=10, permessage-deflate;client_max_window_bits",
+				`foo; Bar="baz"`,
+			}},
+			[]WebSocketExtension{
+				{
+					Name: "permessage-deflate",
+					Params: map[string]string{
+						"client_max_window_bits": "",
+						"server_max_window_bits": "10",
+					},
+				},
+				{
+					Name:   "permessage-deflate",
+					Params: map[string]string{"client_max_window_bits": ""},
+				},
+				{
+					Name:   "foo",
+					Params: map[string]string{"bar": "baz"},
+				},
+			},
+		},
+		{
+			http.Header{"Sec-Websocket-Extensions": {
+				"permessage-deflate; server_max_window_bits=10; Server_Max_Window_Bits=12; server_max_window_bits, permessage-deflate",
+			}},
+			[]WebSocketExtension{
+				{
+					Name:           "permessage-deflate",
+					Params:         map[string]string{"server_max_window_bits": "10"},
+					RepeatedParams: []string{"server_max_window_bits"},
+				},
+				{Name: "permessage-deflate"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			checkParse(t, test.header, test.result, SecWebSocketExtensions(test.header))
+		})
+	}
+}
+
+func TestSecWebSocketExtensionsRoundTrip(t *testing.T) {
+	checkRoundTrip(t, SetSecWebSocketExtensions, SecWebSocketExtensions,
+		[]WebSocketExtension{{
+			Name:   "token",
+			Params: map[string]string{"lower token": "token | quotable | empty"},
+		}},
+	)
+}
+
+func ExampleWebSocketExtension_PerMessageDeflate() {
+	request := http.Header{"Sec-Websocket-Extensions": {
+		"permessage-deflate; client_max_window_bits; server_max_window_bits=16, permessage-deflate; client_max_window_bits",
+	}}
+	for _, offer := range SecWebSocketExtensions(request) {
+		if params, ok := offer.PerMessageDeflate(); ok {
+			params.ClientMaxWindowBits = 12
+			response := http.Header{}
+			SetSecWebSocketExtensions(response,
+				[]WebSocketExtension{params.Extension()})
+			fmt.Println(response)
+			break
+		}
+	}
+	// Output: map[Sec-Websocket-Extensions:[permessage-deflate;client_max_window_bits=12]]
+}
+
+func TestPerMessageDeflate(t *testing.T) {
+	tests := []struct {
+		ext    WebSocketExtension
+		result PerMessageDeflate
+		ok     bool
+	}{
+		{
+			WebSocketExtension{Name: "permessage-deflate"},
+			PerMessageDeflate{},
+			true,
+		},
+		{
+			WebSocketExtension{
+				Name: "Permessage-Deflate",
+				Params: map[string]string{
+					"server_no_context_takeover": "",
+					"client_no_context_takeover": "",
+					"server_max_window_bits":     "8",
+					"client_max_window_bits":     "",
+				},
+			},
+			PerMessageDeflate{
+				ServerNoContextTakeover: true,
+				ClientNoContextTakeover: true,
+				ServerMaxWindowBits:     8,
+				ClientMaxWindowBits:     15,
+			},
+			true,
+		},
+		{
+			WebSocketExtension{Name: "x-webkit-deflate-frame"},
+			PerMessageDeflate{},
+			false,
+		},
+		{
+			WebSocketExtension{
+				Name:   "permessage-deflate",
+				Params: map[string]string{"server_max_window_bits": ""},
+			},
+			PerMessageDeflate{},
+			false,
+		},
+		{
+			WebSocketExtension{
+				Name:           "permessage-deflate",
+				Params:         map[string]string{"server_max_window_bits": "10"},
+				RepeatedParams: []string{"server_max_window_bits"},
+			},
+			PerMessageDeflate{},
+			false,
+		},
+		{
+			WebSocketExtension{
+				Name:   "permessage-deflate",
+				Params: map[string]string{"client_max_window_bits": "16"},
+			},
+			PerMessageDeflate{},
+			false,
+		},
+		{
+			WebSocketExtension{
+				Name:   "permessage-deflate",
+				Params: map[string]string{"client_max_window_bits": "010"},
+			},
+			PerMessageDeflate{},
+			false,
+		},
+		{
+			WebSocketExtension{
+				Name:   "permessage-deflate",
+				Params: map[string]string{"server_no_context_takeover": "1"},
+			},
+			PerMessageDeflate{},
+			false,
+		},
+		{
+			WebSocketExtension{
+				Name:   "permessage-deflate",
+				Params: map[string]string{"mem_level": "9"},
+			},
+			PerMessageDeflate{},
+			false,
+		},
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			result, ok := test.ext.PerMessageDeflate()
+			if ok != test.ok || (ok && result != test.result) {
+				t.Errorf("interpreting %#v\nexpected: %#v, %v\nactual:   %#v, %v",
+					test.ext, test.result, test.ok, result, ok)
+			}
+		})
+	}
+}
+
+func TestPerMessageDeflateExtension(t *testing.T) {
+	params := PerMessageDeflate{
+		ServerNoContextTakeover: true,
+		ServerMaxWindowBits:     10,
+		ClientMaxWindowBits:     15,
+	}
+	ext := params.Extension()
+	result, ok := ext.PerMessageDeflate()
+	if !ok || result != params {
+		t.Errorf("round-trip failure:\ninput:  %#v\noutput: %#v", params, result)
+	}
+}
@@ -0,0 +1,189 @@
+package httpheader
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// BearerToken returns the OAuth 2.0 bearer token sent with r (RFC 6750
+// Section 2), or an empty string if there is none. The token is always
+// accepted from the Authorization header. If allowForm is true, it is also
+// accepted from an access_token parameter in a form-encoded request body,
+// which requires calling r.ParseForm; and if allowQuery is true, from
+// an access_token parameter in the URL query. RFC 6750 discourages both.
+//
+// An error is returned if the request is malformed: if the token is sent
+// in more than one way, or is not a valid b64token. The server should then
+// respond with 400 (Bad Request) and error=invalid_request.
+func BearerToken(r *http.Request, allowForm, allowQuery bool) (string, error) {
+	var tokens []string
+	credentials := Authorization(r.Header)
+	if credentials.Scheme == "bearer" {
+		if credentials.Token == "" {
+			return "", errors.New("httpheader: malformed Bearer credentials")
+		}
+		tokens = append(tokens, credentials.Token)
+	}
+	if allowForm && r.Method != "GET" && isFormRequest(r) {
+		if err := r.ParseForm(); err != nil {
+			return "", err
+		}
+		tokens = append(tokens, r.PostForm["access_token"]...)
+	}
+	if allowQuery {
+		tokens = append(tokens, r.URL.Query()["access_token"]...)
+	}
+	switch {
+	case len(tokens) == 0:
+		return "", nil
+	case len(tokens) > 1:
+		return "", errors.New("httpheader: Bearer token sent more than once")
+	case !isB64Token(tokens[0]):
+		return "", errors.New("httpheader: Bearer token is not a valid b64token")
+	}
+	return tokens[0], nil
+}
+
+func isFormRequest(r *http.Request) bool {
+	mediaType := r.Header.Get("Content-Type")
+	if i := strings.IndexByte(mediaType, ';'); i != -1 {
+		mediaType = mediaType[:i]
+	}
+	return strings.EqualFold(strings.TrimSpace(mediaType), "application/x-www-form-urlencoded")
+}
+
+// isB64Token reports whether s matches the b64token rule (RFC 6750
+// Section 2.1), which is also the token68 rule of RFC 7235.
+func isB64Token(s string) bool {
+	s = strings.TrimRight(s, "=")
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '.' || c == '_' || c == '~' || c == '+' || c == '/') {
+			return false
+		}
+	}
+	return true
+}
+
+// A BearerChallenge represents a challenge for the Bearer scheme (RFC 6750
+// Section 3), possibly with the step-up authentication parameters of RFC 9470.
+//
+// Error is an error code such as "invalid_token" or "insufficient_scope".
+// ACRValues and MaxAge ask the client to obtain a token with stronger or more
+// recent user authentication, usually together with Error set to
+// "insufficient_user_authentication" (RFC 9470 Section 3).
+type BearerChallenge struct {
+	Realm            string
+	Scope            []string
+	Error            string
+	ErrorDescription string
+	ErrorURI         string
+	ACRValues        []string
+	MaxAge           Delta
+}
+
+// ParseBearerChallenge interprets challenge, such as returned by
+// WWWAuthenticate, as a Bearer challenge. It doesn't check the scheme.
+func ParseBearerChallenge(challenge Auth) BearerChallenge {
+	params := challenge.Params
+	c := BearerChallenge{
+		Realm:            challenge.Realm,
+		Scope:            bearerFields(params["scope"]),
+		Error:            params["error"],
+		ErrorDescription: params["error_description"],
+		ErrorURI:         params["error_uri"],
+		ACRValues:        bearerFields(params["acr_values"]),
+	}
+	if seconds, ok := parseLength(params["max_age"]); ok {
+		c.MaxAge = DeltaSeconds(seconds)
+	}
+	return c
+}
+
+func bearerFields(s string) []string {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	return strings.Fields(s)
+}
+
+// Auth returns c as a challenge to be sent with SetWWWAuthenticate.
+// An error is returned if any parameter contains characters that are not
+// allowed by RFC 6750 Section 3, such as double quotes or backslashes.
+func (c BearerChallenge) Auth() (Auth, error) {
+	challenge := Auth{Scheme: "bearer", Realm: c.Realm}
+	set := func(name, value string) {
+		if value == "" {
+			return
+		}
+		if challenge.Params == nil {
+			challenge.Params = make(map[string]string)
+		}
+		challenge.Params[name] = value
+	}
+	for _, scope := range c.Scope {
+		if !isBearerText(scope, false) {
+			return Auth{}, fmt.Errorf("httpheader: bad Bearer scope token %q", scope)
+		}
+	}
+	set("scope", strings.Join(c.Scope, " "))
+	if !isBearerText(c.Error, true) {
+		return Auth{}, fmt.Errorf("httpheader: bad Bearer error %q", c.Error)
+	}
+	set("error", c.Error)
+	if !isBearerText(c.ErrorDescription, true) {
+		return Auth{}, fmt.Errorf("httpheader: bad Bearer error_description %q", c.ErrorDescription)
+	}
+	set("error_description", c.ErrorDescription)
+	if !isBearerText(c.ErrorURI, false) {
+		return Auth{}, fmt.Errorf("httpheader: bad Bearer error_uri %q", c.ErrorURI)
+	}
+	set("error_uri", c.ErrorURI)
+	for _, value := range c.ACRValues {
+		if !isBearerText(value, false) {
+			return Auth{}, fmt.Errorf("httpheader: bad Bearer acr_values token %q", value)
+		}
+	}
+	set("acr_values", strings.Join(c.ACRValues, " "))
+	if c.MaxAge.ok {
+		set("max_age", strconv.Itoa(c.MaxAge.seconds))
+	}
+	return challenge, nil
+}
+
+// isBearerText reports whether s consists of the characters allowed
+// in Bearer challenge parameters (RFC 6750 Section 3): printable ASCII
+// except double quote and backslash, plus space if allowSpace.
+func isBearerText(s string, allowSpace bool) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == ' ' && allowSpace:
+		case c <= ' ' || c >= 0x7F || c == '"' || c == '\\':
+			return false
+		}
+	}
+	return true
+}
+
+// StatusCode returns the HTTP status code that should accompany c,
+// according to its Error (RFC 6750 Section 3.1, RFC 9470 Section 3):
+// 400 (Bad Request) for invalid_request, 403 (Forbidden) for
+// insufficient_scope, and 401 (Unauthorized) otherwise.
+func (c BearerChallenge) StatusCode() int {
+	switch c.Error {
+	case "invalid_request":
+		return http.StatusBadRequest
+	case "insufficient_scope":
+		return http.StatusForbidden
+	default:
+		return http.StatusUnauthorized
+	}
+}
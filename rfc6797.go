@@ -0,0 +1,86 @@
+package httpheader
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// An STSPolicy represents directives of the Strict-Transport-Security header
+// (RFC 6797 Section 6.1). Preload is not part of RFC 6797, but is required
+// by the HSTS preload list maintained at https://hstspreload.org/.
+type STSPolicy struct {
+	MaxAge            Delta
+	IncludeSubDomains bool
+	Preload           bool
+}
+
+// StrictTransportSecurity parses the Strict-Transport-Security header from h
+// (RFC 6797 Section 6.1). As required by RFC 6797 Section 8.1, only the first
+// such header is processed, and unknown directives are ignored.
+//
+// If the header is missing or invalid, a zero STSPolicy is returned,
+// whose MaxAge is absent. RFC 6797 considers a header invalid if it doesn't
+// have a max-age directive, or if any directive appears more than once.
+func StrictTransportSecurity(h http.Header) STSPolicy {
+	var policy STSPolicy
+	v := h.Get("Strict-Transport-Security")
+	seen := make(map[string]bool)
+	for {
+		var name, value string
+		name, value, v = consumeParam(v)
+		if name == "" {
+			break
+		}
+		if seen[name] {
+			return STSPolicy{}
+		}
+		seen[name] = true
+		switch name {
+		case "max-age":
+			seconds, ok := parseLength(value)
+			if !ok {
+				return STSPolicy{}
+			}
+			policy.MaxAge = DeltaSeconds(seconds)
+		case "includesubdomains":
+			policy.IncludeSubDomains = true
+		case "preload":
+			policy.Preload = true
+		}
+	}
+	if skipWSAnd(v, ';') != "" || !policy.MaxAge.ok {
+		return STSPolicy{}
+	}
+	return policy
+}
+
+// SetStrictTransportSecurity replaces the Strict-Transport-Security header
+// in h (RFC 6797 Section 6.1). If policy.MaxAge is absent, the header is
+// deleted, because max-age is required. To tell the browser to forget
+// a policy, set MaxAge to DeltaSeconds(0).
+func SetStrictTransportSecurity(h http.Header, policy STSPolicy) {
+	if !policy.MaxAge.ok {
+		h.Del("Strict-Transport-Security")
+		return
+	}
+	b := &strings.Builder{}
+	write(b, "max-age=", strconv.Itoa(policy.MaxAge.seconds))
+	if policy.IncludeSubDomains {
+		write(b, "; includeSubDomains")
+	}
+	if policy.Preload {
+		write(b, "; preload")
+	}
+	h.Set("Strict-Transport-Security", b.String())
+}
+
+// Preloadable reports whether policy satisfies the header requirements
+// for submission to the HSTS preload list (https://hstspreload.org/):
+// a max-age of at least one year, includeSubDomains, and preload.
+// The site must also satisfy other requirements that cannot be checked here,
+// such as redirecting from HTTP to HTTPS.
+func (policy STSPolicy) Preloadable() bool {
+	return policy.MaxAge.ok && policy.MaxAge.seconds >= 31536000 &&
+		policy.IncludeSubDomains && policy.Preload
+}
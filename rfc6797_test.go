@@ -0,0 +1,167 @@
+package httpheader
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func ExampleStrictTransportSecurity() {
+	header := http.Header{"Strict-Transport-Security": {
+		"max-age=63072000; includeSubDomains; preload",
+	}}
+	policy := StrictTransportSecurity(header)
+	fmt.Println(policy.MaxAge.Value())
+	fmt.Println(policy.Preloadable())
+	// Output: 17520h0m0s true
+	// true
+}
+
+func TestStrictTransportSecurity(t *testing.T) {
+	tests := []struct {
+		header http.Header
+		result STSPolicy
+	}{
+		// Valid headers.
+		{
+			http.Header{"Strict-Transport-Security": {"max-age=31536000"}},
+			STSPolicy{MaxAge: DeltaSeconds(31536000)},
+		},
+		{
+			http.Header{"Strict-Transport-Security": {
+				`max-age="0"; includeSubDomains`,
+			}},
+			STSPolicy{MaxAge: DeltaSeconds(0), IncludeSubDomains: true},
+		},
+		{
+			http.Header{"Strict-Transport-Security": {
+				"Preload ; INCLUDESUBDOMAINS;;Max-Age=600;",
+			}},
+			STSPolicy{
+				MaxAge:            DeltaSeconds(600),
+				IncludeSubDomains: true,
+				Preload:           true,
+			},
+		},
+		{
+			http.Header{"Strict-Transport-Security": {
+				`max-age=600; report-uri="https://example.com/hsts"; foo`,
+			}},
+			STSPolicy{MaxAge: DeltaSeconds(600)},
+		},
+		{
+			// Only the first header is processed (RFC 6797 Section 8.1).
+			http.Header{"Strict-Transport-Security": {
+				"max-age=600",
+				"max-age=0",
+			}},
+			STSPolicy{MaxAge: DeltaSeconds(600)},
+		},
+
+		// Invalid headers.
+		// Precise outputs on them are not a guaranteed part of the API.
+		// They may change as convenient for the parsing code.
+		{
+			http.Header{"Strict-Transport-Security": {"includeSubDomains"}},
+			STSPolicy{},
+		},
+		{
+			http.Header{"Strict-Transport-Security": {
+				"max-age=600; includeSubDomains; includeSubDomains",
+			}},
+			STSPolicy{},
+		},
+		{
+			http.Header{"Strict-Transport-Security": {
+				"max-age=600; max-age=600",
+			}},
+			STSPolicy{},
+		},
+		{
+			http.Header{"Strict-Transport-Security": {
+				"max-age=600; foo; foo",
+			}},
+			STSPolicy{},
+		},
+		{
+			http.Header{"Strict-Transport-Security": {"max-age=-1"}},
+			STSPolicy{},
+		},
+		{
+			http.Header{"Strict-Transport-Security": {"max-age"}},
+			STSPolicy{},
+		},
+		{
+			http.Header{"Strict-Transport-Security": {"max-age=600, preload"}},
+			STSPolicy{},
+		},
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			checkParse(t, test.header, test.result,
+				StrictTransportSecurity(test.header))
+		})
+	}
+}
+
+func TestSetStrictTransportSecurity(t *testing.T) {
+	tests := []struct {
+		input  STSPolicy
+		result http.Header
+	}{
+		{
+			STSPolicy{},
+			http.Header{},
+		},
+		{
+			STSPolicy{IncludeSubDomains: true},
+			http.Header{},
+		},
+		{
+			STSPolicy{MaxAge: DeltaSeconds(0)},
+			http.Header{"Strict-Transport-Security": {"max-age=0"}},
+		},
+		{
+			STSPolicy{
+				MaxAge:            DeltaSeconds(31536000),
+				IncludeSubDomains: true,
+				Preload:           true,
+			},
+			http.Header{"Strict-Transport-Security": {
+				"max-age=31536000; includeSubDomains; preload",
+			}},
+		},
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			header := http.Header{}
+			SetStrictTransportSecurity(header, test.input)
+			checkGenerate(t, test.input, test.result, header)
+			if len(header) > 0 {
+				checkParse(t, header, test.input, StrictTransportSecurity(header))
+			}
+		})
+	}
+}
+
+func TestSTSPolicyPreloadable(t *testing.T) {
+	tests := []struct {
+		input  STSPolicy
+		result bool
+	}{
+		{STSPolicy{}, false},
+		{STSPolicy{IncludeSubDomains: true, Preload: true}, false},
+		{STSPolicy{DeltaSeconds(31535999), true, true}, false},
+		{STSPolicy{DeltaSeconds(31536000), false, true}, false},
+		{STSPolicy{DeltaSeconds(31536000), true, false}, false},
+		{STSPolicy{DeltaSeconds(31536000), true, true}, true},
+		{STSPolicy{DeltaSeconds(63072000), true, true}, true},
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			if got := test.input.Preloadable(); got != test.result {
+				t.Errorf("%+v: got %v, wanted %v", test.input, got, test.result)
+			}
+		})
+	}
+}
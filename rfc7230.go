@@ -1,25 +1,45 @@
 package httpheader
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
 // A ViaElem represents one element of the Via header (RFC 7230 Section 5.7.1).
+// The received-by part is stored either in Host and Port, or in Pseudonym,
+// but not both.
+//
+// Host is a uri-host from RFC 3986, such as a domain name, an IPv4 address,
+// or an IP-literal (in square brackets, as in url.URL's Host). A Port of 0
+// means the port is missing.
 type ViaElem struct {
 	ReceivedProto string
-	ReceivedBy    string
+	Host          string
+	Port          int
+	Pseudonym     string
 	Comment       string
 }
 
+// ReceivedBy returns the received-by part of elem as it appears on the wire,
+// such as "proxy.example.net:8080" or "api-gw1".
+func (elem ViaElem) ReceivedBy() string {
+	b := &strings.Builder{}
+	writeReceivedBy(b, elem)
+	return b.String()
+}
+
 // Via parses the Via header from h (RFC 7230 Section 5.7.1).
 //
 // ReceivedProto in returned elements is canonicalized to always include name:
 // ``1.1'' becomes ``HTTP/1.1''. As a special case, ``2'' and ``HTTP/2'' become
 // ``HTTP/2.0''.
 //
-// BUG(vfaronov): Incorrectly parses some extravagant values of uri-host
-// that do not occur in practice but are theoretically admitted by RFC 3986.
+// The grammar of Via doesn't distinguish a pseudonym from a uri-host without
+// a port. Via returns a received-by as Pseudonym if it is a token that contains
+// no dots, such as ``api-gw1'', and as Host otherwise. Thus, ``localhost''
+// becomes a Pseudonym, but ``localhost:8080'' becomes a Host and Port.
 func Via(h http.Header) []ViaElem {
 	values := h["Via"]
 	if values == nil {
@@ -28,10 +48,12 @@ func Via(h http.Header) []ViaElem {
 	elems := make([]ViaElem, 0, estimateElems(values))
 	for v, vs := iterElems("", values); v != ""; v, vs = iterElems(v, vs) {
 		var elem ViaElem
+		var receivedBy string
 		elem.ReceivedProto, v = consumeItem(v)
 		elem.ReceivedProto = canonicalProto(elem.ReceivedProto)
 		v = skipWS(v)
-		elem.ReceivedBy, v = consumeReceivedBy(v)
+		receivedBy, v = consumeReceivedBy(v)
+		elem.Host, elem.Port, elem.Pseudonym = parseReceivedBy(receivedBy)
 		v = skipWS(v)
 		if peek(v) == '(' {
 			elem.Comment, v = consumeComment(v)
@@ -62,20 +84,78 @@ func canonicalProto(proto string) string {
 }
 
 func consumeReceivedBy(v string) (by, newv string) {
-	// This is tricky because received-by can contain commas, semicolons, equal
-	// signs (see test cases) or even be empty, if you read the grammar literally
-	// (reg-name may be empty). The reg-name cases are too much for me right now,
-	// but it's easy to handle the IP-Literal case: it's delimited by brackets
-	// and never contains brackets.
+	// received-by never contains whitespace, but a reg-name (RFC 3986
+	// Section 3.2.2) can contain sub-delims, including commas, semicolons
+	// and equal signs (see test cases). A comma may thus be part of this
+	// received-by or start the next element, so we have to look ahead.
+	// An IP-Literal is easier: it's delimited by brackets and never contains
+	// brackets, so we can skip over any commas inside it.
+	i := 0
 	if peek(v) == '[' {
-		if end := strings.IndexByte(v, ']'); end >= 0 {
-			var maybePort string
-			maybePort, newv = consumeItem(v[end+1:])
-			by = v[:end+1+len(maybePort)]
-			return
+		if end := strings.IndexByte(v, ']'); end != -1 {
+			i = end + 1
+		}
+	}
+	for ; i < len(v); i++ {
+		switch v[i] {
+		case ' ', '\t':
+			return v[:i], v[i:]
+		case ',':
+			if startsViaElem(v[i+1:]) {
+				return v[:i], v[i:]
+			}
+		}
+	}
+	return v, ""
+}
+
+// startsViaElem returns true if v, which follows a comma, looks like the rest
+// of the Via header rather than the rest of a reg-name.
+func startsViaElem(v string) bool {
+	switch peek(v) {
+	case 0, ' ', '\t', ',':
+		// A reg-name can't contain whitespace, and an empty list element
+		// is more likely than a reg-name with consecutive commas.
+		return true
+	}
+	// Otherwise, it's the next element only if it has a received-protocol
+	// (which consists of tchars and maybe a slash) followed by whitespace
+	// and something else.
+	for i := 0; i < len(v); i++ {
+		switch {
+		case v[i] == ' ' || v[i] == '\t':
+			next := peek(skipWS(v[i:]))
+			return next != 0 && next != ','
+		case v[i] != '/' && byteClass[v[i]] != cTokenOK:
+			return false
+		}
+	}
+	return false
+}
+
+func parseReceivedBy(by string) (host string, port int, pseudonym string) {
+	// The port is after the last colon, unless that colon is inside
+	// an IP-Literal.
+	if peek(by) == '[' && strings.IndexByte(by, ']') == -1 {
+		// Unterminated IP-Literal.
+		return by, 0, ""
+	}
+	if colon := strings.LastIndexByte(by, ':'); colon > strings.LastIndexByte(by, ']') {
+		rawPort := by[colon+1:]
+		if rawPort == "" {
+			return by[:colon], 0, ""
 		}
+		// Port 0 cannot be told apart from a missing port in ViaElem,
+		// and is not usable anyway, so it is invalid like 99999.
+		if n, err := strconv.Atoi(rawPort); err == nil && rawPort[0] != '+' &&
+			n > 0 && n <= 65535 {
+			return by[:colon], n, ""
+		}
+	}
+	if isToken(by) && strings.IndexByte(by, '.') == -1 {
+		return "", 0, by
 	}
-	return consumeItem(v)
+	return by, 0, ""
 }
 
 // SetVia replaces the Via header in h (RFC 7230 Section 5.7.1). See also AddVia.
@@ -101,8 +181,8 @@ func buildVia(elems []ViaElem) string {
 		if i > 0 {
 			write(b, ", ")
 		}
-		write(b, strings.TrimPrefix(elem.ReceivedProto, "HTTP/"),
-			" ", elem.ReceivedBy)
+		write(b, strings.TrimPrefix(elem.ReceivedProto, "HTTP/"), " ")
+		writeReceivedBy(b, elem)
 		if elem.Comment != "" {
 			write(b, " ")
 			writeComment(b, elem.Comment)
@@ -110,3 +190,576 @@ func buildVia(elems []ViaElem) string {
 	}
 	return b.String()
 }
+
+func writeReceivedBy(b *strings.Builder, elem ViaElem) {
+	if elem.Pseudonym != "" {
+		write(b, elem.Pseudonym)
+		return
+	}
+	write(b, elem.Host)
+	if elem.Port != 0 {
+		write(b, ":", strconv.Itoa(elem.Port))
+	}
+}
+
+// ViaContains reports whether any element of the Via header in h
+// was received by the given host[:port] or pseudonym, compared
+// case-insensitively with ViaElem's ReceivedBy.
+// A proxy that finds its own pseudonym in Via is looking at a request loop.
+func ViaContains(h http.Header, receivedBy string) bool {
+	for _, elem := range Via(h) {
+		if strings.EqualFold(elem.ReceivedBy(), receivedBy) {
+			return true
+		}
+	}
+	return false
+}
+
+// Errors returned by ForwardRequest.
+var (
+	ErrLoop        = errors.New("httpheader: request loop detected in Via")
+	ErrTooManyHops = errors.New("httpheader: too many hops in Via")
+	ErrMaxForwards = errors.New("httpheader: Max-Forwards exhausted")
+)
+
+// ForwardRequest checks and updates the header of r, which is about to be
+// forwarded by a proxy that identifies itself in Via as receivedBy
+// (RFC 7230 Section 5.7.1):
+//
+// If Via already contains receivedBy (see ViaContains), ForwardRequest
+// returns ErrLoop. If maxHops is positive and Via already has maxHops or more
+// elements, it returns ErrTooManyHops. If r is a TRACE or OPTIONS request
+// and DecrementMaxForwards returns false, it returns ErrMaxForwards; the proxy
+// must then respond to r itself. In all these cases, r is left unchanged.
+//
+// Otherwise, ForwardRequest decrements Max-Forwards (for TRACE and OPTIONS),
+// and appends to Via an element received by receivedBy (parsed into Host and
+// Port or Pseudonym as in Via) with ReceivedProto set to r's protocol version.
+func ForwardRequest(r *http.Request, receivedBy string, maxHops int) error {
+	if ViaContains(r.Header, receivedBy) {
+		return ErrLoop
+	}
+	if maxHops > 0 && len(Via(r.Header)) >= maxHops {
+		return ErrTooManyHops
+	}
+	if r.Method == http.MethodTrace || r.Method == http.MethodOptions {
+		if !DecrementMaxForwards(r.Header) {
+			return ErrMaxForwards
+		}
+	}
+	elem := ViaElem{ReceivedProto: requestProto(r)}
+	elem.Host, elem.Port, elem.Pseudonym = parseReceivedBy(receivedBy)
+	AddVia(r.Header, elem)
+	return nil
+}
+
+func requestProto(r *http.Request) string {
+	switch {
+	case r.Proto != "":
+		return canonicalProto(r.Proto)
+	case r.ProtoMajor == 0 && r.ProtoMinor == 0:
+		// Probably a Request literal that doesn't bother with versions.
+		return "HTTP/1.1"
+	default:
+		return "HTTP/" + strconv.Itoa(r.ProtoMajor) + "." + strconv.Itoa(r.ProtoMinor)
+	}
+}
+
+// Connection parses the Connection header from h (RFC 7230 Section 6.1),
+// returning a map where keys are connection options, canonicalized with
+// http.CanonicalHeaderKey, and values are all true. For example,
+// ``Connection: close'' is returned as map[Close:true].
+func Connection(h http.Header) map[string]bool {
+	values := h["Connection"]
+	if values == nil {
+		return nil
+	}
+	opts := make(map[string]bool)
+	for v, vs := iterElems("", values); v != ""; v, vs = iterElems(v, vs) {
+		var opt string
+		opt, v = consumeItem(v)
+		opt = http.CanonicalHeaderKey(opt)
+		opts[opt] = true
+	}
+	return opts
+}
+
+// SetConnection replaces the Connection header in h (RFC 7230 Section 6.1).
+// Options mapping to false are ignored. See also AddConnection.
+func SetConnection(h http.Header, opts map[string]bool) {
+	b := &strings.Builder{}
+	for opt, value := range opts {
+		if !value {
+			continue
+		}
+		if b.Len() > 0 {
+			write(b, ", ")
+		}
+		write(b, opt)
+	}
+	if b.Len() == 0 {
+		h.Del("Connection")
+		return
+	}
+	h.Set("Connection", b.String())
+}
+
+// AddConnection appends the given options to the Connection header in h
+// (RFC 7230 Section 6.1).
+func AddConnection(h http.Header, opts ...string) {
+	if len(opts) == 0 {
+		return
+	}
+	h.Add("Connection", strings.Join(opts, ", "))
+}
+
+// KeepAliveParams represents parameters of the Keep-Alive header,
+// which is not standardized, but is described in RFC 2068 Section 19.7.1.1
+// and is widely used with HTTP/1.0 persistent connections. Max is 0 if missing.
+type KeepAliveParams struct {
+	Timeout Delta
+	Max     int
+}
+
+// KeepAlive parses the Keep-Alive header from h. Unknown parameters are ignored.
+func KeepAlive(h http.Header) KeepAliveParams {
+	var params KeepAliveParams
+	for v, vs := iterElems("", h["Keep-Alive"]); v != ""; v, vs = iterElems(v, vs) {
+		var name, value string
+		name, value, v = consumeParam(v)
+		switch name {
+		case "timeout":
+			if seconds, err := strconv.Atoi(value); err == nil {
+				params.Timeout = DeltaSeconds(seconds)
+			}
+		case "max":
+			params.Max, _ = strconv.Atoi(value)
+		}
+	}
+	return params
+}
+
+// SetKeepAlive replaces the Keep-Alive header in h. Remember that Keep-Alive
+// must also be listed in Connection (see AddConnection).
+func SetKeepAlive(h http.Header, params KeepAliveParams) {
+	b := &strings.Builder{}
+	var wrote bool
+	if params.Timeout.ok {
+		wrote = writeDirective(b, wrote, "timeout",
+			strconv.Itoa(params.Timeout.seconds))
+	}
+	if params.Max != 0 {
+		wrote = writeDirective(b, wrote, "max", strconv.Itoa(params.Max))
+	}
+	if !wrote {
+		h.Del("Keep-Alive")
+		return
+	}
+	h.Set("Keep-Alive", b.String())
+}
+
+// RemoveHopByHop deletes from h all hop-by-hop headers, which a proxy must not
+// forward (RFC 7230 Section 6.1). These are the headers named in Connection,
+// Connection itself, and the following headers, which are hop-by-hop
+// even when not named in Connection: Keep-Alive, Proxy-Connection,
+// Proxy-Authenticate, Proxy-Authorization, TE, Trailer, Transfer-Encoding,
+// and Upgrade.
+//
+// Note that a proxy may still need the information from some of these headers,
+// like Keep-Alive's Timeout or TE's acceptance of trailers, so it should parse
+// them before calling RemoveHopByHop.
+func RemoveHopByHop(h http.Header) {
+	for opt := range Connection(h) {
+		h.Del(opt)
+	}
+	for _, name := range hopByHop {
+		h.Del(name)
+	}
+}
+
+// hopByHop lists headers that are always hop-by-hop,
+// canonicalized with http.CanonicalHeaderKey.
+var hopByHop = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection", // non-standard but still sent by some clients
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// A TransferCoding represents an element of the Transfer-Encoding header
+// (RFC 7230 Section 3.3.1 and Section 4).
+type TransferCoding struct {
+	Coding string
+	Params map[string]string
+}
+
+// TransferEncoding parses the Transfer-Encoding header from h
+// (RFC 7230 Section 3.3.1). Note that net/http removes this header
+// from received messages, instead storing it in the TransferEncoding field
+// of http.Request and http.Response.
+func TransferEncoding(h http.Header) []TransferCoding {
+	values := h["Transfer-Encoding"]
+	if values == nil {
+		return nil
+	}
+	codings := make([]TransferCoding, 0, estimateElems(values))
+	for v, vs := iterElems("", values); v != ""; v, vs = iterElems(v, vs) {
+		var coding TransferCoding
+		coding.Coding, v = consumeItem(v)
+		coding.Coding = strings.ToLower(coding.Coding)
+		if peek(skipWS(v)) == ';' {
+			coding.Params, v = consumeParams(v)
+		}
+		codings = append(codings, coding)
+	}
+	return codings
+}
+
+// SetTransferEncoding replaces the Transfer-Encoding header in h
+// (RFC 7230 Section 3.3.1).
+func SetTransferEncoding(h http.Header, codings []TransferCoding) {
+	if len(codings) == 0 {
+		h.Del("Transfer-Encoding")
+		return
+	}
+	b := &strings.Builder{}
+	for i, coding := range codings {
+		if i > 0 {
+			write(b, ", ")
+		}
+		write(b, coding.Coding)
+		writeParams(b, coding.Params)
+	}
+	h.Set("Transfer-Encoding", b.String())
+}
+
+// A TEElem represents one element of the TE header (RFC 7230 Section 4.3).
+type TEElem struct {
+	Coding string
+	Params map[string]string // not including q
+	Q      float32
+}
+
+// TE parses the TE header from h (RFC 7230 Section 4.3). The special
+// ``trailers'' keyword is not returned in elems; instead, trailers is true
+// if it is present.
+func TE(h http.Header) (elems []TEElem, trailers bool) {
+	for v, vs := iterElems("", h["Te"]); v != ""; v, vs = iterElems(v, vs) {
+		elem := TEElem{Q: 1}
+		elem.Coding, v = consumeItem(v)
+		elem.Coding = strings.ToLower(elem.Coding)
+		if elem.Coding == "trailers" {
+			trailers = true
+			continue
+		}
+		for {
+			var name, value string
+			name, value, v = consumeParam(v)
+			if name == "" {
+				break
+			}
+			if name == "q" {
+				qvalue, _ := strconv.ParseFloat(value, 32)
+				elem.Q = float32(qvalue)
+				continue
+			}
+			if elem.Params == nil {
+				elem.Params = make(map[string]string)
+			}
+			elem.Params[name] = value
+		}
+		elems = append(elems, elem)
+	}
+	return elems, trailers
+}
+
+// SetTE replaces the TE header in h (RFC 7230 Section 4.3).
+// If trailers is true, the ``trailers'' keyword is added to elems.
+//
+// Q in elems must be set explicitly to avoid sending "q=0", which would mean
+// "not acceptable".
+func SetTE(h http.Header, elems []TEElem, trailers bool) {
+	if len(elems) == 0 && !trailers {
+		h.Del("Te")
+		return
+	}
+	b := &strings.Builder{}
+	if trailers {
+		write(b, "trailers")
+	}
+	for _, elem := range elems {
+		if b.Len() > 0 {
+			write(b, ", ")
+		}
+		write(b, elem.Coding)
+		writeParams(b, elem.Params)
+		if elem.Q != 1 {
+			write(b, ";q=", strconv.FormatFloat(float64(elem.Q), 'g', 3, 32))
+		}
+	}
+	h.Set("Te", b.String())
+}
+
+// Trailer parses the Trailer header from h (RFC 7230 Section 4.4), returning
+// header names canonicalized with http.CanonicalHeaderKey.
+func Trailer(h http.Header) []string {
+	values := h["Trailer"]
+	if values == nil {
+		return nil
+	}
+	names := make([]string, 0, estimateElems(values))
+	for v, vs := iterElems("", values); v != ""; v, vs = iterElems(v, vs) {
+		var name string
+		name, v = consumeItem(v)
+		names = append(names, http.CanonicalHeaderKey(name))
+	}
+	return names
+}
+
+// SetTrailer replaces the Trailer header in h (RFC 7230 Section 4.4).
+func SetTrailer(h http.Header, names []string) {
+	if len(names) == 0 {
+		h.Del("Trailer")
+		return
+	}
+	h.Set("Trailer", strings.Join(names, ", "))
+}
+
+// Errors returned by CheckFraming.
+var (
+	ErrBadTransferEncoding       = errors.New("httpheader: malformed Transfer-Encoding")
+	ErrChunkedNotFinal           = errors.New("httpheader: chunked is not the final transfer coding")
+	ErrChunkedRepeated           = errors.New("httpheader: chunked transfer coding applied more than once")
+	ErrTransferEncodingAndLength = errors.New("httpheader: both Transfer-Encoding and Content-Length present")
+	ErrBadContentLength          = errors.New("httpheader: invalid Content-Length")
+	ErrConflictingContentLengths = errors.New("httpheader: conflicting Content-Length values")
+)
+
+// CheckFraming checks the Transfer-Encoding and Content-Length headers in h
+// for problems that make the length of a message ambiguous, and that are
+// often exploited for request smuggling (RFC 9112 Section 6). A recipient
+// should treat any error from CheckFraming as unrecoverable, responding with
+// 400 (Bad Request) to a request, and closing the connection.
+// The request flag tells whether h belongs to a request or a response.
+//
+// CheckFraming returns:
+//
+//	ErrBadTransferEncoding if Transfer-Encoding is syntactically invalid,
+//	because recipients may disagree on how to interpret it;
+//
+//	ErrTransferEncodingAndLength if both Transfer-Encoding and Content-Length
+//	are present (RFC 9112 Section 6.3 item 3);
+//
+//	ErrChunkedRepeated if chunked is applied more than once (Section 6.1);
+//
+//	ErrChunkedNotFinal if request is true and Transfer-Encoding is present
+//	but chunked is not the final coding (Section 6.3 item 4);
+//
+//	ErrBadContentLength if Content-Length is present but is not a number
+//	(Section 6.3 item 5);
+//
+//	ErrConflictingContentLengths if Content-Length has multiple, different
+//	values (Section 6.3 item 5); multiple identical values are OK.
+//
+// Note that a server must also treat Transfer-Encoding in an HTTP/1.0 message
+// as faulty framing (RFC 9112 Section 6.1). CheckFraming doesn't know
+// the version of the message, so this is left to the caller.
+func CheckFraming(h http.Header, request bool) error {
+	if values := h["Transfer-Encoding"]; values != nil {
+		if h["Content-Length"] != nil {
+			return ErrTransferEncodingAndLength
+		}
+		if !validTransferEncoding(values) {
+			return ErrBadTransferEncoding
+		}
+		codings := TransferEncoding(h)
+		chunked := 0
+		for _, coding := range codings {
+			if coding.Coding == "chunked" {
+				chunked++
+			}
+		}
+		if chunked > 1 {
+			return ErrChunkedRepeated
+		}
+		if request && (len(codings) == 0 || codings[len(codings)-1].Coding != "chunked") {
+			return ErrChunkedNotFinal
+		}
+		return nil
+	}
+	return checkContentLength(h["Content-Length"])
+}
+
+// validTransferEncoding checks the syntax of Transfer-Encoding more strictly
+// than TransferEncoding does: it fails on anything that TransferEncoding
+// might be silently skipping.
+func validTransferEncoding(values []string) bool {
+	for v, vs := iterElems("", values); v != ""; v, vs = iterElems(v, vs) {
+		var coding string
+		coding, v = consumeItem(v)
+		if !isToken(coding) {
+			return false
+		}
+		for {
+			v = skipWS(v)
+			if peek(v) != ';' {
+				break
+			}
+			var name, value string
+			v = skipWS(v[1:])
+			name, v = consumeItem(v)
+			v = skipWS(v)
+			if !isToken(name) || peek(v) != '=' {
+				return false
+			}
+			v = skipWS(v[1:])
+			if peek(v) == '"' {
+				if strings.IndexByte(v[1:], '"') == -1 {
+					return false
+				}
+				_, v = consumeQuoted(v)
+				continue
+			}
+			value, v = consumeItem(v)
+			if !isToken(value) {
+				return false
+			}
+		}
+		if v != "" && v[0] != ',' {
+			return false
+		}
+	}
+	return true
+}
+
+func checkContentLength(values []string) error {
+	if values == nil {
+		return nil
+	}
+	length := -1
+	for v, vs := iterElems("", values); v != ""; v, vs = iterElems(v, vs) {
+		var item string
+		item, v = consumeItem(v)
+		v = skipWS(v)
+		n, ok := parseLength(item)
+		if !ok || (v != "" && v[0] != ',') {
+			return ErrBadContentLength
+		}
+		if length != -1 && n != length {
+			return ErrConflictingContentLengths
+		}
+		length = n
+	}
+	if length == -1 {
+		// Content-Length is present but empty.
+		return ErrBadContentLength
+	}
+	return nil
+}
+
+func parseLength(s string) (n int, ok bool) {
+	if s == "" {
+		return 0, false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || '9' < s[i] {
+			return 0, false
+		}
+		digit := int(s[i] - '0')
+		if n > (maxInt-digit)/10 {
+			return 0, false
+		}
+		n = n*10 + digit
+	}
+	return n, true
+}
+
+// A Protocol is an element of the Upgrade header (RFC 7230 Section 6.7),
+// such as {"HTTP", "2.0"} or {"websocket", ""}.
+type Protocol struct {
+	Name    string
+	Version string
+}
+
+// Upgrade parses the Upgrade header from h (RFC 7230 Section 6.7).
+func Upgrade(h http.Header) []Protocol {
+	values := h["Upgrade"]
+	if values == nil {
+		return nil
+	}
+	protos := make([]Protocol, 0, estimateElems(values))
+	for v, vs := iterElems("", values); v != ""; v, vs = iterElems(v, vs) {
+		var proto Protocol
+		var item string
+		item, v = consumeItem(v)
+		proto.Name, proto.Version = splitNameVersion(item)
+		protos = append(protos, proto)
+	}
+	return protos
+}
+
+// SetUpgrade replaces the Upgrade header in h (RFC 7230 Section 6.7).
+// Remember that Upgrade must also be listed in Connection (see AddConnection).
+func SetUpgrade(h http.Header, protos []Protocol) {
+	if len(protos) == 0 {
+		h.Del("Upgrade")
+		return
+	}
+	b := &strings.Builder{}
+	for i, proto := range protos {
+		if i > 0 {
+			write(b, ", ")
+		}
+		write(b, proto.Name)
+		if proto.Version != "" {
+			write(b, "/", proto.Version)
+		}
+	}
+	h.Set("Upgrade", b.String())
+}
+
+// SelectUpgrade chooses a protocol to switch to in response to r, from among
+// the supported protocols, and prepares the header of a 101 (Switching
+// Protocols) response (RFC 7230 Section 6.7). It returns the chosen protocol
+// and true, or a zero Protocol and false if r doesn't ask for any
+// of the supported protocols.
+//
+// The first protocol offered in r's Upgrade (that is, the one most preferred
+// by the client) that matches any of supported is chosen. Names are compared
+// case-insensitively. A supported Protocol with an empty Version matches
+// any version of that protocol.
+//
+// Upgrade is ignored unless r is HTTP/1.1 or a later HTTP/1.x: HTTP/1.0
+// doesn't have it, and HTTP/2 forbids it (RFC 7540 Section 8.1.2.2).
+// It is also ignored if it is not listed in r's Connection header (meaning
+// it was probably forwarded by a broken intermediary).
+//
+// If a protocol is chosen, SelectUpgrade sets the Upgrade header in resp
+// to it, and appends ``upgrade'' to the Connection header in resp.
+// It is then up to the caller to send the 101 response and switch protocols.
+func SelectUpgrade(r *http.Request, supported []Protocol, resp http.Header) (Protocol, bool) {
+	if r.ProtoMajor != 1 || r.ProtoMinor < 1 || !Connection(r.Header)["Upgrade"] {
+		return Protocol{}, false
+	}
+	for _, offered := range Upgrade(r.Header) {
+		for _, proto := range supported {
+			if !strings.EqualFold(offered.Name, proto.Name) {
+				continue
+			}
+			if proto.Version != "" && offered.Version != proto.Version {
+				continue
+			}
+			SetUpgrade(resp, []Protocol{offered})
+			if !Connection(resp)["Upgrade"] {
+				AddConnection(resp, "upgrade")
+			}
+			return offered, true
+		}
+	}
+	return Protocol{}, false
+}
@@ -78,18 +78,51 @@ func AddVary(h http.Header, names ...string) {
 // A Product contains software information as found in the User-Agent
 // and Server headers (RFC 7231 Section 5.5.3 and Section 7.4.2).
 // If multiple comments are associated with a product, they are concatenated
-// with a "; " separator.
+// with a "; " separator. Use UserAgentComments or ServerComments to keep them
+// apart.
+//
+// Version can be compared with the Version type.
 type Product struct {
 	Name    string
 	Version string
 	Comment string
 }
 
+// A CommentedProduct is a Product together with its comments, kept apart
+// and parsed, as returned by UserAgentComments and ServerComments.
+// The embedded Product's Comment still holds all of them concatenated.
+type CommentedProduct struct {
+	Product
+	Comments []Comment
+}
+
+// A Comment is a comment (RFC 7230 Section 3.2.6) split into its
+// ";"-separated parts. For example, "(Windows NT 10.0; Win64; x64)" has
+// three parts, and "(KHTML, like Gecko)" has one.
+type Comment []CommentPart
+
+// A CommentPart is one part of a Comment. Text is the part with surrounding
+// whitespace trimmed, including any nested comments as they appear, such as
+// "Opera Mini/9.80 (S60; SymbOS)". Nested holds those nested comments,
+// parsed in turn.
+type CommentPart struct {
+	Text   string
+	Nested []Comment
+}
+
 // UserAgent parses the User-Agent header from h (RFC 7231 Section 5.5.3).
 func UserAgent(h http.Header) []Product {
 	return parseProducts(h.Get("User-Agent"))
 }
 
+// UserAgentComments is like UserAgent, but also returns the comments
+// of each product parsed into a Comment. For example,
+// "Foo/1.0 (Windows NT 10.0; Win64) (x64) Bar" gives a Foo with two Comments,
+// and a Bar with none.
+func UserAgentComments(h http.Header) []CommentedProduct {
+	return parseCommentedProducts(h.Get("User-Agent"))
+}
+
 // SetUserAgent replaces the User-Agent header in h (RFC 7231 Section 5.5.3).
 func SetUserAgent(h http.Header, products []Product) {
 	if len(products) == 0 {
@@ -104,6 +137,12 @@ func Server(h http.Header) []Product {
 	return parseProducts(h.Get("Server"))
 }
 
+// ServerComments is like Server, but also returns the comments of each
+// product, like UserAgentComments.
+func ServerComments(h http.Header) []CommentedProduct {
+	return parseCommentedProducts(h.Get("Server"))
+}
+
 // SetServer replaces the Server header in h (RFC 7231 Section 7.4.2).
 func SetServer(h http.Header, products []Product) {
 	if len(products) == 0 {
@@ -117,32 +156,64 @@ func parseProducts(v string) []Product {
 	var products []Product
 	for v != "" {
 		var product Product
-		product.Name, v = consumeItem(v)
-		if product.Name == "" {
-			// Avoid infinite loop.
-			v = v[1:]
-			continue
+		var ok bool
+		product, _, v, ok = consumeProduct(v, false)
+		if ok {
+			products = append(products, product)
 		}
-		product.Name, product.Version = consumeTo(product.Name, '/', false)
-		// Collect all comments for this product.
-		for {
-			v = skipWS(v)
-			if peek(v) != '(' {
-				break
-			}
-			var comment string
-			comment, v = consumeComment(v)
-			if product.Comment == "" {
-				product.Comment = comment
-			} else {
-				product.Comment += "; " + comment
-			}
+	}
+	return products
+}
+
+func parseCommentedProducts(v string) []CommentedProduct {
+	var products []CommentedProduct
+	for v != "" {
+		var product CommentedProduct
+		var ok bool
+		product.Product, product.Comments, v, ok = consumeProduct(v, true)
+		if ok {
+			products = append(products, product)
 		}
-		products = append(products, product)
 	}
 	return products
 }
 
+// consumeProduct consumes one product with its comments, which are also
+// parsed if withComments is true. If there is no product, it skips one byte
+// to avoid an infinite loop, and returns false.
+func consumeProduct(v string, withComments bool) (Product, []Comment, string, bool) {
+	var product Product
+	var comments []Comment
+	product.Name, v = consumeItem(v)
+	if product.Name == "" {
+		return product, nil, v[1:], false
+	}
+	product.Name, product.Version = splitNameVersion(product.Name)
+	// Collect all comments for this product.
+	for {
+		v = skipWS(v)
+		if peek(v) != '(' {
+			break
+		}
+		var comment string
+		comment, v = consumeComment(v)
+		if product.Comment == "" {
+			product.Comment = comment
+		} else {
+			product.Comment += "; " + comment
+		}
+		if withComments {
+			comments = append(comments, parseComment(comment))
+		}
+	}
+	return product, comments, v, true
+}
+
+// splitNameVersion splits a "name/version" product or protocol.
+func splitNameVersion(s string) (name, version string) {
+	return consumeTo(s, '/', false)
+}
+
 func serializeProducts(products []Product) string {
 	b := &strings.Builder{}
 	for i, product := range products {
@@ -161,6 +232,180 @@ func serializeProducts(products []Product) string {
 	return b.String()
 }
 
+// ParseComment parses the text of a comment, such as Product.Comment,
+// into a Comment. If s is itself enclosed in parentheses, they are removed
+// first. For example, "(Linux; U)" gives the parts "Linux" and "U".
+func ParseComment(s string) Comment {
+	if peek(s) == '(' {
+		if text, rest := consumeComment(s); rest == "" {
+			s = text
+		}
+	}
+	return parseComment(s)
+}
+
+func parseComment(s string) Comment {
+	var comment Comment
+	for _, text := range splitComment(s) {
+		part := CommentPart{Text: text}
+		for rest := text; ; {
+			i := strings.IndexByte(rest, '(')
+			if i == -1 {
+				break
+			}
+			var nested string
+			nested, rest = consumeComment(rest[i:])
+			part.Nested = append(part.Nested, parseComment(nested))
+		}
+		comment = append(comment, part)
+	}
+	return comment
+}
+
+// splitComment splits s at semicolons that are not inside nested comments,
+// trimming whitespace and dropping empty parts.
+func splitComment(s string) []string {
+	var parts []string
+	nesting := 0
+	start := 0
+	for i := 0; i <= len(s); i++ {
+		switch {
+		case i < len(s) && s[i] == '(':
+			nesting++
+		case i < len(s) && s[i] == ')':
+			if nesting > 0 {
+				nesting--
+			}
+		case i == len(s) || s[i] == ';' && nesting == 0:
+			if part := strings.TrimSpace(s[start:i]); part != "" {
+				parts = append(parts, part)
+			}
+			start = i + 1
+		}
+	}
+	return parts
+}
+
+// A Version is a software version, such as Product.Version, that can be
+// compared in a way that makes sense for common versioning schemes,
+// including Semantic Versioning 2.0.0:
+//
+//	Version("10.0").Compare("9.1") > 0
+//	Version("1.2").Compare("1.2.0") == 0
+//	Version("v2.0.0-rc.1").Compare("2.0.0") < 0
+//	Version("2.0.0+build.5").Compare("2.0.0") == 0
+//
+// Versions are split into dot-separated components, which are compared
+// numerically where they begin with digits, and lexically otherwise.
+// Missing components count as zero. A leading "v" is ignored, as is build
+// metadata after a "+". A pre-release suffix after a "-" makes the version
+// precede the same version without it, and pre-release identifiers are
+// compared as in Semantic Versioning.
+type Version string
+
+// Compare returns -1 if v precedes w, +1 if v follows w, and 0 if
+// they are equivalent.
+func (v Version) Compare(w Version) int {
+	vMain, vPre := splitVersion(string(v))
+	wMain, wPre := splitVersion(string(w))
+	if c := compareComponents(vMain, wMain, true); c != 0 {
+		return c
+	}
+	switch {
+	case vPre == nil && wPre == nil:
+		return 0
+	case vPre == nil:
+		return 1
+	case wPre == nil:
+		return -1
+	}
+	return compareComponents(vPre, wPre, false)
+}
+
+// splitVersion returns the dot-separated components of the main version
+// and of the pre-release suffix (nil if none) of s.
+func splitVersion(s string) (main, pre []string) {
+	s = strings.TrimSpace(s)
+	if len(s) > 1 && (s[0] == 'v' || s[0] == 'V') && '0' <= s[1] && s[1] <= '9' {
+		s = s[1:]
+	}
+	if i := strings.IndexByte(s, '+'); i != -1 {
+		s = s[:i]
+	}
+	if i := strings.IndexByte(s, '-'); i != -1 {
+		pre = strings.Split(s[i+1:], ".")
+		s = s[:i]
+	}
+	return strings.Split(s, "."), pre
+}
+
+// compareComponents compares version components pairwise. If padZero,
+// missing and empty components count as zero; otherwise, as in Semantic Versioning
+// pre-releases, a shorter list of otherwise equal components precedes
+// a longer one.
+func compareComponents(a, b []string, padZero bool) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y string
+		switch {
+		case i < len(a) && i < len(b):
+			x, y = a[i], b[i]
+		case !padZero && i >= len(a):
+			return -1
+		case !padZero:
+			return 1
+		case i < len(a):
+			x, y = a[i], "0"
+		default:
+			x, y = "0", b[i]
+		}
+		if padZero && x == "" {
+			x = "0"
+		}
+		if padZero && y == "" {
+			y = "0"
+		}
+		if c := compareComponent(x, y); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// compareComponent compares the numeric prefixes of x and y numerically,
+// then the rest lexically. A component without a numeric prefix follows
+// one with it, as in Semantic Versioning.
+func compareComponent(x, y string) int {
+	xNum, xRest := splitDigits(x)
+	yNum, yRest := splitDigits(y)
+	switch {
+	case xNum == "" && yNum != "":
+		return 1
+	case xNum != "" && yNum == "":
+		return -1
+	}
+	// Compare numbers of any size without converting them.
+	xNum = strings.TrimLeft(xNum, "0")
+	yNum = strings.TrimLeft(yNum, "0")
+	switch {
+	case len(xNum) < len(yNum):
+		return -1
+	case len(xNum) > len(yNum):
+		return 1
+	}
+	if c := strings.Compare(xNum, yNum); c != 0 {
+		return c
+	}
+	return strings.Compare(xRest, yRest)
+}
+
+func splitDigits(s string) (digits, rest string) {
+	i := 0
+	for i < len(s) && '0' <= s[i] && s[i] <= '9' {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
 // RetryAfter parses the Retry-After header from h (RFC 7231 Section 7.1.3).
 // When it is specified as delay seconds, those are added to the Date header
 // if one exists in h, otherwise to the current time. If the header cannot
@@ -201,6 +446,53 @@ func SetRetryAfter(h http.Header, after time.Time) {
 	h.Set("Retry-After", after.Format(http.TimeFormat))
 }
 
+// MaxForwards parses the Max-Forwards header from h (RFC 7231 Section 5.1.2).
+// If there is no such header in h, or it cannot be parsed, ok is false.
+// Values too large for an int are clamped to the largest int.
+func MaxForwards(h http.Header) (n int, ok bool) {
+	v := h.Get("Max-Forwards")
+	if v == "" {
+		return 0, false
+	}
+	for i := 0; i < len(v); i++ {
+		if v[i] < '0' || '9' < v[i] {
+			return 0, false
+		}
+		digit := int(v[i] - '0')
+		if n > (maxInt-digit)/10 {
+			n = maxInt
+			continue
+		}
+		n = n*10 + digit
+	}
+	return n, true
+}
+
+const maxInt = int(^uint(0) >> 1)
+
+// SetMaxForwards replaces the Max-Forwards header in h (RFC 7231 Section 5.1.2).
+func SetMaxForwards(h http.Header, n int) {
+	h.Set("Max-Forwards", strconv.Itoa(n))
+}
+
+// DecrementMaxForwards updates the Max-Forwards header in h as required of
+// an intermediary that is about to forward a TRACE or OPTIONS request
+// (RFC 7231 Section 5.1.2). If Max-Forwards is 0, DecrementMaxForwards leaves
+// it alone and returns false: the request must not be forwarded, and the
+// intermediary must respond to it as the final recipient. Otherwise, including
+// when h has no valid Max-Forwards, it returns true.
+func DecrementMaxForwards(h http.Header) (forward bool) {
+	n, ok := MaxForwards(h)
+	if !ok {
+		return true
+	}
+	if n == 0 {
+		return false
+	}
+	SetMaxForwards(h, n-1)
+	return true
+}
+
 // ContentType parses the Content-Type header from h (RFC 7231 Section 3.1.1.5),
 // returning the media type/subtype and any parameters.
 func ContentType(h http.Header) (mtype string, params map[string]string) {
@@ -198,6 +198,148 @@ func TestUserAgent(t *testing.T) {
 	}
 }
 
+func TestUserAgentComments(t *testing.T) {
+	header := http.Header{"User-Agent": {
+		"Foo/1.0 (Windows NT 10.0; Win64) (x64) Bar (Linux; (U; en-US); ) Baz () Qux",
+	}}
+	checkParse(t, header, []CommentedProduct{
+		{
+			Product{"Foo", "1.0", "Windows NT 10.0; Win64; x64"},
+			[]Comment{
+				{{Text: "Windows NT 10.0"}, {Text: "Win64"}},
+				{{Text: "x64"}},
+			},
+		},
+		{
+			Product{"Bar", "", "Linux; (U; en-US); "},
+			[]Comment{{
+				{Text: "Linux"},
+				{Text: "(U; en-US)", Nested: []Comment{{{Text: "U"}, {Text: "en-US"}}}},
+			}},
+		},
+		{Product{"Baz", "", ""}, []Comment{nil}},
+		{Product{"Qux", "", ""}, nil},
+	}, UserAgentComments(header))
+}
+
+func TestServerComments(t *testing.T) {
+	header := http.Header{"Server": {"nginx/1.17.1 (Ubuntu) (Lua) Linux"}}
+	checkParse(t, header, []CommentedProduct{
+		{Product{"nginx", "1.17.1", "Ubuntu; Lua"}, []Comment{{{Text: "Ubuntu"}}, {{Text: "Lua"}}}},
+		{Product{"Linux", "", ""}, nil},
+	}, ServerComments(header))
+	checkParse(t, http.Header{}, []CommentedProduct(nil), ServerComments(http.Header{}))
+}
+
+func TestParseComment(t *testing.T) {
+	tests := []struct {
+		input  string
+		result Comment
+	}{
+		{"", nil},
+		{"Linux", Comment{{Text: "Linux"}}},
+		{"Linux; U", Comment{{Text: "Linux"}, {Text: "U"}}},
+		{"(Linux; U)", Comment{{Text: "Linux"}, {Text: "U"}}},
+		{" Linux ;; U; ", Comment{{Text: "Linux"}, {Text: "U"}}},
+		{"KHTML, like Gecko", Comment{{Text: "KHTML, like Gecko"}}},
+		{
+			"J2ME/MIDP; Opera Mini/9.80 (S60; SymbOS; Opera Mobi/23.348; U; en) Presto/2.5.25",
+			Comment{
+				{Text: "J2ME/MIDP"},
+				{
+					Text: "Opera Mini/9.80 (S60; SymbOS; Opera Mobi/23.348; U; en) Presto/2.5.25",
+					Nested: []Comment{{
+						{Text: "S60"}, {Text: "SymbOS"}, {Text: "Opera Mobi/23.348"}, {Text: "U"}, {Text: "en"},
+					}},
+				},
+			},
+		},
+		{
+			"a; (b; (c; d)); e",
+			Comment{
+				{Text: "a"},
+				{Text: "(b; (c; d))", Nested: []Comment{{
+					{Text: "b"},
+					{Text: "(c; d)", Nested: []Comment{{{Text: "c"}, {Text: "d"}}}},
+				}}},
+				{Text: "e"},
+			},
+		},
+		{
+			"(a) (b)",
+			Comment{{Text: "(a) (b)", Nested: []Comment{{{Text: "a"}}, {{Text: "b"}}}}},
+		},
+		{
+			"a; (b; c",
+			Comment{{Text: "a"}, {Text: "(b; c", Nested: []Comment{{{Text: "b"}, {Text: "c"}}}}},
+		},
+		{"a); b", Comment{{Text: "a)"}, {Text: "b"}}},
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			checkParse(t, nil, test.result, ParseComment(test.input))
+		})
+	}
+}
+
+func ExampleVersion() {
+	for _, product := range []Product{
+		{Name: "MyApp", Version: "1.9.2"},
+		{Name: "MyApp", Version: "1.10.0"},
+	} {
+		fmt.Println(product.Version, product.Version < "1.10",
+			Version(product.Version).Compare("1.10") < 0)
+	}
+	// Output: 1.9.2 false true
+	// 1.10.0 false false
+}
+
+func TestVersionCompare(t *testing.T) {
+	tests := []struct {
+		v, w   Version
+		result int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.0", "1", 0},
+		{"1.0.0", "1", 0},
+		{"1.2", "1.10", -1},
+		{"10.0", "9.99", 1},
+		{"01.2", "1.2", 0},
+		{"v1.2.3", "1.2.3", 0},
+		{"V2", "1.9", 1},
+		{"124.0.6367.88", "124.0.6367.118", -1},
+		{"99999999999999999999999", "99999999999999999999998", 1},
+		{"1.0.0-alpha", "1.0.0", -1},
+		{"1.0.0-alpha", "1.0.0-alpha.1", -1},
+		{"1.0.0-alpha.1", "1.0.0-alpha.beta", -1},
+		{"1.0.0-alpha.beta", "1.0.0-beta", -1},
+		{"1.0.0-beta", "1.0.0-beta.2", -1},
+		{"1.0.0-beta.2", "1.0.0-beta.11", -1},
+		{"1.0.0-beta.11", "1.0.0-rc.1", -1},
+		{"1.0.0-rc.1", "1.0.0", -1},
+		{"1.0.0+20130313144700", "1.0.0", 0},
+		{"1.0.0-beta+exp.sha.5114f85", "1.0.0-beta", 0},
+		{"2.0b1", "2.0", 1},
+		{"2.0b1", "2.0b2", -1},
+		{"8.1.13.v20130916", "8.1.13.v20140101", -1},
+		{"1.x", "1.0", 1},
+		{"", "0", 0},
+		{"", "1", -1},
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			if actual := test.v.Compare(test.w); actual != test.result {
+				t.Errorf("%q.Compare(%q) = %d, expected %d",
+					test.v, test.w, actual, test.result)
+			}
+			if actual := test.w.Compare(test.v); actual != -test.result {
+				t.Errorf("%q.Compare(%q) = %d, expected %d",
+					test.w, test.v, actual, -test.result)
+			}
+		})
+	}
+}
+
 func ExampleSetUserAgent() {
 	header := http.Header{}
 	SetUserAgent(header, []Product{
@@ -386,6 +528,82 @@ func TestRetryAfterCurrentTime(t *testing.T) {
 	}
 }
 
+func TestMaxForwards(t *testing.T) {
+	tests := []struct {
+		header http.Header
+		n      int
+		ok     bool
+	}{
+		// Valid headers.
+		{http.Header{}, 0, false},
+		{http.Header{"Max-Forwards": {"0"}}, 0, true},
+		{http.Header{"Max-Forwards": {"10"}}, 10, true},
+		{http.Header{"Max-Forwards": {"00042"}}, 42, true},
+		{
+			http.Header{"Max-Forwards": {"999999999999999999999999999999"}},
+			maxInt,
+			true,
+		},
+
+		// Invalid headers.
+		// Precise outputs on them are not a guaranteed part of the API.
+		// They may change as convenient for the parsing code.
+		{http.Header{"Max-Forwards": {"-1"}}, 0, false},
+		{http.Header{"Max-Forwards": {"+5"}}, 0, false},
+		{http.Header{"Max-Forwards": {"5, 6"}}, 0, false},
+		{http.Header{"Max-Forwards": {"ten"}}, 0, false},
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			n, ok := MaxForwards(test.header)
+			checkParse(t, test.header, test.n, n, test.ok, ok)
+		})
+	}
+}
+
+func TestDecrementMaxForwards(t *testing.T) {
+	tests := []struct {
+		header  http.Header
+		forward bool
+		result  http.Header
+	}{
+		{
+			http.Header{},
+			true,
+			http.Header{},
+		},
+		{
+			http.Header{"Max-Forwards": {"5"}},
+			true,
+			http.Header{"Max-Forwards": {"4"}},
+		},
+		{
+			http.Header{"Max-Forwards": {"1"}},
+			true,
+			http.Header{"Max-Forwards": {"0"}},
+		},
+		{
+			http.Header{"Max-Forwards": {"0"}},
+			false,
+			http.Header{"Max-Forwards": {"0"}},
+		},
+		{
+			http.Header{"Max-Forwards": {"bogus"}},
+			true,
+			http.Header{"Max-Forwards": {"bogus"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			forward := DecrementMaxForwards(test.header)
+			if forward != test.forward {
+				t.Errorf("got forward=%v, expected %v", forward, test.forward)
+			}
+			checkGenerate(t, test.forward, test.result, test.header)
+		})
+	}
+}
+
 func TestContentType(t *testing.T) {
 	tests := []struct {
 		header http.Header
@@ -2,6 +2,7 @@ package httpheader
 
 import (
 	"net/http"
+	"sort"
 	"strings"
 )
 
@@ -11,8 +12,16 @@ import (
 // Realm is the value of the 'realm' parameter, if any. Sending an empty realm=""
 // is not supported, and any 'realm' key in Params is ignored.
 //
-// "Star" parameters like RFC 7616's 'username*' are not treated specially.
-// Call DecodeExtValue and EncodeExtValue manually if needed.
+// "Star" parameters like RFC 7616's 'username*' are decoded from RFC 8187
+// ext-value into Params (or Realm) under their plain name, which takes
+// precedence over the plain form, as in ContentDisposition and Link.
+// A 'name*' that cannot be decoded is ignored. The plain name is then recorded
+// in ExtParams, unless 'name' was also sent: in that case, 'name*' is also kept
+// in Params as sent, so that callers can detect the conflict.
+// When serializing, a parameter listed in ExtParams is sent only
+// in the 'name*' form; others are sent only in the plain form. A key in Params
+// that already ends with '*' is sent under that name, so its value must be
+// encoded with EncodeExtValue.
 //
 // Scheme names are case-insensitive according to RFC 7235, but many
 // implementations erroneously expect them to be in their canonical spelling
@@ -26,6 +35,10 @@ type Auth struct {
 	Token  string
 	Realm  string
 	Params map[string]string
+
+	// ExtParams contains the (lowercase) plain names of parameters
+	// that use only the 'name*' form.
+	ExtParams map[string]bool
 }
 
 // WWWAuthenticate parses the WWW-Authenticate header from h
@@ -100,7 +113,7 @@ func consumeAuth(v string, challenge bool) (Auth, string) {
 	var auth Auth
 	auth.Scheme, v = consumeItem(v)
 	auth.Scheme = foldAuthScheme(auth.Scheme)
-	maybeToken68 := true
+	maybeToken68 := allowsToken68(auth.Scheme)
 ParamsLoop:
 	for {
 		v = skipWS(v)
@@ -133,21 +146,57 @@ ParamsLoop:
 		maybeToken68 = false
 		var name, value string
 		name, value, v = consumeParam(v)
-		switch name {
-		case "":
+		if name == "" {
 			break ParamsLoop
-		case "realm":
-			auth.Realm = value
-		default:
-			if auth.Params == nil {
-				auth.Params = make(map[string]string)
-			}
-			auth.Params[name] = value
 		}
+		if auth.Params == nil {
+			auth.Params = make(map[string]string)
+		}
+		auth.Params[name] = value
 	}
+	decodeAuthVariforms(&auth)
 	return auth, v
 }
 
+// decodeAuthVariforms passes the parameters in auth.Params, as sent,
+// through insertVariform, and then moves 'realm' to auth.Realm.
+func decodeAuthVariforms(auth *Auth) {
+	sent := auth.Params
+	auth.Params = nil
+	// Plain forms go first, so that insertVariform lets 'name*' override them.
+	for name, value := range sent {
+		if !strings.HasSuffix(name, "*") {
+			auth.Params = insertVariform(auth.Params, name, value)
+		}
+	}
+	for name, value := range sent {
+		if !strings.HasSuffix(name, "*") {
+			continue
+		}
+		auth.Params = insertVariform(auth.Params, name, value)
+		if _, _, err := DecodeExtValue(value); err != nil {
+			continue // ignored by insertVariform
+		}
+		plainName := name[:len(name)-1]
+		if _, both := sent[plainName]; both {
+			// Some schemes (like Digest) must reject such input.
+			auth.Params[name] = value
+			continue
+		}
+		if auth.ExtParams == nil {
+			auth.ExtParams = make(map[string]bool)
+		}
+		auth.ExtParams[plainName] = true
+	}
+	if realm, ok := auth.Params["realm"]; ok {
+		auth.Realm = realm
+		delete(auth.Params, "realm")
+	}
+	if len(auth.Params) == 0 {
+		auth.Params = nil
+	}
+}
+
 func detectAuthParam(v string) bool {
 	// An auth-param always has an equal sign after the first token,
 	// but a challenge never does.
@@ -194,10 +243,13 @@ func buildAuth(challenge bool, auths ...Auth) string {
 		}
 		var wrote bool
 		if auth.Realm != "" {
-			// RFC 7235 page 6: ``For historical reasons, a sender MUST only
-			// generate the quoted-string syntax.''
-			write(b, " realm=")
-			writeQuoted(b, auth.Realm)
+			write(b, " ")
+			if !writeAuthExtParam(b, auth, "realm", auth.Realm) {
+				// RFC 7235 page 6: ``For historical reasons, a sender MUST only
+				// generate the quoted-string syntax.''
+				write(b, "realm=")
+				writeQuoted(b, auth.Realm)
+			}
 			wrote = true
 		}
 		for name, value := range auth.Params {
@@ -209,36 +261,73 @@ func buildAuth(challenge bool, auths ...Auth) string {
 			} else {
 				write(b, " ")
 			}
+			wrote = true
+			if writeAuthExtParam(b, auth, name, value) {
+				continue
+			}
 			write(b, name, "=")
 			if mustQuoteAuthParam(auth.Scheme, name, challenge) {
 				writeQuoted(b, value)
 			} else {
 				writeTokenOrQuoted(b, value)
 			}
-			wrote = true
 		}
 	}
 	return b.String()
 }
 
+// writeAuthExtParam writes the parameter with the given name and value
+// to b in the 'name*=ext-value' form, if auth.ExtParams asks for it,
+// and reports whether it did. Unlike writeVariform, it never sends both forms,
+// because some schemes (like Digest) forbid that.
+func writeAuthExtParam(b *strings.Builder, auth Auth, name, value string) bool {
+	if !auth.ExtParams[strings.ToLower(name)] {
+		return false
+	}
+	write(b, name, "*=")
+	writeExtValue(b, value, "")
+	return true
+}
+
 func mustQuoteAuthParam(scheme, param string, challenge bool) bool {
-	// RFC 7616 (pp. 9 and 10) requires that certain parameters always be quoted.
-	// (It also requires that some parameters never be quoted, but we can't
-	// do anything about that if the caller supplies a value that requires
-	// quoting.) To make things even worse, the 'qop' parameter gets
-	// both of these treatments, depending on whether it's in a challenge
-	// or in credentials.
-	if !strings.EqualFold(scheme, "Digest") {
+	// Some schemes require that certain parameters always be quoted.
+	// For example, RFC 7616 (pp. 9 and 10) does so for Digest. (It also
+	// requires that some parameters never be quoted, but we can't do anything
+	// about that if the caller supplies a value that requires quoting.)
+	// To make things even worse, Digest's 'qop' parameter gets both of these
+	// treatments, depending on whether it's in a challenge or in credentials.
+	info, ok := authSchemes[strings.ToLower(scheme)]
+	if !ok {
 		return false
 	}
-	switch strings.ToLower(param) {
-	case "cnonce", "domain", "nonce", "opaque", "realm", "response", "uri", "username":
+	if containsFold(info.Quoted, param) {
 		return true
-	case "qop":
-		return challenge
-	default:
-		return false
 	}
+	return challenge && containsFold(info.QuotedInChallenges, param)
+}
+
+func mustQuoteAuthInfoParam(param string) bool {
+	// Like mustQuoteAuthParam, but the scheme is implied.
+	for _, info := range authSchemes {
+		if containsFold(info.QuotedInInfo, param) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(list []string, s string) bool {
+	for _, elem := range list {
+		if strings.EqualFold(elem, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func allowsToken68(scheme string) bool {
+	info, ok := authSchemes[scheme]
+	return !ok || info.Token68
 }
 
 func foldAuthScheme(scheme string) string {
@@ -255,34 +344,130 @@ func unfoldAuthScheme(scheme string) string {
 		// Preserve spelling supplied by the caller.
 		return scheme
 	}
-	if canonical := knownSchemeUnfold[scheme]; canonical != "" {
-		return canonical
+	if info, ok := authSchemes[scheme]; ok {
+		return info.Name
 	}
 	return strings.Title(scheme)
 }
 
+// An AuthScheme describes an authentication scheme, such as those in
+// https://www.iana.org/assignments/http-authschemes/, for the purposes
+// of parsing and serializing Auth.
+type AuthScheme struct {
+	// Name is the canonical spelling of the scheme, such as "Digest".
+	Name string
+
+	// Token68 is true if the scheme may use the token68 form, such as
+	// in Basic credentials. If false, a lone token after the scheme
+	// is never parsed as Token.
+	Token68 bool
+
+	// Quoted lists parameters whose values are always sent as quoted strings,
+	// even when a token would do. QuotedInChallenges lists parameters that
+	// are quoted only in challenges, not in credentials.
+	Quoted             []string
+	QuotedInChallenges []string
+
+	// QuotedInInfo lists parameters that are always quoted
+	// in Authentication-Info and Proxy-Authentication-Info (RFC 7615).
+	// These headers carry no scheme, so the lists of all registered schemes
+	// apply to them together.
+	QuotedInInfo []string
+}
+
+// RegisterAuthScheme teaches this package about an authentication scheme,
+// replacing any previous information about a scheme with the same name
+// (compared case-insensitively). Unknown schemes are serialized with
+// strings.Title, may use token68, and have no parameters that must be quoted.
+//
+// RegisterAuthScheme is not safe to call concurrently with other functions
+// in this package. Call it from an init function.
+func RegisterAuthScheme(scheme AuthScheme) {
+	lower := strings.ToLower(scheme.Name)
+	knownSchemeFold[scheme.Name] = lower
+	authSchemes[lower] = scheme
+}
+
 var (
-	knownSchemeFold   = make(map[string]string)
-	knownSchemeUnfold = make(map[string]string)
+	knownSchemeFold = make(map[string]string)
+	authSchemes     = make(map[string]AuthScheme)
 )
 
 func init() {
 	// https://www.iana.org/assignments/http-authschemes/http-authschemes.xhtml
-	registered := []string{
-		"Basic",
-		"Bearer",
-		"Digest",
-		"HOBA",
-		"Mutual",
-		"Negotiate",
-		"OAuth",
-		"SCRAM-SHA-1",
-		"SCRAM-SHA-256",
-		"vapid",
+	// This package has always tried token68 for every scheme,
+	// so all of these keep Token68, even if they never use it.
+	for _, scheme := range []AuthScheme{
+		// RFC 7617 allows either form for 'charset', but all examples
+		// quote it, and some clients only recognize that.
+		{Name: "Basic", Token68: true, Quoted: []string{"charset"}},
+		{Name: "Bearer", Token68: true},
+		{
+			Name:    "Digest",
+			Token68: true,
+			Quoted: []string{"cnonce", "domain", "nonce", "opaque", "realm",
+				"response", "uri", "username"},
+			QuotedInChallenges: []string{"qop"},
+			// RFC 7616 Section 3.5. Its 'qop' and 'nc' are never quoted,
+			// so they are left to writeTokenOrQuoted.
+			QuotedInInfo: []string{"cnonce", "nextnonce", "rspauth"},
+		},
+		{Name: "DPoP", Token68: true},
+		{Name: "HOBA", Token68: true},
+		{Name: "Mutual", Token68: true},
+		{Name: "Negotiate", Token68: true},
+		{Name: "OAuth", Token68: true},
+		{Name: "SCRAM-SHA-1", Token68: true},
+		{Name: "SCRAM-SHA-256", Token68: true},
+		{Name: "vapid", Token68: true},
+	} {
+		RegisterAuthScheme(scheme)
+	}
+}
+
+// RankChallenges returns those of challenges, such as returned by
+// WWWAuthenticate, that the client can answer, best first. prefs lists
+// the schemes that the client supports, most preferred first, compared
+// case-insensitively; challenges for other schemes are dropped. If capable
+// is not nil, it is called for each remaining challenge and can reject it,
+// for example because of an unsupported algorithm. Challenges for the same
+// scheme keep their relative order.
+func RankChallenges(challenges []Auth, prefs []string, capable func(Auth) bool) []Auth {
+	type candidate struct {
+		Auth
+		rank int
 	}
-	for _, canonical := range registered {
-		lower := strings.ToLower(canonical)
-		knownSchemeFold[canonical] = lower
-		knownSchemeUnfold[lower] = canonical
+	var candidates []candidate
+	for _, challenge := range challenges {
+		for i, pref := range prefs {
+			if !strings.EqualFold(challenge.Scheme, pref) {
+				continue
+			}
+			if capable == nil || capable(challenge) {
+				candidates = append(candidates, candidate{challenge, i})
+			}
+			break
+		}
+	}
+	if candidates == nil {
+		return nil
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].rank < candidates[j].rank
+	})
+	ranked := make([]Auth, len(candidates))
+	for i, c := range candidates {
+		ranked[i] = c.Auth
+	}
+	return ranked
+}
+
+// ChooseChallenge returns the best challenge according to RankChallenges,
+// or false if there is none that the client can answer.
+func ChooseChallenge(challenges []Auth, prefs []string, capable func(Auth) bool) (Auth, bool) {
+	ranked := RankChallenges(challenges, prefs, capable)
+	if len(ranked) == 0 {
+		return Auth{}, false
 	}
+	return ranked[0], true
 }
@@ -1,8 +1,10 @@
 package httpheader
 
 import (
+	"fmt"
 	"net/http"
 	"os"
+	"reflect"
 	"testing"
 )
 
@@ -185,6 +187,15 @@ func TestWWWAuthenticate(t *testing.T) {
 				{Scheme: "baz", Token: "qux="},
 			},
 		},
+		{
+			// Registered schemes still accept token68, as they always did.
+			http.Header{"Www-Authenticate": {"Digest abc, HOBA def=, vapid ghi"}},
+			[]Auth{
+				{Scheme: "digest", Token: "abc"},
+				{Scheme: "hoba", Token: "def="},
+				{Scheme: "vapid", Token: "ghi"},
+			},
+		},
 		{
 			http.Header{"Www-Authenticate": {`Newauth realm="apps", type=1, title="Login to \"apps\"", Basic realm="simple"`}},
 			[]Auth{
@@ -202,6 +213,21 @@ func TestWWWAuthenticate(t *testing.T) {
 				},
 			},
 		},
+		{
+			http.Header{"Www-Authenticate": {`Newauth realm*=UTF-8''%C3%A9t%C3%A9, title*=UTF-8'en'Summer%20%E2%98%80, Basic realm="simple"`}},
+			[]Auth{
+				{
+					Scheme:    "newauth",
+					Realm:     "été",
+					Params:    map[string]string{"title": "Summer ☀"},
+					ExtParams: map[string]bool{"realm": true, "title": true},
+				},
+				{
+					Scheme: "basic",
+					Realm:  "simple",
+				},
+			},
+		},
 
 		// Invalid headers.
 		// Precise outputs on them are not a guaranteed part of the API.
@@ -308,6 +334,10 @@ func TestSetWWWAuthenticate(t *testing.T) {
 			},
 			http.Header{"Www-Authenticate": {`Digest realm="Hello1", domain="ururu", Digest realm="Hello2", Nonce="7YSRY5UV", Digest realm="Hello3", opaque="JW6jJuz4", Digest realm="Hello4", QOP="auth"`}},
 		},
+		{
+			[]Auth{{Scheme: "basic", Params: map[string]string{"charset": "UTF-8"}}},
+			http.Header{"Www-Authenticate": {`Basic charset="UTF-8"`}},
+		},
 		{
 			[]Auth{{Scheme: "Basic", Realm: `Hello, "lovely" world!`}},
 			http.Header{"Www-Authenticate": {`Basic realm="Hello, \"lovely\" world!"`}},
@@ -359,7 +389,7 @@ func TestWWWAuthenticateRoundTrip(t *testing.T) {
 				Scheme: "lower token",
 				Realm:  "quotable",
 				Params: map[string]string{
-					"lower token": "token | quotable | empty",
+					"lower token without *": "token | quotable | empty",
 				},
 			},
 		},
@@ -447,10 +477,55 @@ func TestAuthorization(t *testing.T) {
 				},
 			},
 		},
+		{
+			http.Header{"Authorization": {`Digest username*=UTF-8''J%C3%A4s%C3%B8n%20Doe, realm="api@example.org"`}},
+			Auth{
+				Scheme:    "digest",
+				Realm:     "api@example.org",
+				Params:    map[string]string{"username": "Jäsøn Doe"},
+				ExtParams: map[string]bool{"username": true},
+			},
+		},
+		{
+			// When both forms are present, the star form is preferred,
+			// but is also kept as sent.
+			http.Header{"Authorization": {`Digest username*=UTF-8''J%C3%A4s%C3%B8n%20Doe, username="Jason", realm="api@example.org"`}},
+			Auth{
+				Scheme: "digest",
+				Realm:  "api@example.org",
+				Params: map[string]string{
+					"username*": "UTF-8''J%C3%A4s%C3%B8n%20Doe",
+					"username":  "Jäsøn Doe",
+				},
+			},
+		},
+		{
+			http.Header{"Authorization": {`Foo realm="plain", realm*=UTF-8''%C3%A9t%C3%A9, title=Plain, title*=UTF-8''Summer%20%E2%98%80`}},
+			Auth{
+				Scheme: "foo",
+				Realm:  "été",
+				Params: map[string]string{
+					"realm*": "UTF-8''%C3%A9t%C3%A9",
+					"title":  "Summer ☀",
+					"title*": "UTF-8''Summer%20%E2%98%80",
+				},
+			},
+		},
 
 		// Invalid headers.
 		// Precise outputs on them are not a guaranteed part of the API.
 		// They may change as convenient for the parsing code.
+		{
+			http.Header{"Authorization": {`Foo bar*="not an ext-value"`}},
+			Auth{Scheme: "foo"},
+		},
+		{
+			http.Header{"Authorization": {`Foo bar=baz, bar*="not an ext-value"`}},
+			Auth{
+				Scheme: "foo",
+				Params: map[string]string{"bar": "baz"},
+			},
+		},
 		{
 			http.Header{"Authorization": {"Basic j.doe:secret123"}},
 			Auth{
@@ -570,8 +645,8 @@ func TestSetAuthorization(t *testing.T) {
 			http.Header{"Authorization": {"Foo nonce=abcde"}},
 		},
 		{
-			// As documented, we can use EncodeExtValue manually
-			// to send 'username*'.
+			// A key ending with '*' is sent under that name,
+			// so EncodeExtValue can be used to add a language tag.
 			Auth{
 				Scheme: "Digest",
 				Params: map[string]string{
@@ -580,6 +655,23 @@ func TestSetAuthorization(t *testing.T) {
 			},
 			http.Header{"Authorization": {`Digest username*=UTF-8'ru'%D0%92%D0%B0%D1%81%D1%8F%D0%BD`}},
 		},
+		{
+			Auth{
+				Scheme:    "Digest",
+				Params:    map[string]string{"username": "Васян"},
+				ExtParams: map[string]bool{"username": true},
+			},
+			http.Header{"Authorization": {`Digest username*=UTF-8''%D0%92%D0%B0%D1%81%D1%8F%D0%BD`}},
+		},
+		{
+			// ExtParams is also honored for realm.
+			Auth{
+				Scheme:    "Foo",
+				Realm:     "été",
+				ExtParams: map[string]bool{"realm": true},
+			},
+			http.Header{"Authorization": {`Foo realm*=UTF-8''%C3%A9t%C3%A9`}},
+		},
 	}
 	for _, test := range tests {
 		t.Run("", func(t *testing.T) {
@@ -602,8 +694,118 @@ func TestAuthorizationRoundTrip(t *testing.T) {
 			Scheme: "lower token",
 			Realm:  "quotable",
 			Params: map[string]string{
-				"lower token": "token | quotable | empty",
+				"lower token without *": "token | quotable | empty",
 			},
 		},
 	)
 }
+
+func ExampleChooseChallenge() {
+	header := http.Header{"Www-Authenticate": {
+		`Basic realm="example", ` +
+			`Digest realm="example", nonce="abc", algorithm=SHA-999, ` +
+			`Digest realm="example", nonce="def", algorithm=SHA-256, qop="auth"`,
+	}}
+	client := &DigestClient{Username: "Mufasa", Password: "Circle of Life"}
+	challenge, ok := ChooseChallenge(WWWAuthenticate(header),
+		[]string{"Digest", "Basic"},
+		func(challenge Auth) bool {
+			return challenge.Scheme == "basic" || client.CanAnswer(challenge)
+		})
+	fmt.Println(ok, challenge.Scheme, challenge.Params["nonce"])
+	// Output: true digest def
+}
+
+func TestRankChallenges(t *testing.T) {
+	challenges := []Auth{
+		{Scheme: "basic", Realm: "1"},
+		{Scheme: "newauth", Realm: "2"},
+		{Scheme: "digest", Realm: "3"},
+		{Scheme: "bearer", Realm: "4"},
+		{Scheme: "digest", Realm: "5"},
+	}
+	realms := func(ranked []Auth) []string {
+		var result []string
+		for _, challenge := range ranked {
+			result = append(result, challenge.Realm)
+		}
+		return result
+	}
+	tests := []struct {
+		prefs   []string
+		capable func(Auth) bool
+		result  []string
+	}{
+		{nil, nil, nil},
+		{[]string{"Digest"}, nil, []string{"3", "5"}},
+		{[]string{"Digest", "BASIC"}, nil, []string{"3", "5", "1"}},
+		{[]string{"bearer", "basic", "digest"}, nil, []string{"4", "1", "3", "5"}},
+		{[]string{"Digest", "Basic"}, func(challenge Auth) bool { return challenge.Realm != "3" },
+			[]string{"5", "1"}},
+		{[]string{"Digest"}, func(Auth) bool { return false }, nil},
+	}
+	for _, test := range tests {
+		ranked := RankChallenges(challenges, test.prefs, test.capable)
+		if actual := realms(ranked); !reflect.DeepEqual(actual, test.result) {
+			t.Errorf("%q: expected %q, got %q", test.prefs, test.result, actual)
+		}
+	}
+	if _, ok := ChooseChallenge(challenges, []string{"Negotiate"}, nil); ok {
+		t.Error("chose a challenge for an unoffered scheme")
+	}
+}
+
+func TestRegisterAuthScheme(t *testing.T) {
+	savedFold := make(map[string]string, len(knownSchemeFold))
+	for name, lower := range knownSchemeFold {
+		savedFold[name] = lower
+	}
+	savedSchemes := make(map[string]AuthScheme, len(authSchemes))
+	for lower, scheme := range authSchemes {
+		savedSchemes[lower] = scheme
+	}
+	defer func() {
+		knownSchemeFold, authSchemes = savedFold, savedSchemes
+	}()
+
+	RegisterAuthScheme(AuthScheme{
+		Name:               "X-TestAuth",
+		Quoted:             []string{"Id"},
+		QuotedInChallenges: []string{"mode"},
+	})
+	header := http.Header{}
+	SetWWWAuthenticate(header, []Auth{{
+		Scheme: "x-testauth",
+		Params: map[string]string{"id": "abc"},
+	}})
+	SetAuthorization(header, Auth{
+		Scheme: "x-testauth",
+		Params: map[string]string{"mode": "fast"},
+	})
+	checkGenerate(t, nil, http.Header{
+		"Www-Authenticate": {`X-TestAuth id="abc"`},
+		"Authorization":    {`X-TestAuth mode=fast`},
+	}, header)
+
+	// Without token68, a lone token is taken as an auth-param.
+	header = http.Header{
+		"Www-Authenticate": {"X-TestAuth abc, X-TESTAUTH def="},
+		"Authorization":    {"x-testauth abc"},
+	}
+	checkParse(t, header,
+		[]Auth{
+			{Scheme: "x-testauth", Params: map[string]string{"abc": ""}},
+			{Scheme: "x-testauth", Params: map[string]string{"def": ""}},
+		}, WWWAuthenticate(header),
+		Auth{Scheme: "x-testauth", Params: map[string]string{"abc": ""}}, Authorization(header))
+
+	RegisterAuthScheme(AuthScheme{
+		Name:         "X-TestAuth",
+		QuotedInInfo: []string{"Sig"},
+	})
+	header = http.Header{}
+	SetAuthenticationInfo(header, map[string]string{"sig": "abc"})
+	checkGenerate(t, nil, http.Header{
+		"Authentication-Info": {`sig="abc"`},
+	}, header)
+}
@@ -0,0 +1,75 @@
+package httpheader
+
+import (
+	"net/http"
+	"strings"
+)
+
+// AuthenticationInfo parses the Authentication-Info header from h
+// (RFC 7615 Section 3), which carries additional information about
+// a successful authentication, such as Digest's rspauth. Unlike challenges
+// and credentials, it has no scheme: the parameters belong to the scheme
+// used in the request.
+func AuthenticationInfo(h http.Header) map[string]string {
+	return parseAuthInfo(h["Authentication-Info"])
+}
+
+// SetAuthenticationInfo replaces the Authentication-Info header in h
+// (RFC 7615 Section 3).
+func SetAuthenticationInfo(h http.Header, params map[string]string) {
+	setAuthInfo(h, "Authentication-Info", params)
+}
+
+// ProxyAuthenticationInfo parses the Proxy-Authentication-Info header from h
+// (RFC 7615 Section 4).
+func ProxyAuthenticationInfo(h http.Header) map[string]string {
+	return parseAuthInfo(h["Proxy-Authentication-Info"])
+}
+
+// SetProxyAuthenticationInfo replaces the Proxy-Authentication-Info header
+// in h (RFC 7615 Section 4).
+func SetProxyAuthenticationInfo(h http.Header, params map[string]string) {
+	setAuthInfo(h, "Proxy-Authentication-Info", params)
+}
+
+func parseAuthInfo(values []string) map[string]string {
+	var params map[string]string
+	for v, vs := iterElems("", values); v != ""; v, vs = iterElems(v, vs) {
+		var name, value string
+		name, value, v = consumeParam(v)
+		if name == "" {
+			continue
+		}
+		// Use only the first occurrence, like consumeParams.
+		if _, seen := params[name]; seen {
+			continue
+		}
+		if params == nil {
+			params = make(map[string]string)
+		}
+		params[name] = value
+	}
+	return params
+}
+
+func setAuthInfo(h http.Header, name string, params map[string]string) {
+	if len(params) == 0 {
+		h.Del(name)
+		return
+	}
+	b := &strings.Builder{}
+	var wrote bool
+	for param, value := range params {
+		if wrote {
+			write(b, ", ")
+		}
+		write(b, param, "=")
+		if mustQuoteAuthInfoParam(param) {
+			writeQuoted(b, value)
+		} else {
+			writeTokenOrQuoted(b, value)
+		}
+		wrote = true
+	}
+	h.Set(name, b.String())
+}
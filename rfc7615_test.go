@@ -0,0 +1,133 @@
+package httpheader
+
+import (
+	"net/http"
+	"os"
+	"testing"
+)
+
+func ExampleSetAuthenticationInfo() {
+	header := http.Header{}
+	SetAuthenticationInfo(header, map[string]string{
+		"rspauth": "6629fae49393a05397450978507c4ef1",
+	})
+	header.Write(os.Stdout)
+	// Output: Authentication-Info: rspauth="6629fae49393a05397450978507c4ef1"
+}
+
+func TestAuthenticationInfo(t *testing.T) {
+	tests := []struct {
+		header http.Header
+		result map[string]string
+	}{
+		// Valid headers.
+		{
+			http.Header{"Authentication-Info": {`nextnonce="47364c23432d2e131a5fb210812c"`}},
+			map[string]string{"nextnonce": "47364c23432d2e131a5fb210812c"},
+		},
+		{
+			http.Header{"Authentication-Info": {
+				`qop=auth, rspauth="6629fae49393a05397450978507c4ef1", cnonce="0a4f113b", nc=00000001`,
+			}},
+			map[string]string{
+				"qop":     "auth",
+				"rspauth": "6629fae49393a05397450978507c4ef1",
+				"cnonce":  "0a4f113b",
+				"nc":      "00000001",
+			},
+		},
+		{
+			http.Header{"Authentication-Info": {
+				`Foo = "bar, baz"`,
+				` ,Qux=xyzzy `,
+			}},
+			map[string]string{"foo": "bar, baz", "qux": "xyzzy"},
+		},
+
+		// Invalid headers.
+		// Precise outputs on them are not a guaranteed part of the API.
+		// They may change as convenient for the parsing code.
+		{
+			http.Header{"Authentication-Info": {""}},
+			nil,
+		},
+		{
+			http.Header{"Authentication-Info": {"foo, bar=baz"}},
+			map[string]string{"foo": "", "bar": "baz"},
+		},
+		{
+			http.Header{"Authentication-Info": {`Digest rspauth="abc"`}},
+			map[string]string{"digest": ""},
+		},
+		{
+			http.Header{"Authentication-Info": {`rspauth="abc`}},
+			map[string]string{"rspauth": "abc"},
+		},
+		{
+			http.Header{"Authentication-Info": {`rspauth="abc", RSPAUTH="def"`, `rspauth=ghi`}},
+			map[string]string{"rspauth": "abc"},
+		},
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			checkParse(t, test.header, test.result, AuthenticationInfo(test.header))
+		})
+	}
+}
+
+func TestSetAuthenticationInfo(t *testing.T) {
+	tests := []struct {
+		input  map[string]string
+		result http.Header
+	}{
+		{
+			nil,
+			http.Header{},
+		},
+		{
+			map[string]string{"nextnonce": "abc"},
+			http.Header{"Authentication-Info": {`nextnonce="abc"`}},
+		},
+		{
+			map[string]string{"cnonce": "0a4f113b"},
+			http.Header{"Authentication-Info": {`cnonce="0a4f113b"`}},
+		},
+		{
+			map[string]string{"nc": "00000001"},
+			http.Header{"Authentication-Info": {`nc=00000001`}},
+		},
+		{
+			map[string]string{"qop": "auth"},
+			http.Header{"Authentication-Info": {`qop=auth`}},
+		},
+		{
+			map[string]string{"foo": "bar baz"},
+			http.Header{"Authentication-Info": {`foo="bar baz"`}},
+		},
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			header := http.Header{"Authentication-Info": {"old"}}
+			SetAuthenticationInfo(header, test.input)
+			checkGenerate(t, test.input, test.result, header)
+		})
+	}
+}
+
+func TestProxyAuthenticationInfo(t *testing.T) {
+	header := http.Header{}
+	SetProxyAuthenticationInfo(header, map[string]string{"rspauth": "abc"})
+	checkGenerate(t, nil, http.Header{"Proxy-Authentication-Info": {`rspauth="abc"`}}, header)
+	checkParse(t, header,
+		map[string]string{"rspauth": "abc"}, ProxyAuthenticationInfo(header),
+		map[string]string(nil), AuthenticationInfo(header),
+	)
+}
+
+func TestAuthenticationInfoRoundTrip(t *testing.T) {
+	checkRoundTrip(t, SetAuthenticationInfo, AuthenticationInfo,
+		map[string]string{
+			"lower token": "token | quotable | empty",
+		},
+	)
+}
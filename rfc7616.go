@@ -0,0 +1,673 @@
+package httpheader
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A DigestServer authenticates requests with the Digest scheme (RFC 7616).
+// Realm and Password must be set; other fields have reasonable defaults.
+// A DigestServer must not be copied after first use. It is safe for
+// concurrent use by multiple goroutines.
+//
+// Nonces are stateless: they carry their issue time and are signed with Key.
+// However, to prevent replay, the server remembers the highest nonce count
+// (nc) seen for each nonce until the nonce expires.
+type DigestServer struct {
+	Realm string
+
+	// Password returns the password for username, or false if there is
+	// no such user.
+	Password func(username string) (password string, ok bool)
+
+	// Unhash, if not nil, enables hashed usernames (RFC 7616 Section 3.4.4).
+	// It returns the username whose DigestUserhash with the given algorithm
+	// is userhash, or false if there is none.
+	Unhash func(userhash, algorithm string) (username string, ok bool)
+
+	// Algorithms lists the algorithms to offer, in order of preference:
+	// "SHA-512-256", "SHA-256", "MD5", or any of them with "-sess".
+	// If empty, "SHA-256" and "MD5" are offered.
+	Algorithms []string
+
+	// QOP lists the qop values to offer: "auth" and/or "auth-int".
+	// If empty, only "auth" is offered. auth-int requires reading
+	// the entire request body into memory.
+	QOP []string
+
+	// MaxBodySize limits how many bytes of the request body Verify reads
+	// for auth-int. A request with a larger body fails verification.
+	// If zero, 10 MB is used, as in http.Request.ParseForm.
+	MaxBodySize int64
+
+	// Opaque is sent in challenges and must be returned by clients.
+	Opaque string
+
+	// NonceLifetime is how long a nonce remains valid. If zero,
+	// 5 minutes is used.
+	NonceLifetime time.Duration
+
+	// Key signs nonces. If nil, a random key is generated on first use,
+	// so nonces are only valid within one process.
+	Key []byte
+
+	// Proxy makes the server use Proxy-Authenticate, Proxy-Authorization
+	// and Proxy-Authentication-Info instead of the origin server headers.
+	Proxy bool
+
+	mu        sync.Mutex
+	counts    map[string]digestCount
+	nextPurge time.Time
+}
+
+type digestCount struct {
+	nc      uint64
+	expires time.Time
+}
+
+// ErrDigestStale is returned by DigestServer.Verify when the credentials
+// were valid but for an expired nonce. The client should be challenged
+// again with stale=true, which allows it to retry without prompting the user.
+var ErrDigestStale = errors.New("httpheader: stale Digest nonce")
+
+var errNoDigest = errors.New("httpheader: no Digest credentials")
+
+const (
+	defaultNonceLifetime = 5 * time.Minute
+	defaultMaxDigestBody = 10 << 20
+)
+
+// Challenges returns the challenges to send in WWW-Authenticate
+// (or Proxy-Authenticate) with a 401 (or 407) response, one for each
+// algorithm, sharing a fresh nonce. Set stale after Verify has returned
+// ErrDigestStale.
+func (s *DigestServer) Challenges(stale bool) ([]Auth, error) {
+	key, err := s.key()
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := newDigestNonce(key, s.Realm, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	qop := s.QOP
+	if len(qop) == 0 {
+		qop = []string{"auth"}
+	}
+	challenges := make([]Auth, 0, len(s.algorithms()))
+	for _, algorithm := range s.algorithms() {
+		params := map[string]string{
+			"nonce":     nonce,
+			"algorithm": algorithm,
+			"qop":       strings.Join(qop, ", "),
+			"charset":   "UTF-8",
+		}
+		if s.Opaque != "" {
+			params["opaque"] = s.Opaque
+		}
+		if s.Unhash != nil {
+			params["userhash"] = "true"
+		}
+		if stale {
+			params["stale"] = "true"
+		}
+		challenges = append(challenges, Auth{
+			Scheme: "digest",
+			Realm:  s.Realm,
+			Params: params,
+		})
+	}
+	return challenges, nil
+}
+
+func (s *DigestServer) algorithms() []string {
+	if len(s.Algorithms) == 0 {
+		return []string{"SHA-256", "MD5"}
+	}
+	return s.Algorithms
+}
+
+func (s *DigestServer) key() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Key == nil {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		s.Key = key
+	}
+	return s.Key, nil
+}
+
+func (s *DigestServer) lifetime() time.Duration {
+	if s.NonceLifetime == 0 {
+		return defaultNonceLifetime
+	}
+	return s.NonceLifetime
+}
+
+func (s *DigestServer) maxBodySize() int64 {
+	if s.MaxBodySize == 0 {
+		return defaultMaxDigestBody
+	}
+	return s.MaxBodySize
+}
+
+// Verify checks the Digest credentials in r. On success, it returns
+// a DigestAuth with the authenticated Username, which can then produce
+// Authentication-Info. On failure, the client should be challenged again;
+// if the error is ErrDigestStale, with stale=true.
+//
+// If qop=auth-int is used, Verify reads the entire r.Body (up to
+// MaxBodySize), and replaces it with a copy for further processing.
+func (s *DigestServer) Verify(r *http.Request) (*DigestAuth, error) {
+	var credentials Auth
+	if s.Proxy {
+		credentials = ProxyAuthorization(r.Header)
+	} else {
+		credentials = Authorization(r.Header)
+	}
+	if credentials.Scheme != "digest" {
+		return nil, errNoDigest
+	}
+	params := credentials.Params
+	if credentials.Realm != s.Realm {
+		return nil, fmt.Errorf("httpheader: bad Digest realm %q", credentials.Realm)
+	}
+	algorithm, ok := s.findAlgorithm(params["algorithm"])
+	if !ok {
+		return nil, fmt.Errorf("httpheader: unsupported Digest algorithm %q", params["algorithm"])
+	}
+	if params["opaque"] != s.Opaque {
+		return nil, errors.New("httpheader: bad Digest opaque")
+	}
+	qop := strings.ToLower(params["qop"])
+	if !s.offersQOP(qop) {
+		return nil, fmt.Errorf("httpheader: unsupported Digest qop %q", qop)
+	}
+	nc, err := strconv.ParseUint(params["nc"], 16, 32)
+	if err != nil || len(params["nc"]) != 8 || nc == 0 {
+		return nil, fmt.Errorf("httpheader: bad Digest nc %q", params["nc"])
+	}
+	if params["cnonce"] == "" {
+		return nil, errors.New("httpheader: missing Digest cnonce")
+	}
+	if params["uri"] != requestURI(r) {
+		return nil, fmt.Errorf("httpheader: uri %q in Digest credentials does not match request", params["uri"])
+	}
+
+	key, err := s.key()
+	if err != nil {
+		return nil, err
+	}
+	nonce := params["nonce"]
+	issued, ok := checkDigestNonce(key, s.Realm, nonce)
+	if !ok {
+		return nil, errors.New("httpheader: bad Digest nonce")
+	}
+	now := time.Now()
+	expires := issued.Add(s.lifetime())
+	stale := !now.Before(expires)
+
+	username, err := s.username(credentials, algorithm)
+	if err != nil {
+		return nil, err
+	}
+	password, ok := s.Password(username)
+	if !ok {
+		return nil, fmt.Errorf("httpheader: unknown Digest user %q", username)
+	}
+
+	auth := newDigestAuth(algorithm, username, s.Realm, password, nonce, params["cnonce"])
+	auth.QOP = qop
+	auth.nc = params["nc"]
+	auth.uri = params["uri"]
+	auth.proxy = s.Proxy
+	var body []byte
+	if qop == "auth-int" && r.Body != nil {
+		limit := s.maxBodySize()
+		if body, err = ioutil.ReadAll(io.LimitReader(r.Body, limit+1)); err != nil {
+			return nil, err
+		}
+		if int64(len(body)) > limit {
+			return nil, errors.New("httpheader: request body too large for Digest auth-int")
+		}
+		r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	expected := auth.response(r.Method, body)
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(strings.ToLower(params["response"]))) != 1 {
+		return nil, errors.New("httpheader: bad Digest response")
+	}
+	if stale {
+		return nil, ErrDigestStale
+	}
+	if !s.countNonce(nonce, nc, expires, now) {
+		return nil, errors.New("httpheader: replayed Digest nc")
+	}
+	return auth, nil
+}
+
+func (s *DigestServer) findAlgorithm(algorithm string) (string, bool) {
+	if algorithm == "" {
+		algorithm = "MD5"
+	}
+	for _, offered := range s.algorithms() {
+		if strings.EqualFold(offered, algorithm) {
+			return offered, true
+		}
+	}
+	return "", false
+}
+
+func (s *DigestServer) offersQOP(qop string) bool {
+	if len(s.QOP) == 0 {
+		return qop == "auth"
+	}
+	for _, offered := range s.QOP {
+		if strings.EqualFold(offered, qop) {
+			return true
+		}
+	}
+	return false
+}
+
+// username returns the actual username from the Digest credentials.
+func (s *DigestServer) username(credentials Auth, algorithm string) (string, error) {
+	params := credentials.Params
+	// Authorization keeps username* as sent only if username is also present.
+	if _, ok := params["username*"]; ok {
+		return "", errors.New("httpheader: both Digest username and username*")
+	}
+	if strings.EqualFold(params["userhash"], "true") {
+		// A hashed username is plain hex, and RFC 7616 Section 3.4
+		// does not allow username* together with userhash.
+		if credentials.ExtParams["username"] {
+			return "", errors.New("httpheader: Digest username* with userhash")
+		}
+		if s.Unhash == nil {
+			return "", errors.New("httpheader: unexpected Digest userhash")
+		}
+		username, ok := s.Unhash(strings.ToLower(params["username"]), algorithm)
+		if !ok {
+			return "", errors.New("httpheader: unknown Digest userhash")
+		}
+		return username, nil
+	}
+	return params["username"], nil
+}
+
+// countNonce records nc for nonce, returning false if it is not greater
+// than any previously recorded. It also forgets expired nonces.
+func (s *DigestServer) countNonce(nonce string, nc uint64, expires, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !now.Before(s.nextPurge) {
+		for seen, count := range s.counts {
+			if !now.Before(count.expires) {
+				delete(s.counts, seen)
+			}
+		}
+		s.nextPurge = now.Add(s.lifetime())
+	}
+	if count, ok := s.counts[nonce]; ok && nc <= count.nc {
+		return false
+	}
+	if s.counts == nil {
+		s.counts = make(map[string]digestCount)
+	}
+	s.counts[nonce] = digestCount{nc, expires}
+	return true
+}
+
+// newDigestNonce returns a nonce consisting of the issue time, random bytes,
+// and a MAC of these and the realm.
+func newDigestNonce(key []byte, realm string, now time.Time) (string, error) {
+	raw := make([]byte, 16, 32)
+	binary.BigEndian.PutUint64(raw, uint64(now.UnixNano()))
+	if _, err := rand.Read(raw[8:]); err != nil {
+		return "", err
+	}
+	raw = append(raw, digestNonceMAC(key, realm, raw)...)
+	return base64.StdEncoding.EncodeToString(raw), nil
+}
+
+func checkDigestNonce(key []byte, realm, nonce string) (issued time.Time, ok bool) {
+	raw, err := base64.StdEncoding.DecodeString(nonce)
+	if err != nil || len(raw) != 32 {
+		return time.Time{}, false
+	}
+	if !hmac.Equal(raw[16:], digestNonceMAC(key, realm, raw[:16])) {
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(raw))), true
+}
+
+func digestNonceMAC(key []byte, realm string, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	mac.Write([]byte(realm))
+	return mac.Sum(nil)[:16]
+}
+
+func requestURI(r *http.Request) string {
+	if r.RequestURI != "" {
+		return r.RequestURI
+	}
+	return r.URL.RequestURI()
+}
+
+// A DigestClient answers Digest challenges (RFC 7616) on behalf of one user.
+// It keeps track of the nonce count for the latest nonce, so the same
+// DigestClient should be used for all requests to a server. A new nonce
+// replaces the previous one, whose count is then forgotten. A DigestClient
+// must not be copied after first use, and is safe for concurrent use
+// by multiple goroutines.
+type DigestClient struct {
+	Username string
+	Password string
+
+	// Proxy makes the client use Proxy-Authorization and
+	// Proxy-Authentication-Info instead of the origin server headers.
+	Proxy bool
+
+	mu    sync.Mutex
+	nonce string
+	count uint64
+}
+
+// Authorize sets Digest credentials on r in response to challenge,
+// as returned by WWWAuthenticate (or ProxyAuthenticate). The resulting
+// DigestAuth can be used to check the server's Authentication-Info.
+//
+// qop=auth is preferred over auth-int when the server offers both.
+// For auth-int, the request body is obtained from r.GetBody, which must
+// not be nil if r has a body (http.NewRequest sets it for common body types).
+// If the challenge has no qop, the obsolete RFC 2069 computation is used.
+func (c *DigestClient) Authorize(r *http.Request, challenge Auth) (*DigestAuth, error) {
+	if !strings.EqualFold(challenge.Scheme, "digest") {
+		return nil, fmt.Errorf("httpheader: not a Digest challenge: %q", challenge.Scheme)
+	}
+	params := challenge.Params
+	algorithm, qop, err := digestChallenge(params)
+	if err != nil {
+		return nil, err
+	}
+	nonce := params["nonce"]
+
+	var cnonce, nc string
+	if qop != "" {
+		raw := make([]byte, 16)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		cnonce = base64.StdEncoding.EncodeToString(raw)
+		nc = fmt.Sprintf("%08x", c.nextCount(nonce))
+	}
+	auth := newDigestAuth(algorithm, c.Username, challenge.Realm, c.Password, nonce, cnonce)
+	auth.QOP = qop
+	auth.nc = nc
+	auth.uri = requestURI(r)
+	auth.proxy = c.Proxy
+	var body []byte
+	if qop == "auth-int" {
+		if body, err = requestBody(r); err != nil {
+			return nil, err
+		}
+	}
+
+	credentials := Auth{
+		Scheme: "digest",
+		Realm:  challenge.Realm,
+		Params: map[string]string{
+			"uri":       auth.uri,
+			"nonce":     nonce,
+			"algorithm": algorithm,
+			"response":  auth.response(r.Method, body),
+		},
+	}
+	switch {
+	case strings.EqualFold(params["userhash"], "true"):
+		credentials.Params["username"] = DigestUserhash(algorithm, c.Username, challenge.Realm)
+		credentials.Params["userhash"] = "true"
+	default:
+		credentials.Params["username"] = c.Username
+		if needsExtValue(c.Username) {
+			credentials.ExtParams = map[string]bool{"username": true}
+		}
+	}
+	if qop != "" {
+		credentials.Params["qop"] = qop
+		credentials.Params["nc"] = nc
+		credentials.Params["cnonce"] = cnonce
+	}
+	if opaque, ok := params["opaque"]; ok {
+		credentials.Params["opaque"] = opaque
+	}
+	if c.Proxy {
+		SetProxyAuthorization(r.Header, credentials)
+	} else {
+		SetAuthorization(r.Header, credentials)
+	}
+	return auth, nil
+}
+
+// requestBody returns a copy of the body of r, which is about to be sent,
+// without consuming it.
+func requestBody(r *http.Request) ([]byte, error) {
+	if r.GetBody == nil {
+		if r.Body == nil || r.Body == http.NoBody {
+			return nil, nil
+		}
+		// Hashing nothing would produce a wrong response,
+		// which the server would reject anyway.
+		return nil, errors.New("httpheader: Digest qop=auth-int needs r.GetBody to read the body")
+	}
+	rc, err := r.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return ioutil.ReadAll(rc)
+}
+
+// CanAnswer reports whether challenge is a Digest challenge with
+// an algorithm and qop that c supports. It returns false for any other scheme,
+// so when ranking challenges of several schemes with RankChallenges
+// or ChooseChallenge, combine it with checks for the other schemes
+// (see the ChooseChallenge example).
+func (c *DigestClient) CanAnswer(challenge Auth) bool {
+	if !strings.EqualFold(challenge.Scheme, "digest") {
+		return false
+	}
+	_, _, err := digestChallenge(challenge.Params)
+	return err == nil
+}
+
+func digestChallenge(params map[string]string) (algorithm, qop string, err error) {
+	algorithm = params["algorithm"]
+	if algorithm == "" {
+		algorithm = "MD5"
+	}
+	if _, _, ok := digestAlgorithm(algorithm); !ok {
+		return "", "", fmt.Errorf("httpheader: unsupported Digest algorithm %q", algorithm)
+	}
+	qop, ok := chooseDigestQOP(params["qop"])
+	if !ok {
+		return "", "", fmt.Errorf("httpheader: unsupported Digest qop %q", params["qop"])
+	}
+	return algorithm, qop, nil
+}
+
+func (c *DigestClient) nextCount(nonce string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if nonce != c.nonce {
+		c.nonce, c.count = nonce, 0
+	}
+	c.count++
+	return c.count
+}
+
+func chooseDigestQOP(offered string) (string, bool) {
+	if offered == "" {
+		return "", true
+	}
+	var authInt bool
+	for _, qop := range strings.Split(offered, ",") {
+		switch strings.ToLower(strings.TrimSpace(qop)) {
+		case "auth":
+			return "auth", true
+		case "auth-int":
+			authInt = true
+		}
+	}
+	return "auth-int", authInt
+}
+
+// needsExtValue reports whether username cannot be sent in a quoted-string
+// and must use username* instead (RFC 7616 Section 4).
+func needsExtValue(username string) bool {
+	for i := 0; i < len(username); i++ {
+		if byteClass[username[i]] == cUnsafe || username[i] >= 0x80 {
+			return true
+		}
+	}
+	return false
+}
+
+// DigestUserhash returns the hashed form of username for the given realm
+// and algorithm (RFC 7616 Section 3.4.4). A server that uses hashed usernames
+// can precompute these to implement DigestServer.Unhash.
+func DigestUserhash(algorithm, username, realm string) string {
+	newHash, _, ok := digestAlgorithm(algorithm)
+	if !ok {
+		return ""
+	}
+	return digestH(newHash, username+":"+realm)
+}
+
+// A DigestAuth represents one successful Digest authentication,
+// as returned by DigestServer.Verify or DigestClient.Authorize.
+type DigestAuth struct {
+	Username  string
+	Algorithm string
+	QOP       string
+
+	newHash func() hash.Hash
+	ha1     string
+	nonce   string
+	cnonce  string
+	nc      string
+	uri     string
+	proxy   bool
+}
+
+func newDigestAuth(algorithm, username, realm, password, nonce, cnonce string) *DigestAuth {
+	newHash, sess, _ := digestAlgorithm(algorithm)
+	ha1 := digestH(newHash, username+":"+realm+":"+password)
+	if sess {
+		ha1 = digestH(newHash, ha1+":"+nonce+":"+cnonce)
+	}
+	return &DigestAuth{
+		Username:  username,
+		Algorithm: algorithm,
+		newHash:   newHash,
+		ha1:       ha1,
+		nonce:     nonce,
+		cnonce:    cnonce,
+	}
+}
+
+// response computes the request-digest for method and, with auth-int,
+// body (RFC 7616 Section 3.4.1). An empty method gives rspauth instead
+// (RFC 7616 Section 3.5).
+func (a *DigestAuth) response(method string, body []byte) string {
+	a2 := method + ":" + a.uri
+	if a.QOP == "auth-int" {
+		a2 += ":" + digestH(a.newHash, string(body))
+	}
+	ha2 := digestH(a.newHash, a2)
+	if a.QOP == "" {
+		return digestH(a.newHash, a.ha1+":"+a.nonce+":"+ha2)
+	}
+	return digestH(a.newHash,
+		a.ha1+":"+a.nonce+":"+a.nc+":"+a.cnonce+":"+a.QOP+":"+ha2)
+}
+
+// SetInfo sets the Authentication-Info (or Proxy-Authentication-Info) header
+// in h, which proves to the client that the server knows the user's secret
+// (RFC 7616 Section 3.5). body is the response body, only needed with
+// qop=auth-int.
+func (a *DigestAuth) SetInfo(h http.Header, body []byte) {
+	params := map[string]string{"rspauth": a.response("", body)}
+	if a.QOP != "" {
+		params["qop"] = a.QOP
+		params["nc"] = a.nc
+		params["cnonce"] = a.cnonce
+	}
+	if a.proxy {
+		SetProxyAuthenticationInfo(h, params)
+	} else {
+		SetAuthenticationInfo(h, params)
+	}
+}
+
+// CheckInfo reports whether the Authentication-Info (or
+// Proxy-Authentication-Info) header in h, received in response to a request
+// authorized with a, proves that the server knows the user's secret.
+// body is the response body, only needed with qop=auth-int.
+func (a *DigestAuth) CheckInfo(h http.Header, body []byte) bool {
+	var params map[string]string
+	if a.proxy {
+		params = ProxyAuthenticationInfo(h)
+	} else {
+		params = AuthenticationInfo(h)
+	}
+	expected := a.response("", body)
+	actual := strings.ToLower(params["rspauth"])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(actual)) == 1
+}
+
+// digestAlgorithm returns the hash function for algorithm, and whether
+// it is a session variant.
+func digestAlgorithm(algorithm string) (newHash func() hash.Hash, sess, ok bool) {
+	algorithm = strings.ToUpper(algorithm)
+	if trimmed := strings.TrimSuffix(algorithm, "-SESS"); trimmed != algorithm {
+		algorithm, sess = trimmed, true
+	}
+	switch algorithm {
+	case "MD5":
+		return md5.New, sess, true
+	case "SHA-256":
+		return sha256.New, sess, true
+	case "SHA-512-256":
+		return sha512.New512_256, sess, true
+	}
+	return nil, false, false
+}
+
+func digestH(newHash func() hash.Hash, s string) string {
+	h := newHash()
+	h.Write([]byte(s))
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,458 @@
+package httpheader
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func ExampleDigestServer() {
+	server := &DigestServer{
+		Realm: "api@example.org",
+		Password: func(username string) (string, bool) {
+			return "Circle of Life", username == "Mufasa"
+		},
+	}
+	client := &DigestClient{Username: "Mufasa", Password: "Circle of Life"}
+
+	// The server challenges the client.
+	resp := http.Header{}
+	challenges, _ := server.Challenges(false)
+	SetWWWAuthenticate(resp, challenges)
+
+	// The client retries with credentials.
+	r, _ := http.NewRequest("GET", "http://api.example.org/dir/index.html", nil)
+	clientAuth, _ := client.Authorize(r, WWWAuthenticate(resp)[0])
+
+	// The server verifies them, and proves that it knows the password, too.
+	serverAuth, err := server.Verify(r)
+	if err != nil {
+		panic(err)
+	}
+	resp = http.Header{}
+	serverAuth.SetInfo(resp, nil)
+	fmt.Println(serverAuth.Username, serverAuth.Algorithm, clientAuth.CheckInfo(resp, nil))
+	// Output: Mufasa SHA-256 true
+}
+
+func TestDigestResponse(t *testing.T) {
+	tests := []struct {
+		algorithm, username, realm, password string
+		nonce, cnonce, nc, qop               string
+		method, uri, body                    string
+		result                               string
+	}{
+		// RFC 7616 Section 3.9.1.
+		{
+			"MD5", "Mufasa", "http-auth@example.org", "Circle of Life",
+			"7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v",
+			"f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ", "00000001", "auth",
+			"GET", "/dir/index.html", "",
+			"8ca523f5e9506fed4657c9700eebdbec",
+		},
+		{
+			"SHA-256", "Mufasa", "http-auth@example.org", "Circle of Life",
+			"7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v",
+			"f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ", "00000001", "auth",
+			"GET", "/dir/index.html", "",
+			"753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1",
+		},
+		// RFC 2617 Section 3.5.
+		{
+			"MD5", "Mufasa", "testrealm@host.com", "Circle Of Life",
+			"dcd98b7102dd2f0e8b11d0f600bfb0c093",
+			"0a4f113b", "00000001", "auth",
+			"GET", "/dir/index.html", "",
+			"6629fae49393a05397450978507c4ef1",
+		},
+		// RFC 2069, without qop.
+		{
+			"MD5", "Mufasa", "testrealm@host.com", "CircleOfLife",
+			"dcd98b7102dd2f0e8b11d0f600bfb0c093",
+			"", "", "",
+			"GET", "/dir/index.html", "",
+			"1949323746fe6a43ef61f9606e7febea",
+		},
+		// The following were computed with an independent implementation.
+		{
+			"SHA-512-256", "Jäsøn Doe", "api@example.org", "Secret, or not?",
+			"5TsQWLVdgBdmrQ0XsxbDODV+57QdFR34I9HAbC/RVvkK",
+			"NTg6RKcb9boFIAS3KrFK9BGeh+iDa/sm6jUMp2wds69v", "00000001", "auth",
+			"GET", "/doe.json", "",
+			"3798d4131c277846293534c3edc11bd8a5e4cdcbff78b05db9d95eeb1cec68a5",
+		},
+		{
+			"MD5-sess", "Mufasa", "http-auth@example.org", "Circle of Life",
+			"7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v",
+			"f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ", "00000001", "auth",
+			"GET", "/dir/index.html", "",
+			"e783283f46242139c486a698fec7211d",
+		},
+		{
+			"SHA-256", "Mufasa", "http-auth@example.org", "Circle of Life",
+			"7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v",
+			"f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ", "00000002", "auth-int",
+			"POST", "/dir/index.html", "Hello, world!",
+			"b4c91852220c91cb23546695d24854a6ade30a9fe080ef87a655faef212d8abd",
+		},
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			auth := newDigestAuth(test.algorithm, test.username, test.realm,
+				test.password, test.nonce, test.cnonce)
+			auth.QOP = test.qop
+			auth.nc = test.nc
+			auth.uri = test.uri
+			actual := auth.response(test.method, []byte(test.body))
+			if actual != test.result {
+				t.Errorf("%s response: expected %s, got %s",
+					test.algorithm, test.result, actual)
+			}
+		})
+	}
+}
+
+func TestDigestUserhash(t *testing.T) {
+	// Computed with an independent implementation.
+	actual := DigestUserhash("SHA-512-256", "Jäsøn Doe", "api@example.org")
+	expected := "793263caabb707a56211940d90411ea4a575adeccb7e360aeb624ed06ece9b0b"
+	if actual != expected {
+		t.Errorf("expected %s, got %s", expected, actual)
+	}
+	if actual := DigestUserhash("SHA-1", "Mufasa", "api@example.org"); actual != "" {
+		t.Errorf("unsupported algorithm: got %s", actual)
+	}
+}
+
+func newTestDigestServer() *DigestServer {
+	users := map[string]string{
+		"Mufasa":    "Circle of Life",
+		"Jäsøn Doe": "Secret, or not?",
+	}
+	return &DigestServer{
+		Realm: "api@example.org",
+		Password: func(username string) (string, bool) {
+			password, ok := users[username]
+			return password, ok
+		},
+		Opaque: "FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS",
+	}
+}
+
+// digestExchange runs one request through client and server, checking
+// Authentication-Info if the server accepts it.
+func digestExchange(t *testing.T, server *DigestServer, client *DigestClient,
+	method, body string) (*DigestAuth, error) {
+	t.Helper()
+	challenges, err := server.Challenges(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := http.Header{}
+	if server.Proxy {
+		SetProxyAuthenticate(resp, challenges)
+		challenges = ProxyAuthenticate(resp)
+	} else {
+		SetWWWAuthenticate(resp, challenges)
+		challenges = WWWAuthenticate(resp)
+	}
+	r, _ := http.NewRequest(method, "http://api.example.org/doe.json?q=1",
+		strings.NewReader(body))
+	clientAuth, err := client.Authorize(r, challenges[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("credentials: %v", r.Header)
+	serverAuth, err := server.Verify(r)
+	if err != nil {
+		return nil, err
+	}
+	if actual, _ := ioutil.ReadAll(r.Body); string(actual) != body {
+		t.Errorf("body after Verify: %q", actual)
+	}
+	info := http.Header{}
+	serverAuth.SetInfo(info, []byte("response body"))
+	t.Logf("info: %v", info)
+	if !clientAuth.CheckInfo(info, []byte("response body")) {
+		t.Errorf("CheckInfo failed on %v", info)
+	}
+	return serverAuth, nil
+}
+
+func TestDigestExchange(t *testing.T) {
+	tests := []struct {
+		algorithms []string
+		qop        []string
+		username   string
+		userhash   bool
+		proxy      bool
+		method     string
+		body       string
+	}{
+		{nil, nil, "Mufasa", false, false, "GET", ""},
+		{[]string{"MD5"}, nil, "Mufasa", false, false, "GET", ""},
+		{[]string{"SHA-512-256-sess"}, nil, "Mufasa", false, false, "GET", ""},
+		{[]string{"MD5-sess"}, []string{"auth-int"}, "Mufasa", false, false, "POST", "Hello, world!"},
+		{[]string{"SHA-256"}, []string{"auth", "auth-int"}, "Mufasa", false, false, "POST", "x"},
+		{nil, nil, "Jäsøn Doe", false, false, "GET", ""},
+		{[]string{"SHA-512-256"}, nil, "Jäsøn Doe", true, false, "GET", ""},
+		{nil, nil, "Mufasa", false, true, "GET", ""},
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			server := newTestDigestServer()
+			server.Algorithms = test.algorithms
+			server.QOP = test.qop
+			server.Proxy = test.proxy
+			if test.userhash {
+				server.Unhash = func(userhash, algorithm string) (string, bool) {
+					for _, username := range []string{"Mufasa", "Jäsøn Doe"} {
+						if DigestUserhash(algorithm, username, server.Realm) == userhash {
+							return username, true
+						}
+					}
+					return "", false
+				}
+			}
+			client := &DigestClient{
+				Username: test.username,
+				Password: "Circle of Life",
+				Proxy:    test.proxy,
+			}
+			if test.username == "Jäsøn Doe" {
+				client.Password = "Secret, or not?"
+			}
+			auth, err := digestExchange(t, server, client, test.method, test.body)
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if auth.Username != test.username {
+				t.Errorf("expected username %q, got %q", test.username, auth.Username)
+			}
+		})
+	}
+}
+
+func TestDigestWrongPassword(t *testing.T) {
+	server := newTestDigestServer()
+	client := &DigestClient{Username: "Mufasa", Password: "Circle of Death"}
+	if _, err := digestExchange(t, server, client, "GET", ""); err == nil {
+		t.Error("accepted wrong password")
+	}
+	client = &DigestClient{Username: "Scar", Password: "Circle of Life"}
+	if _, err := digestExchange(t, server, client, "GET", ""); err == nil {
+		t.Error("accepted unknown user")
+	}
+}
+
+func TestDigestMaxBodySize(t *testing.T) {
+	server := newTestDigestServer()
+	server.QOP = []string{"auth-int"}
+	server.MaxBodySize = 5
+	client := &DigestClient{Username: "Mufasa", Password: "Circle of Life"}
+	if _, err := digestExchange(t, server, client, "POST", "Hello"); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+	if _, err := digestExchange(t, server, client, "POST", "Hello!"); err == nil {
+		t.Error("accepted a body over MaxBodySize")
+	}
+}
+
+func TestDigestReplay(t *testing.T) {
+	server := newTestDigestServer()
+	client := &DigestClient{Username: "Mufasa", Password: "Circle of Life"}
+	challenges, _ := server.Challenges(false)
+	r, _ := http.NewRequest("GET", "http://api.example.org/", nil)
+	client.Authorize(r, challenges[0])
+	if _, err := server.Verify(r); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.Verify(r); err == nil {
+		t.Error("accepted replayed credentials")
+	}
+	// The next request with the same nonce has nc=00000002.
+	r, _ = http.NewRequest("GET", "http://api.example.org/", nil)
+	client.Authorize(r, challenges[0])
+	if params := Authorization(r.Header).Params; params["nc"] != "00000002" {
+		t.Errorf("expected nc=00000002, got %q", params["nc"])
+	}
+	if _, err := server.Verify(r); err != nil {
+		t.Error(err)
+	}
+	// A new nonce starts over, and replaces the old one.
+	fresh, _ := server.Challenges(false)
+	for _, challenge := range []Auth{fresh[0], challenges[0]} {
+		r, _ = http.NewRequest("GET", "http://api.example.org/", nil)
+		client.Authorize(r, challenge)
+		if params := Authorization(r.Header).Params; params["nc"] != "00000001" {
+			t.Errorf("expected nc=00000001, got %q", params["nc"])
+		}
+	}
+}
+
+func TestDigestStale(t *testing.T) {
+	server := newTestDigestServer()
+	client := &DigestClient{Username: "Mufasa", Password: "Circle of Life"}
+	key, _ := server.key()
+	nonce, _ := newDigestNonce(key, server.Realm, time.Now().Add(-time.Hour))
+	challenge := Auth{
+		Scheme: "digest",
+		Realm:  server.Realm,
+		Params: map[string]string{
+			"nonce":     nonce,
+			"algorithm": "SHA-256",
+			"qop":       "auth",
+			"opaque":    server.Opaque,
+		},
+	}
+	r, _ := http.NewRequest("GET", "http://api.example.org/", nil)
+	client.Authorize(r, challenge)
+	if _, err := server.Verify(r); err != ErrDigestStale {
+		t.Errorf("expected ErrDigestStale, got %v", err)
+	}
+	challenges, _ := server.Challenges(true)
+	if challenges[0].Params["stale"] != "true" {
+		t.Errorf("expected stale=true in %v", challenges[0])
+	}
+
+	// A forged nonce is not merely stale.
+	challenge.Params["nonce"] = strings.Replace(nonce, nonce[:4], "AAAA", 1)
+	r, _ = http.NewRequest("GET", "http://api.example.org/", nil)
+	client.Authorize(r, challenge)
+	if _, err := server.Verify(r); err == nil || err == ErrDigestStale {
+		t.Errorf("expected bad nonce, got %v", err)
+	}
+}
+
+func TestDigestVerifyInvalid(t *testing.T) {
+	server := newTestDigestServer()
+	challenges, _ := server.Challenges(false)
+	nonce := challenges[0].Params["nonce"]
+	tests := []string{
+		``,
+		`Basic QWxhZGRpbjpvcGVuIHNlc2FtZQ==`,
+		`Digest username="Mufasa", realm="other", nonce="` + nonce + `", uri="/", response="x", qop=auth, nc=00000001, cnonce="abc", algorithm=SHA-256, opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`,
+		`Digest username="Mufasa", realm="api@example.org", nonce="` + nonce + `", uri="/", response="x", qop=auth, nc=00000001, cnonce="abc", algorithm=SHA-1, opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`,
+		`Digest username="Mufasa", realm="api@example.org", nonce="` + nonce + `", uri="/", response="x", qop=auth, nc=00000001, cnonce="abc", algorithm=SHA-256`,
+		`Digest username="Mufasa", realm="api@example.org", nonce="` + nonce + `", uri="/", response="x", qop=auth-int, nc=00000001, cnonce="abc", algorithm=SHA-256, opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`,
+		`Digest username="Mufasa", realm="api@example.org", nonce="` + nonce + `", uri="/", response="x", algorithm=SHA-256, opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`,
+		`Digest username="Mufasa", realm="api@example.org", nonce="` + nonce + `", uri="/", response="x", qop=auth, nc=1, cnonce="abc", algorithm=SHA-256, opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`,
+		`Digest username="Mufasa", realm="api@example.org", nonce="` + nonce + `", uri="/", response="x", qop=auth, nc=00000001, algorithm=SHA-256, opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`,
+		`Digest username="Mufasa", realm="api@example.org", nonce="` + nonce + `", uri="/other", response="x", qop=auth, nc=00000001, cnonce="abc", algorithm=SHA-256, opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`,
+		`Digest username="Mufasa", realm="api@example.org", nonce="bm9uY2U=", uri="/", response="x", qop=auth, nc=00000001, cnonce="abc", algorithm=SHA-256, opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`,
+		`Digest username="Mufasa", userhash=true, realm="api@example.org", nonce="` + nonce + `", uri="/", response="x", qop=auth, nc=00000001, cnonce="abc", algorithm=SHA-256, opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`,
+		`Digest username*=UTF-8''Mufasa, userhash=true, realm="api@example.org", nonce="` + nonce + `", uri="/", response="x", qop=auth, nc=00000001, cnonce="abc", algorithm=SHA-256, opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`,
+		`Digest username="Mufasa", realm="api@example.org", nonce="` + nonce + `", uri="/", response="x", qop=auth, nc=00000001, cnonce="abc", algorithm=SHA-256, opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`,
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			r, _ := http.NewRequest("GET", "http://api.example.org/", nil)
+			r.Header.Set("Authorization", test)
+			if auth, err := server.Verify(r); err == nil {
+				t.Errorf("accepted %q: %+v", test, auth)
+			}
+		})
+	}
+}
+
+func TestDigestUsernameBothForms(t *testing.T) {
+	server := newTestDigestServer()
+	challenges, _ := server.Challenges(false)
+	client := &DigestClient{Username: "Mufasa", Password: "Circle of Life"}
+	r, _ := http.NewRequest("GET", "http://api.example.org/", nil)
+	if _, err := client.Authorize(r, challenges[0]); err != nil {
+		t.Fatal(err)
+	}
+	credentials := r.Header.Get("Authorization")
+	// RFC 7616 Section 3.4: "The client MUST NOT send both".
+	r.Header.Set("Authorization", credentials+", username*=UTF-8''Mufasa")
+	_, err := server.Verify(r)
+	if err == nil || !strings.Contains(err.Error(), "both Digest username and username*") {
+		t.Errorf("expected error about both username forms, got %v", err)
+	}
+	// Otherwise, the same credentials are fine.
+	r.Header.Set("Authorization", credentials)
+	if _, err := server.Verify(r); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+}
+
+func TestDigestClientCredentials(t *testing.T) {
+	challenge := Auth{
+		Scheme: "digest",
+		Realm:  "api@example.org",
+		Params: map[string]string{
+			"nonce":  "5TsQWLVdgBdmrQ0XsxbDODV+57QdFR34I9HAbC/RVvkK",
+			"qop":    "auth-int",
+			"opaque": "HRPCssKJSGjCrkzDg8OhwpzCiGPChXYjwrI2QmXDnsOS",
+		},
+	}
+	client := &DigestClient{Username: "Jäsøn Doe", Password: "Secret, or not?"}
+	body := []byte("Hello, world!")
+	r, _ := http.NewRequest("PUT", "http://api.example.org/doe.json", bytes.NewReader(body))
+	auth, err := client.Authorize(r, challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := Authorization(r.Header).Params
+	checkParse(t, r.Header,
+		"Jäsøn Doe", params["username"],
+		true, Authorization(r.Header).ExtParams["username"],
+		"MD5", params["algorithm"],
+		"auth-int", params["qop"],
+		"00000001", params["nc"],
+		"/doe.json", params["uri"],
+		challenge.Params["opaque"], params["opaque"],
+	)
+	auth.uri = "/doe.json"
+	if expected := auth.response("PUT", body); params["response"] != expected {
+		t.Errorf("expected response %s, got %s", expected, params["response"])
+	}
+
+	// Without GetBody, the body cannot be hashed.
+	r, _ = http.NewRequest("PUT", "http://api.example.org/doe.json", nil)
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if _, err := client.Authorize(r, challenge); err == nil {
+		t.Errorf("authorized auth-int without GetBody: %v", r.Header)
+	}
+	r, _ = http.NewRequest("DELETE", "http://api.example.org/doe.json", nil)
+	if _, err := client.Authorize(r, challenge); err != nil {
+		t.Errorf("Authorize without body: %v", err)
+	}
+
+	for _, challenge := range []Auth{
+		{Scheme: "basic", Realm: "api@example.org"},
+		{Scheme: "digest", Params: map[string]string{"algorithm": "SHA-1"}},
+		{Scheme: "digest", Params: map[string]string{"qop": "auth-conf"}},
+	} {
+		r, _ := http.NewRequest("GET", "http://api.example.org/", nil)
+		if _, err := client.Authorize(r, challenge); err == nil {
+			t.Errorf("accepted challenge %v", challenge)
+		}
+	}
+}
+
+func TestDigestCheckInfoInvalid(t *testing.T) {
+	auth := newDigestAuth("SHA-256", "Mufasa", "api@example.org", "Circle of Life",
+		"nonce", "cnonce")
+	auth.QOP, auth.nc, auth.uri = "auth", "00000001", "/"
+	good := http.Header{}
+	auth.SetInfo(good, nil)
+	tests := []http.Header{
+		{},
+		{"Authentication-Info": {`rspauth="0123"`}},
+		{"Authentication-Info": {`nextnonce="abc"`}},
+		{"Proxy-Authentication-Info": good["Authentication-Info"]},
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			if auth.CheckInfo(test, nil) {
+				t.Errorf("accepted %v", test)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package httpheader
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// BasicChallenge returns a challenge for the Basic scheme with the given realm
+// (RFC 7617 Section 2), to be sent with SetWWWAuthenticate. It includes
+// charset="UTF-8" (RFC 7617 Section 2.1), telling the client to encode
+// non-ASCII credentials as UTF-8 rather than in some legacy encoding.
+func BasicChallenge(realm string) Auth {
+	return Auth{
+		Scheme: "basic",
+		Realm:  realm,
+		Params: map[string]string{"charset": "UTF-8"},
+	}
+}
+
+// BasicCredentials returns credentials for the Basic scheme (RFC 7617
+// Section 2), to be sent with SetAuthorization. userID and password are
+// normalized to Unicode Normalization Form C and encoded as UTF-8
+// (RFC 7617 Section 2.1). It is an error for userID to contain a colon,
+// for either to contain control characters, or for either not to be
+// valid UTF-8.
+func BasicCredentials(userID, password string) (Auth, error) {
+	if !utf8.ValidString(userID) || !utf8.ValidString(password) {
+		return Auth{}, errors.New("httpheader: Basic credentials are not valid UTF-8")
+	}
+	userID, password = norm.NFC.String(userID), norm.NFC.String(password)
+	if strings.IndexByte(userID, ':') != -1 {
+		return Auth{}, fmt.Errorf("httpheader: Basic user-id %q contains a colon", userID)
+	}
+	if err := checkBasicText(userID, password); err != nil {
+		return Auth{}, err
+	}
+	token := base64.StdEncoding.EncodeToString([]byte(userID + ":" + password))
+	return Auth{Scheme: "basic", Token: token}, nil
+}
+
+// BasicUserPassword decodes credentials for the Basic scheme (RFC 7617
+// Section 2), such as returned by Authorization. The user-id ends at the first
+// colon; the rest is the password.
+//
+// Credentials must be UTF-8, as requested by BasicChallenge; anything else
+// is an error. The user-id and password are normalized to Unicode
+// Normalization Form C (RFC 7617 Section 2.1), so they can be compared
+// with those given to BasicCredentials.
+func BasicUserPassword(credentials Auth) (userID, password string, err error) {
+	if !strings.EqualFold(credentials.Scheme, "basic") {
+		return "", "", fmt.Errorf("httpheader: not Basic credentials: %q", credentials.Scheme)
+	}
+	raw, err := base64.StdEncoding.DecodeString(credentials.Token)
+	if err != nil {
+		return "", "", fmt.Errorf("httpheader: bad Basic credentials: %v", err)
+	}
+	if !utf8.Valid(raw) {
+		return "", "", errors.New("httpheader: bad Basic credentials: not valid UTF-8")
+	}
+	decoded := string(raw)
+	i := strings.IndexByte(decoded, ':')
+	if i == -1 {
+		return "", "", errors.New("httpheader: bad Basic credentials: no colon between user-id and password")
+	}
+	userID, password = decoded[:i], decoded[i+1:]
+	if err := checkBasicText(userID, password); err != nil {
+		return "", "", err
+	}
+	return norm.NFC.String(userID), norm.NFC.String(password), nil
+}
+
+// checkBasicText checks that userID and password contain no control
+// characters (RFC 7617 Section 2).
+func checkBasicText(userID, password string) error {
+	for _, s := range []string{userID, password} {
+		for i := 0; i < len(s); i++ {
+			if s[i] < 0x20 || s[i] == 0x7F {
+				return errors.New("httpheader: Basic credentials contain control characters")
+			}
+		}
+	}
+	return nil
+}
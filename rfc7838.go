@@ -0,0 +1,299 @@
+package httpheader
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// An AltSvcElem represents one alternative service advertised
+// in the Alt-Svc header (RFC 7838 Section 3).
+//
+// ProtocolID is the ALPN protocol ID, such as "h3" or "h2", already
+// percent-decoded. Host is empty if the alternative is on the same host
+// as the origin. MaxAge is absent if not specified, meaning 24 hours.
+// Any extension parameters are stored in Ext.
+type AltSvcElem struct {
+	ProtocolID string
+	Host       string
+	Port       int
+	MaxAge     Delta
+	Persist    bool
+	Ext        map[string]string
+}
+
+// AltSvc parses the Alt-Svc header from h (RFC 7838 Section 3). If clear
+// is true, the header has the special value ``clear'', which invalidates
+// all alternatives for the origin, and elems is nil. Alternatives whose
+// alt-authority is not a valid host and port are skipped.
+func AltSvc(h http.Header) (elems []AltSvcElem, clear bool) {
+	for v, vs := iterElems("", h["Alt-Svc"]); v != ""; v, vs = iterElems(v, vs) {
+		var id, authority string
+		id, v = consumeItem(v)
+		v = skipWS(v)
+		if peek(v) != '=' {
+			if id == "clear" {
+				clear = true
+			}
+			continue
+		}
+		authority, v = consumeItemOrQuoted(skipWS(v[1:]))
+		var elem AltSvcElem
+		elem.ProtocolID = id
+		if decoded, err := url.PathUnescape(id); err == nil {
+			elem.ProtocolID = decoded
+		}
+		var ok bool
+		elem.Host, elem.Port, ok = parseAltAuthority(authority)
+		for {
+			var name, value string
+			name, value, v = consumeParam(v)
+			if name == "" {
+				break
+			}
+			switch name {
+			case "ma":
+				if seconds, ok := parseLength(value); ok {
+					elem.MaxAge = DeltaSeconds(seconds)
+				}
+			case "persist":
+				// "This specification only defines a single value for
+				// "persist". Clients MUST ignore "persist" parameters with
+				// values other than "1"."
+				elem.Persist = value == "1"
+			default:
+				if elem.Ext == nil {
+					elem.Ext = make(map[string]string)
+				}
+				elem.Ext[name] = value
+			}
+		}
+		if !ok {
+			// Without a usable alt-authority, the alternative is useless.
+			continue
+		}
+		elems = append(elems, elem)
+	}
+	if clear {
+		elems = nil
+	}
+	return elems, clear
+}
+
+func parseAltAuthority(authority string) (host string, port int, ok bool) {
+	host, rawPort, err := net.SplitHostPort(authority)
+	if err != nil {
+		return "", 0, false
+	}
+	port, err = strconv.Atoi(rawPort)
+	if err != nil || rawPort[0] == '+' || port <= 0 || port > 65535 {
+		return "", 0, false
+	}
+	return host, port, true
+}
+
+// SetAltSvc replaces the Alt-Svc header in h (RFC 7838 Section 3).
+// If clear is true, the header is set to the special value ``clear'',
+// and elems must be empty.
+func SetAltSvc(h http.Header, elems []AltSvcElem, clear bool) {
+	switch {
+	case clear:
+		h.Set("Alt-Svc", "clear")
+	case len(elems) == 0:
+		h.Del("Alt-Svc")
+	default:
+		h.Set("Alt-Svc", buildAltSvc(elems))
+	}
+}
+
+// AddAltSvc is like SetAltSvc but appends instead of replacing.
+func AddAltSvc(h http.Header, elems ...AltSvcElem) {
+	if len(elems) == 0 {
+		return
+	}
+	h.Add("Alt-Svc", buildAltSvc(elems))
+}
+
+func buildAltSvc(elems []AltSvcElem) string {
+	b := &strings.Builder{}
+	for i, elem := range elems {
+		if i > 0 {
+			write(b, ", ")
+		}
+		writeProtocolID(b, elem.ProtocolID)
+		write(b, "=")
+		port := strconv.Itoa(elem.Port)
+		writeQuoted(b, net.JoinHostPort(elem.Host, port))
+		if elem.MaxAge.ok {
+			write(b, "; ma=", strconv.Itoa(elem.MaxAge.seconds))
+		}
+		if elem.Persist {
+			write(b, "; persist=1")
+		}
+		for name, value := range elem.Ext {
+			write(b, "; ")
+			writeParam(b, false, name, value)
+		}
+	}
+	return b.String()
+}
+
+// writeProtocolID percent-encodes id as required by RFC 7838 Section 3:
+// every octet that is not a tchar, as well as ``%'' itself.
+func writeProtocolID(b *strings.Builder, id string) {
+	const hex = "0123456789ABCDEF"
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if byteClass[c] == cTokenOK && c != '%' {
+			b.WriteByte(c)
+		} else {
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&0xF])
+		}
+	}
+}
+
+// An AltSvcCache remembers alternative services advertised by origins
+// (RFC 7838 Section 2.2), for use in a custom http.RoundTripper.
+// The zero value is an empty cache ready to use. It is safe for concurrent
+// use by multiple goroutines.
+type AltSvcCache struct {
+	mu      sync.Mutex
+	entries map[string][]altSvcEntry
+}
+
+type altSvcEntry struct {
+	elem    AltSvcElem
+	expires time.Time
+}
+
+// defaultAltSvcMaxAge is the freshness lifetime when ma is missing
+// (RFC 7838 Section 3.1).
+const defaultAltSvcMaxAge = 24 * time.Hour
+
+// Update processes the Alt-Svc header from a response h received at now from
+// origin, which is a URL like "https://example.com". Alternatives advertised
+// by a new header replace any that were cached for origin; ``clear'' removes
+// them. If h has no Alt-Svc header, the cache is unchanged.
+//
+// RFC 7838 Section 2.1 restricts which origins may advertise alternatives,
+// for example, it forbids changing hosts over unauthenticated connections.
+// Update does not check this.
+func (c *AltSvcCache) Update(origin string, h http.Header, now time.Time) {
+	if h["Alt-Svc"] == nil {
+		return
+	}
+	key, ok := serializeOrigin(origin)
+	if !ok {
+		return
+	}
+	elems, _ := AltSvc(h)
+	entries := make([]altSvcEntry, 0, len(elems))
+	for _, elem := range elems {
+		maxAge := defaultAltSvcMaxAge
+		if elem.MaxAge.ok {
+			maxAge, _ = elem.MaxAge.Value()
+		}
+		if maxAge > 0 {
+			entries = append(entries, altSvcEntry{elem, now.Add(maxAge)})
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(entries) == 0 {
+		delete(c.entries, key)
+		return
+	}
+	if c.entries == nil {
+		c.entries = make(map[string][]altSvcEntry)
+	}
+	c.entries[key] = entries
+}
+
+// Lookup returns the alternatives for origin that are still fresh at now,
+// in order of the server's preference. Host is filled in with the origin's
+// host where it was omitted. Expired alternatives are removed from the cache.
+func (c *AltSvcCache) Lookup(origin string, now time.Time) []AltSvcElem {
+	key, ok := serializeOrigin(origin)
+	if !ok {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entries := c.entries[key]
+	fresh := entries[:0]
+	var elems []AltSvcElem
+	for _, entry := range entries {
+		if !now.Before(entry.expires) {
+			continue
+		}
+		fresh = append(fresh, entry)
+		elem := entry.elem
+		elem.Host = altSvcHost(key, elem)
+		elems = append(elems, elem)
+	}
+	if len(fresh) == 0 {
+		delete(c.entries, key)
+	} else {
+		c.entries[key] = fresh
+	}
+	return elems
+}
+
+// Remove forgets an alternative for origin, such as after a failed
+// connection to it. elem is matched by ProtocolID, Host and Port.
+func (c *AltSvcCache) Remove(origin string, elem AltSvcElem) {
+	key, ok := serializeOrigin(origin)
+	if !ok {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entries := c.entries[key]
+	kept := entries[:0]
+	for _, entry := range entries {
+		if entry.elem.ProtocolID != elem.ProtocolID || entry.elem.Port != elem.Port ||
+			!strings.EqualFold(altSvcHost(key, entry.elem), altSvcHost(key, elem)) {
+			kept = append(kept, entry)
+		}
+	}
+	if len(kept) == 0 {
+		delete(c.entries, key)
+	} else {
+		c.entries[key] = kept
+	}
+}
+
+// altSvcHost returns the host of elem, which defaults to that of origin.
+func altSvcHost(origin string, elem AltSvcElem) string {
+	if elem.Host != "" {
+		return elem.Host
+	}
+	u, _ := url.Parse(origin)
+	return u.Hostname()
+}
+
+// NetworkChanged removes all alternatives without Persist, as clients should
+// do when their network configuration changes (RFC 7838 Section 2.2).
+func (c *AltSvcCache) NetworkChanged() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, entries := range c.entries {
+		kept := entries[:0]
+		for _, entry := range entries {
+			if entry.elem.Persist {
+				kept = append(kept, entry)
+			}
+		}
+		if len(kept) == 0 {
+			delete(c.entries, key)
+		} else {
+			c.entries[key] = kept
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package httpheader
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func ExampleAltSvc() {
+	header := http.Header{"Alt-Svc": {`h3=":443"; ma=86400, h3-29=":443"`}}
+	elems, _ := AltSvc(header)
+	for _, elem := range elems {
+		fmt.Println(elem.ProtocolID, elem.Port)
+	}
+	// Output: h3 443
+	// h3-29 443
+}
+
+func ExampleSetAltSvc() {
+	header := http.Header{}
+	SetAltSvc(header, []AltSvcElem{
+		{ProtocolID: "h3", Port: 443, MaxAge: DeltaSeconds(3600), Persist: true},
+		{ProtocolID: "h2", Host: "alt.example.com", Port: 8443},
+	}, false)
+	header.Write(os.Stdout)
+	// Output: Alt-Svc: h3=":443"; ma=3600; persist=1, h2="alt.example.com:8443"
+}
+
+func TestAltSvc(t *testing.T) {
+	tests := []struct {
+		header http.Header
+		result []AltSvcElem
+		clear  bool
+	}{
+		// Valid headers.
+		{
+			http.Header{"Alt-Svc": {"clear"}},
+			nil,
+			true,
+		},
+		{
+			http.Header{"Alt-Svc": {`h2="alt.example.com:8000", h2=":443"`}},
+			[]AltSvcElem{
+				{ProtocolID: "h2", Host: "alt.example.com", Port: 8000},
+				{ProtocolID: "h2", Port: 443},
+			},
+			false,
+		},
+		{
+			http.Header{"Alt-Svc": {
+				`w%3D%3D="[2001:db8::1]:443";ma=2592000;persist=1`,
+				`h3=":443"; MA=60; persist=2; foo="bar, baz"`,
+			}},
+			[]AltSvcElem{
+				{
+					ProtocolID: "w==",
+					Host:       "2001:db8::1",
+					Port:       443,
+					MaxAge:     DeltaSeconds(2592000),
+					Persist:    true,
+				},
+				{
+					ProtocolID: "h3",
+					Port:       443,
+					MaxAge:     DeltaSeconds(60),
+					Ext:        map[string]string{"foo": "bar, baz"},
+				},
+			},
+			false,
+		},
+
+		// Invalid headers.
+		// Precise outputs on them are not a guaranteed part of the API.
+		// They may change as convenient for the parsing code.
+		{
+			http.Header{"Alt-Svc": {`h3=":443", clear`}},
+			nil,
+			true,
+		},
+		{
+			http.Header{"Alt-Svc": {`h3=443; ma=-1, %zz=":8443"; ma=-1`}},
+			[]AltSvcElem{{ProtocolID: "%zz", Port: 8443}},
+			false,
+		},
+		{
+			http.Header{"Alt-Svc": {
+				`h3=":abc"; foo="bar, h2=:443", h2=":0", h2=":65536", h2=":+1"`,
+				`h2="", h2="[2001:db8::1]", h3-29=":443"`,
+			}},
+			[]AltSvcElem{{ProtocolID: "h3-29", Port: 443}},
+			false,
+		},
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			elems, clear := AltSvc(test.header)
+			checkParse(t, test.header, test.result, elems, test.clear, clear)
+		})
+	}
+}
+
+func TestSetAltSvc(t *testing.T) {
+	tests := []struct {
+		elems  []AltSvcElem
+		clear  bool
+		result http.Header
+	}{
+		{
+			nil,
+			false,
+			http.Header{},
+		},
+		{
+			nil,
+			true,
+			http.Header{"Alt-Svc": {"clear"}},
+		},
+		{
+			[]AltSvcElem{
+				{ProtocolID: "w==", Host: "2001:db8::1", Port: 443, MaxAge: DeltaSeconds(0)},
+				{ProtocolID: "h3", Port: 443, Ext: map[string]string{"foo": "bar baz"}},
+			},
+			false,
+			http.Header{"Alt-Svc": {
+				`w%3D%3D="[2001:db8::1]:443"; ma=0, h3=":443"; foo="bar baz"`,
+			}},
+		},
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			header := http.Header{}
+			SetAltSvc(header, test.elems, test.clear)
+			checkGenerate(t, test.elems, test.result, header)
+			elems, clear := AltSvc(header)
+			checkParse(t, header, test.elems, elems, test.clear, clear)
+		})
+	}
+}
+
+func TestAddAltSvc(t *testing.T) {
+	header := http.Header{}
+	AddAltSvc(header)
+	AddAltSvc(header, AltSvcElem{ProtocolID: "h2", Port: 443})
+	AddAltSvc(header, AltSvcElem{ProtocolID: "h3", Port: 443})
+	checkGenerate(t, nil, http.Header{"Alt-Svc": {`h2=":443"`, `h3=":443"`}}, header)
+}
+
+func TestAltSvcCache(t *testing.T) {
+	var cache AltSvcCache
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	const origin = "https://www.example.com"
+	check := func(origin string, at time.Time, expected ...AltSvcElem) {
+		t.Helper()
+		checkParse(t, nil, expected, cache.Lookup(origin, at))
+	}
+
+	check(origin, now)
+	cache.Update(origin, http.Header{"Alt-Svc": {
+		`h3=":443"; ma=60, h2="alt.example.com:443"; persist=1, h3-29=":443"; ma=0`,
+	}}, now)
+	h3 := AltSvcElem{ProtocolID: "h3", Host: "www.example.com", Port: 443, MaxAge: DeltaSeconds(60)}
+	h2 := AltSvcElem{ProtocolID: "h2", Host: "alt.example.com", Port: 443, Persist: true}
+	check(origin, now, h3, h2)
+	check("https://WWW.example.com:443/some/path", now.Add(59*time.Second), h3, h2)
+	check("http://www.example.com", now)
+	check(origin, now.Add(60*time.Second), h2)
+	check(origin, now.Add(24*time.Hour))
+
+	// Headers without Alt-Svc don't change anything,
+	// a new Alt-Svc replaces the old one, and clear removes everything.
+	cache.Update(origin, http.Header{"Alt-Svc": {`h3=":443", h2=":8443"; persist=1`}}, now)
+	cache.Update(origin, http.Header{}, now)
+	h3.MaxAge = Delta{}
+	h2 = AltSvcElem{ProtocolID: "h2", Host: "www.example.com", Port: 8443, Persist: true}
+	check(origin, now, h3, h2)
+	cache.Update(origin, http.Header{"Alt-Svc": {"clear"}}, now)
+	check(origin, now)
+
+	cache.Update(origin, http.Header{"Alt-Svc": {`h3=":443", h2=":8443"; persist=1`}}, now)
+	cache.NetworkChanged()
+	check(origin, now, h2)
+	cache.Remove(origin, AltSvcElem{ProtocolID: "h2", Port: 8443})
+	check(origin, now)
+
+	cache.Update(origin, http.Header{"Alt-Svc": {`h3=":443"`}}, now)
+	cache.Remove(origin, AltSvcElem{ProtocolID: "h3", Host: "other.example.com", Port: 443})
+	check(origin, now, h3)
+	cache.Remove(origin, AltSvcElem{ProtocolID: "h3", Host: "WWW.example.com", Port: 443})
+	check(origin, now)
+
+	// IPv6 origins keep their brackets, so ports are not confused with
+	// the address.
+	cache.Update("https://[2001:db8::1]:8443", http.Header{"Alt-Svc": {`h3=":443"`}}, now)
+	h3 = AltSvcElem{ProtocolID: "h3", Host: "2001:db8::1", Port: 443}
+	check("https://[2001:DB8::1]:8443/", now, h3)
+	check("https://[2001:db8::1:8443]", now)
+}
@@ -0,0 +1,474 @@
+package httpheader
+
+import (
+	"encoding/base64"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// This file implements Structured Field Values for HTTP (RFC 8941),
+// which are used by many newer headers. The API is internal; each header
+// maps these generic values to its own convenient structures.
+
+// An sfItem is an Item or an Inner List (RFC 8941 Section 3.1.1, 3.3).
+// For an Item, value is one of int64, float64 (Decimal), string,
+// sfToken, []byte, or bool. For an Inner List, value is []sfItem.
+type sfItem struct {
+	value  interface{}
+	params []sfParam
+}
+
+type sfParam struct {
+	key   string
+	value interface{}
+}
+
+// An sfMember is a member of a Dictionary (RFC 8941 Section 3.2).
+type sfMember struct {
+	key string
+	sfItem
+}
+
+type sfToken string
+
+// param returns the value of the parameter with the given key, or nil.
+func (item sfItem) param(key string) interface{} {
+	for _, p := range item.params {
+		if p.key == key {
+			return p.value
+		}
+	}
+	return nil
+}
+
+// sfInput combines multiple header lines into one value for parsing
+// (RFC 8941 Section 4.2).
+func sfInput(values []string) string {
+	return strings.Join(values, ",")
+}
+
+// parseSFList parses a List (RFC 8941 Section 4.2.1). If the header is invalid,
+// it returns false, in which case the entire header must be ignored.
+func parseSFList(values []string) ([]sfItem, bool) {
+	v := skipSP(sfInput(values))
+	var list []sfItem
+	for v != "" {
+		var item sfItem
+		var ok bool
+		if item, v, ok = consumeSFMember(v); !ok {
+			return nil, false
+		}
+		list = append(list, item)
+		if v = skipWS(v); v == "" {
+			break
+		}
+		if v[0] != ',' {
+			return nil, false
+		}
+		if v = skipWS(v[1:]); v == "" {
+			return nil, false
+		}
+	}
+	return list, true
+}
+
+// parseSFDictionary parses a Dictionary (RFC 8941 Section 4.2.2). If a key
+// is repeated, the last value wins, but the position of the first is kept.
+func parseSFDictionary(values []string) ([]sfMember, bool) {
+	v := skipSP(sfInput(values))
+	var dict []sfMember
+	for v != "" {
+		var member sfMember
+		var ok bool
+		if member.key, v, ok = consumeSFKey(v); !ok {
+			return nil, false
+		}
+		if peek(v) == '=' {
+			if member.sfItem, v, ok = consumeSFMember(v[1:]); !ok {
+				return nil, false
+			}
+		} else {
+			member.value = true
+			if member.params, v, ok = consumeSFParams(v); !ok {
+				return nil, false
+			}
+		}
+		dict = setSFMember(dict, member)
+		if v = skipWS(v); v == "" {
+			break
+		}
+		if v[0] != ',' {
+			return nil, false
+		}
+		if v = skipWS(v[1:]); v == "" {
+			return nil, false
+		}
+	}
+	return dict, true
+}
+
+func setSFMember(dict []sfMember, member sfMember) []sfMember {
+	for i := range dict {
+		if dict[i].key == member.key {
+			dict[i] = member
+			return dict
+		}
+	}
+	return append(dict, member)
+}
+
+// parseSFItem parses an Item (RFC 8941 Section 4.2.3).
+func parseSFItem(values []string) (sfItem, bool) {
+	item, v, ok := consumeSFItem(skipSP(sfInput(values)))
+	if !ok || skipSP(v) != "" {
+		return sfItem{}, false
+	}
+	return item, true
+}
+
+func skipSP(v string) string {
+	return strings.TrimLeft(v, " ")
+}
+
+func consumeSFMember(v string) (item sfItem, newv string, ok bool) {
+	if peek(v) == '(' {
+		return consumeSFInnerList(v)
+	}
+	return consumeSFItem(v)
+}
+
+func consumeSFInnerList(v string) (item sfItem, newv string, ok bool) {
+	v = v[1:]
+	items := []sfItem{}
+	for v != "" {
+		v = skipSP(v)
+		if peek(v) == ')' {
+			item.value = items
+			item.params, v, ok = consumeSFParams(v[1:])
+			return item, v, ok
+		}
+		var inner sfItem
+		if inner, v, ok = consumeSFItem(v); !ok {
+			return item, v, false
+		}
+		items = append(items, inner)
+		if c := peek(v); c != ' ' && c != ')' {
+			return item, v, false
+		}
+	}
+	return item, v, false
+}
+
+func consumeSFItem(v string) (item sfItem, newv string, ok bool) {
+	if item.value, v, ok = consumeSFBareItem(v); !ok {
+		return item, v, false
+	}
+	item.params, v, ok = consumeSFParams(v)
+	return item, v, ok
+}
+
+func consumeSFParams(v string) (params []sfParam, newv string, ok bool) {
+	for peek(v) == ';' {
+		var p sfParam
+		if p.key, v, ok = consumeSFKey(skipSP(v[1:])); !ok {
+			return nil, v, false
+		}
+		p.value = true
+		if peek(v) == '=' {
+			if p.value, v, ok = consumeSFBareItem(v[1:]); !ok {
+				return nil, v, false
+			}
+		}
+		params = setSFParam(params, p)
+	}
+	return params, v, true
+}
+
+func setSFParam(params []sfParam, p sfParam) []sfParam {
+	for i := range params {
+		if params[i].key == p.key {
+			params[i] = p
+			return params
+		}
+	}
+	return append(params, p)
+}
+
+func consumeSFKey(v string) (key, newv string, ok bool) {
+	if c := peek(v); !(c >= 'a' && c <= 'z' || c == '*') {
+		return "", v, false
+	}
+	i := 1
+	for i < len(v) && isSFKeyChar(v[i]) {
+		i++
+	}
+	return v[:i], v[i:], true
+}
+
+func isSFKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= '0' && c <= '9' ||
+		c == '_' || c == '-' || c == '.' || c == '*'
+}
+
+func consumeSFBareItem(v string) (value interface{}, newv string, ok bool) {
+	c := peek(v)
+	switch {
+	case c == '-' || c >= '0' && c <= '9':
+		return consumeSFNumber(v)
+	case c == '"':
+		return consumeSFString(v)
+	case c == '*' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z':
+		return consumeSFToken(v)
+	case c == ':':
+		return consumeSFBinary(v)
+	case c == '?':
+		if len(v) >= 2 && (v[1] == '0' || v[1] == '1') {
+			return v[1] == '1', v[2:], true
+		}
+	}
+	return nil, v, false
+}
+
+func consumeSFNumber(v string) (value interface{}, newv string, ok bool) {
+	i := 0
+	if v[0] == '-' {
+		i++
+	}
+	if i == len(v) || v[i] < '0' || v[i] > '9' {
+		return nil, v, false
+	}
+	start, dot := i, -1
+	for ; i < len(v); i++ {
+		c := v[i]
+		if c == '.' && dot == -1 {
+			if i-start > 12 {
+				return nil, v, false
+			}
+			dot = i
+			continue
+		}
+		if c < '0' || c > '9' {
+			break
+		}
+	}
+	text, newv := v[:i], v[i:]
+	switch {
+	case dot == -1:
+		if i-start > 15 {
+			return nil, v, false
+		}
+		n, err := strconv.ParseInt(text, 10, 64)
+		return n, newv, err == nil
+	case dot == i-1 || i-dot-1 > 3:
+		return nil, v, false
+	}
+	f, err := strconv.ParseFloat(text, 64)
+	return f, newv, err == nil
+}
+
+func consumeSFString(v string) (value interface{}, newv string, ok bool) {
+	b := &strings.Builder{}
+	for i := 1; i < len(v); i++ {
+		switch c := v[i]; {
+		case c == '\\':
+			i++
+			if i == len(v) || v[i] != '"' && v[i] != '\\' {
+				return nil, v, false
+			}
+			b.WriteByte(v[i])
+		case c == '"':
+			return b.String(), v[i+1:], true
+		case c < 0x20 || c > 0x7E:
+			return nil, v, false
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return nil, v, false
+}
+
+func consumeSFToken(v string) (value interface{}, newv string, ok bool) {
+	i := 1
+	for i < len(v) && (byteClass[v[i]] == cTokenOK || v[i] == ':' || v[i] == '/') {
+		i++
+	}
+	return sfToken(v[:i]), v[i:], true
+}
+
+func consumeSFBinary(v string) (value interface{}, newv string, ok bool) {
+	end := strings.IndexByte(v[1:], ':')
+	if end == -1 {
+		return nil, v, false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(v[1 : end+1])
+	if err != nil {
+		return nil, v, false
+	}
+	return decoded, v[end+2:], true
+}
+
+// writeSFList serializes a List (RFC 8941 Section 4.1.1).
+func writeSFList(b *strings.Builder, list []sfItem) {
+	for i, item := range list {
+		if i > 0 {
+			write(b, ", ")
+		}
+		writeSFMember(b, item)
+	}
+}
+
+// writeSFDictionary serializes a Dictionary (RFC 8941 Section 4.1.2).
+func writeSFDictionary(b *strings.Builder, dict []sfMember) {
+	for i, member := range dict {
+		if i > 0 {
+			write(b, ", ")
+		}
+		write(b, member.key)
+		if member.value == true {
+			writeSFParams(b, member.params)
+		} else {
+			write(b, "=")
+			writeSFMember(b, member.sfItem)
+		}
+	}
+}
+
+func writeSFMember(b *strings.Builder, item sfItem) {
+	items, ok := item.value.([]sfItem)
+	if !ok {
+		writeSFItem(b, item)
+		return
+	}
+	write(b, "(")
+	for i, inner := range items {
+		if i > 0 {
+			write(b, " ")
+		}
+		writeSFItem(b, inner)
+	}
+	write(b, ")")
+	writeSFParams(b, item.params)
+}
+
+// writeSFItem serializes an Item (RFC 8941 Section 4.1.3).
+func writeSFItem(b *strings.Builder, item sfItem) {
+	writeSFBareItem(b, item.value)
+	writeSFParams(b, item.params)
+}
+
+func writeSFParams(b *strings.Builder, params []sfParam) {
+	for _, p := range params {
+		write(b, ";", p.key)
+		if p.value != true {
+			write(b, "=")
+			writeSFBareItem(b, p.value)
+		}
+	}
+}
+
+func writeSFBareItem(b *strings.Builder, value interface{}) {
+	switch value := value.(type) {
+	case int64:
+		write(b, strconv.FormatInt(value, 10))
+	case float64:
+		write(b, formatSFDecimal(value))
+	case string:
+		write(b, `"`)
+		for i := 0; i < len(value); i++ {
+			// An sf-string can only hold printable ASCII, with no way
+			// to escape anything else, so drop it (as documented
+			// in the package doc).
+			if value[i] < 0x20 || value[i] > 0x7E {
+				continue
+			}
+			if value[i] == '"' || value[i] == '\\' {
+				b.WriteByte('\\')
+			}
+			b.WriteByte(value[i])
+		}
+		write(b, `"`)
+	case sfToken:
+		write(b, string(value))
+	case []byte:
+		write(b, ":", base64.StdEncoding.EncodeToString(value), ":")
+	case bool:
+		if value {
+			write(b, "?1")
+		} else {
+			write(b, "?0")
+		}
+	}
+}
+
+// formatSFDecimal serializes a Decimal, rounding it to three fractional
+// digits (RFC 8941 Section 4.1.5).
+func formatSFDecimal(f float64) string {
+	f = math.RoundToEven(f*1000) / 1000
+	s := strconv.FormatFloat(f, 'f', -1, 64)
+	if !strings.Contains(s, ".") {
+		s += ".0"
+	}
+	return s
+}
+
+type sfType int
+
+const (
+	sfTypeList sfType = iota + 1
+	sfTypeDictionary
+	sfTypeItem
+)
+
+// sfFieldTypes maps the names of header fields known to be Structured Fields,
+// canonicalized with http.CanonicalHeaderKey, to their top-level types.
+var sfFieldTypes = map[string]sfType{
+	"Accept-Ch":                   sfTypeList,
+	"Cache-Status":                sfTypeList,
+	"Content-Digest":              sfTypeDictionary,
+	"Critical-Ch":                 sfTypeList,
+	"Permissions-Policy":          sfTypeDictionary,
+	"Priority":                    sfTypeDictionary,
+	"Proxy-Status":                sfTypeList,
+	"Repr-Digest":                 sfTypeDictionary,
+	"Sec-Ch-Ua":                   sfTypeList,
+	"Sec-Ch-Ua-Arch":              sfTypeItem,
+	"Sec-Ch-Ua-Full-Version-List": sfTypeList,
+	"Sec-Ch-Ua-Mobile":            sfTypeItem,
+	"Sec-Ch-Ua-Model":             sfTypeItem,
+	"Sec-Ch-Ua-Platform":          sfTypeItem,
+	"Sec-Ch-Ua-Platform-Version":  sfTypeItem,
+	"Signature":                   sfTypeDictionary,
+	"Signature-Input":             sfTypeDictionary,
+	"Want-Content-Digest":         sfTypeDictionary,
+	"Want-Repr-Digest":            sfTypeDictionary,
+}
+
+// reserializeSF parses values as a Structured Field of type typ and
+// serializes it back in canonical form.
+func reserializeSF(typ sfType, values []string) (string, bool) {
+	b := &strings.Builder{}
+	switch typ {
+	case sfTypeList:
+		list, ok := parseSFList(values)
+		if !ok {
+			return "", false
+		}
+		writeSFList(b, list)
+	case sfTypeDictionary:
+		dict, ok := parseSFDictionary(values)
+		if !ok {
+			return "", false
+		}
+		writeSFDictionary(b, dict)
+	case sfTypeItem:
+		item, ok := parseSFItem(values)
+		if !ok {
+			return "", false
+		}
+		writeSFItem(b, item)
+	default:
+		return "", false
+	}
+	return b.String(), true
+}
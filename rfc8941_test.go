@@ -0,0 +1,150 @@
+package httpheader
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSFList(t *testing.T) {
+	tests := []struct {
+		input  []string
+		result string
+		ok     bool
+	}{
+		// Examples from RFC 8941, with canonical serializations.
+		{[]string{"sugar, tea, rum"}, "sugar, tea, rum", true},
+		{[]string{"sugar", "tea, rum"}, "sugar, tea, rum", true},
+		{[]string{`("foo" "bar"), ("baz"), ("bat" "one"), ()`}, `("foo" "bar"), ("baz"), ("bat" "one"), ()`, true},
+		{[]string{`("foo"; a=1;b=2);lvl=5, ("bar" "baz");lvl=1`}, `("foo";a=1;b=2);lvl=5, ("bar" "baz");lvl=1`, true},
+		{[]string{"abc;a=1;b=2; cde_456, (ghi;jk=4 l);q=\"9\";r=w"}, "abc;a=1;b=2;cde_456, (ghi;jk=4 l);q=\"9\";r=w", true},
+		{[]string{"1;a=?1;b=?0, -42, 4.5, -0.25, 1.000"}, "1;a;b=?0, -42, 4.5, -0.25, 1.0", true},
+		{[]string{`"hello \"world\"", "back\\slash"`}, `"hello \"world\"", "back\\slash"`, true},
+		{[]string{"foo123/456, *t:x, :cHJldGVuZCB0aGlzIGlzIGJpbmFyeSBjb250ZW50Lg==:"}, "foo123/456, *t:x, :cHJldGVuZCB0aGlzIGlzIGJpbmFyeSBjb250ZW50Lg==:", true},
+		{[]string{"  a ,\tb  "}, "a, b", true},
+		{[]string{""}, "", true},
+		{nil, "", true},
+
+		// Invalid lists.
+		{[]string{"a,"}, "", false},
+		{[]string{"a, ,b"}, "", false},
+		{[]string{"a b"}, "", false},
+		{[]string{"(a b"}, "", false},
+		{[]string{"(a,b)"}, "", false},
+		{[]string{"1234567890123456"}, "", false},
+		{[]string{"1234567890123.0"}, "", false},
+		{[]string{"1.2345"}, "", false},
+		{[]string{"1."}, "", false},
+		{[]string{"-"}, "", false},
+		{[]string{"-.5"}, "", false},
+		{[]string{`"bad \n escape"`}, "", false},
+		{[]string{"\"unterminated"}, "", false},
+		{[]string{"\"non-ASCII \xc3\xa9\""}, "", false},
+		{[]string{":not base64!:"}, "", false},
+		{[]string{"?2"}, "", false},
+		{[]string{"a;B=1"}, "", false},
+		{[]string{"\ta"}, "", false},
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			list, ok := parseSFList(test.input)
+			if !test.ok {
+				if ok {
+					t.Errorf("%q: parsed invalid list as %#v", test.input, list)
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("%q: failed to parse", test.input)
+			}
+			b := &strings.Builder{}
+			writeSFList(b, list)
+			if b.String() != test.result {
+				t.Errorf("%q: serialized as %q, wanted %q", test.input, b.String(), test.result)
+			}
+		})
+	}
+}
+
+func TestSFDictionary(t *testing.T) {
+	tests := []struct {
+		input  []string
+		result string
+	}{
+		{[]string{`en="Applepie", da=:w4ZibGV0w6ZydGUK:`}, `en="Applepie", da=:w4ZibGV0w6ZydGUK:`},
+		{[]string{"a=?0, b, c; foo=bar"}, "a=?0, b, c;foo=bar"},
+		{[]string{"rating=1.5, feelings=(joy sadness)"}, "rating=1.5, feelings=(joy sadness)"},
+		{[]string{"a=(1 2), b=3, c=4;aa=bb, d=(5 6);valid"}, "a=(1 2), b=3, c=4;aa=bb, d=(5 6);valid"},
+		{[]string{"a=1, b=2", "a=3"}, "a=3, b=2"},
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			dict, ok := parseSFDictionary(test.input)
+			if !ok {
+				t.Fatalf("%q: failed to parse", test.input)
+			}
+			b := &strings.Builder{}
+			writeSFDictionary(b, dict)
+			if b.String() != test.result {
+				t.Errorf("%q: serialized as %q, wanted %q", test.input, b.String(), test.result)
+			}
+		})
+	}
+	for _, input := range []string{"A=1", "a=1,", "a=", "a=1 b=2", "a=1,,b=2"} {
+		if dict, ok := parseSFDictionary([]string{input}); ok {
+			t.Errorf("%q: parsed invalid dictionary as %#v", input, dict)
+		}
+	}
+}
+
+func TestSFItem(t *testing.T) {
+	item, ok := parseSFItem([]string{` 5.5;foo="bar" `})
+	if !ok || item.value != 5.5 || item.param("foo") != "bar" || item.param("baz") != nil {
+		t.Errorf("got %#v, %v", item, ok)
+	}
+	for _, input := range []string{"", "1, 2", "(1 2)", "a b"} {
+		if item, ok := parseSFItem([]string{input}); ok {
+			t.Errorf("%q: parsed invalid item as %#v", input, item)
+		}
+	}
+}
+
+func TestWriteSFString(t *testing.T) {
+	tests := []struct {
+		input  string
+		result string
+	}{
+		{"", `""`},
+		{`say "hi" \ bye`, `"say \"hi\" \\ bye"`},
+		{"caf\u00e9 \u2013 na\u00efve", `"caf  nave"`},
+		{"tab\tand\r\nnewline\x7f", `"tabandnewline"`},
+	}
+	for _, test := range tests {
+		b := &strings.Builder{}
+		writeSFBareItem(b, test.input)
+		if got := b.String(); got != test.result {
+			t.Errorf("%q: got %s, wanted %s", test.input, got, test.result)
+		}
+		if _, ok := parseSFItem([]string{b.String()}); !ok {
+			t.Errorf("%q: serialized to invalid %s", test.input, b.String())
+		}
+	}
+}
+
+func TestFormatSFDecimal(t *testing.T) {
+	tests := []struct {
+		input  float64
+		result string
+	}{
+		{0, "0.0"},
+		{1.5, "1.5"},
+		{-2.25, "-2.25"},
+		{0.0005, "0.0"},
+		{0.0015, "0.002"},
+		{123.4567, "123.457"},
+	}
+	for _, test := range tests {
+		if got := formatSFDecimal(test.input); got != test.result {
+			t.Errorf("%v: got %q, wanted %q", test.input, got, test.result)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package httpheader
+
+import (
+	"net/http"
+	"strings"
+)
+
+// AcceptCH parses the Accept-CH header from h (RFC 8942 Section 3.1),
+// which lists the client hints that a server wants to receive. Names are
+// canonicalized with http.CanonicalHeaderKey. As with all Structured Fields
+// (RFC 8941), if the header is invalid, nil is returned.
+func AcceptCH(h http.Header) []string {
+	return parseSFNames(h["Accept-Ch"])
+}
+
+// SetAcceptCH replaces the Accept-CH header in h (RFC 8942 Section 3.1).
+// Names are sent in lowercase. Remember that the response then varies
+// on these hints (see AddVary).
+func SetAcceptCH(h http.Header, names []string) {
+	setSFNames(h, "Accept-Ch", names)
+}
+
+// CriticalCH parses the Critical-CH header from h (RFC 8942 Section 3.1;
+// draft-davidben-http-client-hint-reliability Section 3), which lists
+// the client hints without which the client should retry the request.
+// See AcceptCH for details.
+func CriticalCH(h http.Header) []string {
+	return parseSFNames(h["Critical-Ch"])
+}
+
+// SetCriticalCH replaces the Critical-CH header in h. Every name must also
+// be listed in Accept-CH.
+func SetCriticalCH(h http.Header, names []string) {
+	setSFNames(h, "Critical-Ch", names)
+}
+
+func parseSFNames(values []string) []string {
+	if values == nil {
+		return nil
+	}
+	list, ok := parseSFList(values)
+	if !ok {
+		return nil
+	}
+	names := make([]string, 0, len(list))
+	for _, item := range list {
+		if token, ok := item.value.(sfToken); ok {
+			names = append(names, http.CanonicalHeaderKey(string(token)))
+		}
+	}
+	return names
+}
+
+func setSFNames(h http.Header, name string, names []string) {
+	if len(names) == 0 {
+		h.Del(name)
+		return
+	}
+	list := make([]sfItem, len(names))
+	for i, name := range names {
+		list[i].value = sfToken(strings.ToLower(name))
+	}
+	b := &strings.Builder{}
+	writeSFList(b, list)
+	h.Set(name, b.String())
+}
+
+// SecCHUA parses the Sec-CH-UA header from h (WICG User-Agent Client Hints,
+// Section 3.1), which lists the brands of the user agent with their
+// significant versions. Each brand is returned as a Product, with an empty
+// Comment, so that it can be handled in the same way as UserAgent.
+// Note that the list usually includes a deliberately meaningless
+// ``GREASE'' brand, such as "Not-A.Brand".
+func SecCHUA(h http.Header) []Product {
+	return parseBrands(h["Sec-Ch-Ua"])
+}
+
+// SetSecCHUA replaces the Sec-CH-UA header in h (WICG User-Agent Client Hints,
+// Section 3.1). Comments in brands are ignored.
+func SetSecCHUA(h http.Header, brands []Product) {
+	setBrands(h, "Sec-Ch-Ua", brands)
+}
+
+// SecCHUAFullVersionList parses the Sec-CH-UA-Full-Version-List header from h
+// (WICG User-Agent Client Hints, Section 3.6). It is like SecCHUA,
+// but with full versions.
+func SecCHUAFullVersionList(h http.Header) []Product {
+	return parseBrands(h["Sec-Ch-Ua-Full-Version-List"])
+}
+
+// SetSecCHUAFullVersionList replaces the Sec-CH-UA-Full-Version-List header
+// in h (WICG User-Agent Client Hints, Section 3.6).
+func SetSecCHUAFullVersionList(h http.Header, brands []Product) {
+	setBrands(h, "Sec-Ch-Ua-Full-Version-List", brands)
+}
+
+func parseBrands(values []string) []Product {
+	if values == nil {
+		return nil
+	}
+	list, ok := parseSFList(values)
+	if !ok {
+		return nil
+	}
+	brands := make([]Product, 0, len(list))
+	for _, item := range list {
+		name, ok := item.value.(string)
+		if !ok {
+			continue
+		}
+		version, _ := item.param("v").(string)
+		brands = append(brands, Product{Name: name, Version: version})
+	}
+	return brands
+}
+
+func setBrands(h http.Header, name string, brands []Product) {
+	if len(brands) == 0 {
+		h.Del(name)
+		return
+	}
+	list := make([]sfItem, len(brands))
+	for i, brand := range brands {
+		list[i].value = brand.Name
+		if brand.Version != "" {
+			list[i].params = []sfParam{{key: "v", value: brand.Version}}
+		}
+	}
+	b := &strings.Builder{}
+	writeSFList(b, list)
+	h.Set(name, b.String())
+}
+
+// SecCHUAMobile parses the Sec-CH-UA-Mobile header from h (WICG User-Agent
+// Client Hints, Section 3.8), which is true if the user agent prefers
+// a ``mobile'' experience.
+func SecCHUAMobile(h http.Header) bool {
+	item, ok := parseSFItem(h["Sec-Ch-Ua-Mobile"])
+	return ok && item.value == true
+}
+
+// SetSecCHUAMobile replaces the Sec-CH-UA-Mobile header in h (WICG User-Agent
+// Client Hints, Section 3.8). Unlike most setters in this package,
+// it sends the header even when mobile is false, as user agents do.
+func SetSecCHUAMobile(h http.Header, mobile bool) {
+	b := &strings.Builder{}
+	writeSFItem(b, sfItem{value: mobile})
+	h.Set("Sec-Ch-Ua-Mobile", b.String())
+}
+
+// SecCHUAPlatform parses the Sec-CH-UA-Platform header from h (WICG User-Agent
+// Client Hints, Section 3.9), such as "Windows" or "Android".
+func SecCHUAPlatform(h http.Header) string {
+	return parseSFString(h["Sec-Ch-Ua-Platform"])
+}
+
+// SetSecCHUAPlatform replaces the Sec-CH-UA-Platform header in h
+// (WICG User-Agent Client Hints, Section 3.9).
+func SetSecCHUAPlatform(h http.Header, platform string) {
+	setSFString(h, "Sec-Ch-Ua-Platform", platform)
+}
+
+// SecCHUAPlatformVersion parses the Sec-CH-UA-Platform-Version header from h
+// (WICG User-Agent Client Hints, Section 3.10).
+func SecCHUAPlatformVersion(h http.Header) string {
+	return parseSFString(h["Sec-Ch-Ua-Platform-Version"])
+}
+
+// SetSecCHUAPlatformVersion replaces the Sec-CH-UA-Platform-Version header
+// in h (WICG User-Agent Client Hints, Section 3.10).
+func SetSecCHUAPlatformVersion(h http.Header, version string) {
+	setSFString(h, "Sec-Ch-Ua-Platform-Version", version)
+}
+
+// SecCHUAArch parses the Sec-CH-UA-Arch header from h (WICG User-Agent
+// Client Hints, Section 3.2), such as "x86" or "arm".
+func SecCHUAArch(h http.Header) string {
+	return parseSFString(h["Sec-Ch-Ua-Arch"])
+}
+
+// SetSecCHUAArch replaces the Sec-CH-UA-Arch header in h (WICG User-Agent
+// Client Hints, Section 3.2).
+func SetSecCHUAArch(h http.Header, arch string) {
+	setSFString(h, "Sec-Ch-Ua-Arch", arch)
+}
+
+// SecCHUAModel parses the Sec-CH-UA-Model header from h (WICG User-Agent
+// Client Hints, Section 3.7), which is the device model on mobile platforms,
+// and usually empty elsewhere.
+func SecCHUAModel(h http.Header) string {
+	return parseSFString(h["Sec-Ch-Ua-Model"])
+}
+
+// SetSecCHUAModel replaces the Sec-CH-UA-Model header in h (WICG User-Agent
+// Client Hints, Section 3.7). Unlike most setters in this package,
+// it sends the header even when model is empty, as user agents do.
+func SetSecCHUAModel(h http.Header, model string) {
+	b := &strings.Builder{}
+	writeSFItem(b, sfItem{value: model})
+	h.Set("Sec-Ch-Ua-Model", b.String())
+}
+
+func parseSFString(values []string) string {
+	item, ok := parseSFItem(values)
+	if !ok {
+		return ""
+	}
+	s, _ := item.value.(string)
+	return s
+}
+
+func setSFString(h http.Header, name, s string) {
+	if s == "" {
+		h.Del(name)
+		return
+	}
+	b := &strings.Builder{}
+	writeSFItem(b, sfItem{value: s})
+	h.Set(name, b.String())
+}
@@ -0,0 +1,183 @@
+package httpheader
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func ExampleSecCHUA() {
+	header := http.Header{
+		"User-Agent": {"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36"},
+		"Sec-Ch-Ua":  {`"Chromium";v="124", "Google Chrome";v="124", "Not-A.Brand";v="99"`},
+	}
+	for _, products := range [][]Product{UserAgent(header), SecCHUA(header)} {
+		for _, product := range products {
+			if product.Name == "Chrome" || product.Name == "Google Chrome" {
+				fmt.Println(product.Name, product.Version)
+			}
+		}
+	}
+	// Output: Chrome 124.0.0.0
+	// Google Chrome 124
+}
+
+func TestAcceptCH(t *testing.T) {
+	tests := []struct {
+		header http.Header
+		result []string
+	}{
+		// Valid headers.
+		{
+			http.Header{"Accept-Ch": {"sec-ch-ua-platform-version, Sec-CH-UA-Model"}},
+			[]string{"Sec-Ch-Ua-Platform-Version", "Sec-Ch-Ua-Model"},
+		},
+		{
+			http.Header{"Accept-Ch": {"dpr", "viewport-width"}},
+			[]string{"Dpr", "Viewport-Width"},
+		},
+
+		// Invalid headers.
+		// Precise outputs on them are not a guaranteed part of the API.
+		// They may change as convenient for the parsing code.
+		{
+			http.Header{"Accept-Ch": {"dpr, width,"}},
+			nil,
+		},
+		{
+			http.Header{"Accept-Ch": {`dpr, "width", 1`}},
+			[]string{"Dpr"},
+		},
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			checkParse(t, test.header, test.result, AcceptCH(test.header))
+		})
+	}
+}
+
+func TestSetCriticalCH(t *testing.T) {
+	h := http.Header{}
+	SetAcceptCH(h, []string{"Sec-CH-UA-Model", "Sec-Ch-Ua-Platform-Version"})
+	SetCriticalCH(h, []string{"Sec-Ch-Ua-Model"})
+	checkGenerate(t, nil, http.Header{
+		"Accept-Ch":   {"sec-ch-ua-model, sec-ch-ua-platform-version"},
+		"Critical-Ch": {"sec-ch-ua-model"},
+	}, h)
+	checkParse(t, h, []string{"Sec-Ch-Ua-Model"}, CriticalCH(h))
+	SetAcceptCH(h, nil)
+	SetCriticalCH(h, nil)
+	checkGenerate(t, nil, http.Header{}, h)
+}
+
+func TestSecCHUA(t *testing.T) {
+	tests := []struct {
+		header http.Header
+		result []Product
+	}{
+		// Valid headers.
+		{
+			http.Header{"Sec-Ch-Ua": {`"Chromium";v="124", "Not-A.Brand";v="99"`}},
+			[]Product{{Name: "Chromium", Version: "124"}, {Name: "Not-A.Brand", Version: "99"}},
+		},
+		{
+			http.Header{"Sec-Ch-Ua": {`" Not;A\\Brand";v="99"`, `"Edge"`}},
+			[]Product{{Name: ` Not;A\Brand`, Version: "99"}, {Name: "Edge"}},
+		},
+
+		// Invalid headers.
+		// Precise outputs on them are not a guaranteed part of the API.
+		// They may change as convenient for the parsing code.
+		{
+			http.Header{"Sec-Ch-Ua": {`Chromium/124`}},
+			[]Product{},
+		},
+		{
+			http.Header{"Sec-Ch-Ua": {`"Chromium";v=124`}},
+			[]Product{{Name: "Chromium"}},
+		},
+		{
+			http.Header{"Sec-Ch-Ua": {`"Chromium";v="124" "Edge"`}},
+			nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			checkParse(t, test.header, test.result, SecCHUA(test.header))
+		})
+	}
+}
+
+func TestSecCHUAFullVersionListRoundTrip(t *testing.T) {
+	brands := []Product{
+		{Name: "Chromium", Version: "124.0.6367.91"},
+		{Name: `Not"A\Brand`, Version: "99.0.0.0"},
+	}
+	h := http.Header{}
+	SetSecCHUAFullVersionList(h, brands)
+	checkGenerate(t, brands, http.Header{"Sec-Ch-Ua-Full-Version-List": {
+		`"Chromium";v="124.0.6367.91", "Not\"A\\Brand";v="99.0.0.0"`,
+	}}, h)
+	checkParse(t, h, brands, SecCHUAFullVersionList(h))
+	SetSecCHUA(h, []Product{{Name: "Chromium", Version: "124", Comment: "ignored"}, {Name: "Edge"}})
+	checkGenerate(t, nil, http.Header{
+		"Sec-Ch-Ua-Full-Version-List": {`"Chromium";v="124.0.6367.91", "Not\"A\\Brand";v="99.0.0.0"`},
+		"Sec-Ch-Ua":                   {`"Chromium";v="124", "Edge"`},
+	}, h)
+	checkParse(t, h, []Product{{Name: "Chromium", Version: "124"}, {Name: "Edge"}}, SecCHUA(h))
+	SetSecCHUAFullVersionList(h, nil)
+	SetSecCHUA(h, nil)
+	checkGenerate(t, nil, http.Header{}, h)
+}
+
+func TestSecCHUAItems(t *testing.T) {
+	h := http.Header{
+		"Sec-Ch-Ua-Mobile":           {"?1"},
+		"Sec-Ch-Ua-Platform":         {`"Android"`},
+		"Sec-Ch-Ua-Platform-Version": {` "14.0.0" `},
+		"Sec-Ch-Ua-Arch":             {`""`},
+		"Sec-Ch-Ua-Model":            {`"Pixel 8"`},
+	}
+	checkParse(t, h,
+		true, SecCHUAMobile(h),
+		"Android", SecCHUAPlatform(h),
+		"14.0.0", SecCHUAPlatformVersion(h),
+		"", SecCHUAArch(h),
+		"Pixel 8", SecCHUAModel(h),
+	)
+
+	h = http.Header{
+		"Sec-Ch-Ua-Mobile":   {"?0"},
+		"Sec-Ch-Ua-Platform": {"Android"},
+		"Sec-Ch-Ua-Model":    {`"Pixel 8", "Pixel 9"`},
+	}
+	checkParse(t, h,
+		false, SecCHUAMobile(h),
+		"", SecCHUAPlatform(h),
+		"", SecCHUAModel(h),
+		"", SecCHUAArch(h),
+	)
+
+	h = http.Header{}
+	SetSecCHUAMobile(h, false)
+	SetSecCHUAPlatform(h, "Windows")
+	SetSecCHUAPlatformVersion(h, "15.0.0")
+	SetSecCHUAArch(h, "x86")
+	SetSecCHUAModel(h, "")
+	checkGenerate(t, nil, http.Header{
+		"Sec-Ch-Ua-Mobile":           {"?0"},
+		"Sec-Ch-Ua-Platform":         {`"Windows"`},
+		"Sec-Ch-Ua-Platform-Version": {`"15.0.0"`},
+		"Sec-Ch-Ua-Arch":             {`"x86"`},
+		"Sec-Ch-Ua-Model":            {`""`},
+	}, h)
+
+	SetSecCHUAPlatform(h, "")
+	SetSecCHUAPlatformVersion(h, "")
+	SetSecCHUAArch(h, "")
+	SetSecCHUAModel(h, "Pixel\t7 – Pro")
+	checkGenerate(t, nil, http.Header{
+		"Sec-Ch-Ua-Mobile": {"?0"},
+		"Sec-Ch-Ua-Model":  {`"Pixel7  Pro"`},
+	}, h)
+}
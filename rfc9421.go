@@ -0,0 +1,726 @@
+package httpheader
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A SignatureComponent identifies a part of an HTTP message covered by
+// a signature (RFC 9421 Section 2). Name is either a lowercase header name,
+// or a derived component name starting with "@", such as "@method".
+//
+// For header components, SF requests strict serialization of a Structured
+// Field, which must be known to this package; Key selects a single member
+// of a Dictionary field; BS requests byte sequence wrapping of each line.
+// QueryParam is the name of the parameter for "@query-param". Req takes
+// the component from the request when signing a response.
+type SignatureComponent struct {
+	Name       string
+	SF         bool
+	Key        string
+	BS         bool
+	Req        bool
+	QueryParam string
+}
+
+// SignatureParams describes one signature (RFC 9421 Section 2.3),
+// as found in the Signature-Input header under Label. Zero Created
+// and Expires mean that the corresponding parameters are absent.
+// Other unknown parameters are ignored, but still covered by verification.
+type SignatureParams struct {
+	Label      string
+	Components []SignatureComponent
+	Created    time.Time
+	Expires    time.Time
+	Nonce      string
+	Algorithm  string
+	KeyID      string
+	Tag        string
+
+	// item is the original inner list, if parsed from a header.
+	item *sfItem
+}
+
+// SignatureInput parses the Signature-Input header from h (RFC 9421
+// Section 4.1). The header is a Structured Fields Dictionary (RFC 8941);
+// if it is invalid, the entire header is ignored and nil is returned.
+// Invalid members are skipped.
+func SignatureInput(h http.Header) []SignatureParams {
+	values := h["Signature-Input"]
+	if values == nil {
+		return nil
+	}
+	dict, ok := parseSFDictionary(values)
+	if !ok {
+		return nil
+	}
+	var result []SignatureParams
+	for _, member := range dict {
+		params, ok := parseSignatureParams(member.sfItem)
+		if !ok {
+			continue
+		}
+		params.Label = member.key
+		result = append(result, params)
+	}
+	return result
+}
+
+func parseSignatureParams(item sfItem) (SignatureParams, bool) {
+	var params SignatureParams
+	items, ok := item.value.([]sfItem)
+	if !ok {
+		return params, false
+	}
+	for _, inner := range items {
+		component, ok := parseSignatureComponent(inner)
+		if !ok {
+			return params, false
+		}
+		params.Components = append(params.Components, component)
+	}
+	for _, p := range item.params {
+		switch value := p.value.(type) {
+		case int64:
+			switch p.key {
+			case "created":
+				params.Created = time.Unix(value, 0)
+			case "expires":
+				params.Expires = time.Unix(value, 0)
+			}
+		case string:
+			switch p.key {
+			case "nonce":
+				params.Nonce = value
+			case "alg":
+				params.Algorithm = value
+			case "keyid":
+				params.KeyID = value
+			case "tag":
+				params.Tag = value
+			}
+		}
+	}
+	params.item = &item
+	return params, true
+}
+
+func parseSignatureComponent(item sfItem) (SignatureComponent, bool) {
+	var component SignatureComponent
+	name, ok := item.value.(string)
+	if !ok || name == "" {
+		return component, false
+	}
+	component.Name = name
+	for _, p := range item.params {
+		switch p.key {
+		case "sf":
+			component.SF = p.value == true
+		case "bs":
+			component.BS = p.value == true
+		case "req":
+			component.Req = p.value == true
+		case "key":
+			component.Key, ok = p.value.(string)
+		case "name":
+			component.QueryParam, ok = p.value.(string)
+		}
+		if !ok {
+			return component, false
+		}
+	}
+	return component, true
+}
+
+// SetSignatureInput replaces the Signature-Input header in h (RFC 9421
+// Section 4.1).
+func SetSignatureInput(h http.Header, input []SignatureParams) {
+	if len(input) == 0 {
+		h.Del("Signature-Input")
+		return
+	}
+	dict := make([]sfMember, 0, len(input))
+	for _, params := range input {
+		dict = append(dict, sfMember{key: params.Label, sfItem: params.sfItem()})
+	}
+	b := &strings.Builder{}
+	writeSFDictionary(b, dict)
+	h.Set("Signature-Input", b.String())
+}
+
+func (params SignatureParams) sfItem() sfItem {
+	items := make([]sfItem, 0, len(params.Components))
+	for _, component := range params.Components {
+		items = append(items, component.sfItem())
+	}
+	item := sfItem{value: items}
+	if !params.Created.IsZero() {
+		item.params = append(item.params, sfParam{"created", params.Created.Unix()})
+	}
+	if !params.Expires.IsZero() {
+		item.params = append(item.params, sfParam{"expires", params.Expires.Unix()})
+	}
+	for _, p := range []sfParam{
+		{"keyid", params.KeyID},
+		{"alg", params.Algorithm},
+		{"nonce", params.Nonce},
+		{"tag", params.Tag},
+	} {
+		if p.value != "" {
+			item.params = append(item.params, p)
+		}
+	}
+	return item
+}
+
+func (component SignatureComponent) sfItem() sfItem {
+	item := sfItem{value: component.Name}
+	if component.SF {
+		item.params = append(item.params, sfParam{"sf", true})
+	}
+	if component.Key != "" {
+		item.params = append(item.params, sfParam{"key", component.Key})
+	}
+	if component.QueryParam != "" {
+		item.params = append(item.params, sfParam{"name", component.QueryParam})
+	}
+	if component.BS {
+		item.params = append(item.params, sfParam{"bs", true})
+	}
+	if component.Req {
+		item.params = append(item.params, sfParam{"req", true})
+	}
+	return item
+}
+
+// Signature parses the Signature header from h (RFC 9421 Section 4.2),
+// which maps labels to signatures. The header is a Structured Fields
+// Dictionary (RFC 8941); if it is invalid, the entire header is ignored
+// and nil is returned. Members that are not byte sequences are skipped.
+func Signature(h http.Header) map[string][]byte {
+	values := h["Signature"]
+	if values == nil {
+		return nil
+	}
+	dict, ok := parseSFDictionary(values)
+	if !ok {
+		return nil
+	}
+	signatures := make(map[string][]byte, len(dict))
+	for _, member := range dict {
+		if signature, ok := member.value.([]byte); ok {
+			signatures[member.key] = signature
+		}
+	}
+	return signatures
+}
+
+// SetSignature replaces the Signature header in h (RFC 9421 Section 4.2).
+// Members are written in order of their labels.
+func SetSignature(h http.Header, signatures map[string][]byte) {
+	if len(signatures) == 0 {
+		h.Del("Signature")
+		return
+	}
+	labels := make([]string, 0, len(signatures))
+	for label := range signatures {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	dict := make([]sfMember, 0, len(labels))
+	for _, label := range labels {
+		dict = append(dict, sfMember{key: label, sfItem: sfItem{value: signatures[label]}})
+	}
+	b := &strings.Builder{}
+	writeSFDictionary(b, dict)
+	h.Set("Signature", b.String())
+}
+
+// A MessageSigner signs HTTP messages (RFC 9421 Section 3.1) with Key
+// according to Algorithm, which is one of:
+//
+//	"rsa-pss-sha512"    *rsa.PrivateKey
+//	"rsa-v1_5-sha256"   *rsa.PrivateKey
+//	"hmac-sha256"       []byte
+//	"ecdsa-p256-sha256" *ecdsa.PrivateKey
+//	"ecdsa-p384-sha384" *ecdsa.PrivateKey
+//	"ed25519"           ed25519.PrivateKey
+type MessageSigner struct {
+	Algorithm string
+	Key       interface{}
+}
+
+// SignRequest signs r according to params, and adds the result to
+// the Signature-Input and Signature headers of r under params.Label,
+// replacing any signature with the same label. Any header components
+// must already be in r.Header.
+func (s MessageSigner) SignRequest(r *http.Request, params SignatureParams) error {
+	return s.sign(signedMessage{header: r.Header, request: r}, params)
+}
+
+// SignResponse signs resp like SignRequest. Components with Req are taken
+// from resp.Request, which must then be non-nil.
+func (s MessageSigner) SignResponse(resp *http.Response, params SignatureParams) error {
+	return s.sign(signedMessage{header: resp.Header, status: resp.StatusCode,
+		related: resp.Request}, params)
+}
+
+func (s MessageSigner) sign(m signedMessage, params SignatureParams) error {
+	if params.Label == "" {
+		return errors.New("httpheader: no signature label")
+	}
+	params.item = nil
+	base, err := signatureBase(m, params)
+	if err != nil {
+		return err
+	}
+	signature, err := signMessage(s.Algorithm, s.Key, []byte(base))
+	if err != nil {
+		return err
+	}
+	addSFMember(m.header, "Signature-Input", sfMember{key: params.Label, sfItem: params.sfItem()})
+	addSFMember(m.header, "Signature", sfMember{key: params.Label, sfItem: sfItem{value: signature}})
+	return nil
+}
+
+// addSFMember adds member to the Dictionary field name in h,
+// replacing any member with the same key but preserving other members.
+func addSFMember(h http.Header, name string, member sfMember) {
+	dict, _ := parseSFDictionary(h[name])
+	dict = setSFMember(dict, member)
+	b := &strings.Builder{}
+	writeSFDictionary(b, dict)
+	h.Set(name, b.String())
+}
+
+// A MessageVerifier verifies signatures on HTTP messages (RFC 9421
+// Section 3.2).
+type MessageVerifier struct {
+	// Key returns the algorithm (see MessageSigner) and the key to verify
+	// a signature with the given parameters, usually by looking up
+	// params.KeyID. For asymmetric algorithms, the key may be public
+	// or private.
+	Key func(params SignatureParams) (algorithm string, key interface{}, err error)
+
+	// Required lists component names, such as "@method" or "content-digest",
+	// that the signature must cover.
+	Required []string
+
+	// MaxAge, if not zero, is how long after its creation a signature
+	// is accepted. The created parameter is then required.
+	MaxAge time.Duration
+}
+
+// VerifyRequest verifies the signature with the given label on r.
+// If label is empty, r must carry exactly one signature.
+func (v MessageVerifier) VerifyRequest(r *http.Request, label string) (SignatureParams, error) {
+	return v.verify(signedMessage{header: r.Header, request: r}, label)
+}
+
+// VerifyResponse verifies the signature with the given label on resp.
+// Components with Req are taken from resp.Request.
+func (v MessageVerifier) VerifyResponse(resp *http.Response, label string) (SignatureParams, error) {
+	return v.verify(signedMessage{header: resp.Header, status: resp.StatusCode,
+		related: resp.Request}, label)
+}
+
+func (v MessageVerifier) verify(m signedMessage, label string) (SignatureParams, error) {
+	input := SignatureInput(m.header)
+	if label == "" && len(input) == 1 {
+		label = input[0].Label
+	}
+	var params SignatureParams
+	for _, p := range input {
+		if p.Label == label {
+			params = p
+		}
+	}
+	if params.Label == "" {
+		return params, fmt.Errorf("httpheader: no signature labeled %q", label)
+	}
+	signature := Signature(m.header)[label]
+	if signature == nil {
+		return params, fmt.Errorf("httpheader: no signature labeled %q", label)
+	}
+	for _, name := range v.Required {
+		if !params.covers(name) {
+			return params, fmt.Errorf("httpheader: signature does not cover %q", name)
+		}
+	}
+	now := time.Now()
+	if !params.Expires.IsZero() && now.After(params.Expires) {
+		return params, errors.New("httpheader: signature expired")
+	}
+	if v.MaxAge != 0 && (params.Created.IsZero() || now.Sub(params.Created) > v.MaxAge) {
+		return params, errors.New("httpheader: signature too old")
+	}
+	if v.Key == nil {
+		return params, errors.New("httpheader: no MessageVerifier.Key")
+	}
+	algorithm, key, err := v.Key(params)
+	if err != nil {
+		return params, err
+	}
+	if params.Algorithm != "" && params.Algorithm != algorithm {
+		return params, fmt.Errorf("httpheader: signature alg %q does not match key", params.Algorithm)
+	}
+	base, err := signatureBase(m, params)
+	if err != nil {
+		return params, err
+	}
+	if err := verifyMessage(algorithm, key, []byte(base), signature); err != nil {
+		return params, err
+	}
+	return params, nil
+}
+
+func (params SignatureParams) covers(name string) bool {
+	for _, component := range params.Components {
+		if component.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+type signedMessage struct {
+	header  http.Header
+	request *http.Request // nil for responses
+	status  int           // zero for requests
+	related *http.Request // the request for a response
+}
+
+// signatureBase creates the signature base (RFC 9421 Section 2.5).
+// If params was parsed from a header, it is reproduced exactly.
+func signatureBase(m signedMessage, params SignatureParams) (string, error) {
+	item := params.sfItem()
+	if params.item != nil {
+		item = *params.item
+	}
+	b := &strings.Builder{}
+	seen := make(map[string]bool)
+	for _, inner := range item.value.([]sfItem) {
+		component, _ := parseSignatureComponent(inner)
+		id := &strings.Builder{}
+		writeSFItem(id, inner)
+		if seen[id.String()] {
+			return "", fmt.Errorf("httpheader: duplicate signature component %s", id)
+		}
+		seen[id.String()] = true
+		values, err := m.component(component)
+		if err != nil {
+			return "", err
+		}
+		for _, value := range values {
+			if strings.ContainsAny(value, "\r\n") {
+				return "", fmt.Errorf("httpheader: signature component %s contains a newline", id)
+			}
+			write(b, id.String(), ": ", value, "\n")
+		}
+	}
+	write(b, `"@signature-params": `)
+	writeSFMember(b, item)
+	return b.String(), nil
+}
+
+// component returns the value(s) of component in m (RFC 9421 Sections 2.1
+// and 2.2). Only "@query-param" may have more than one.
+func (m signedMessage) component(component SignatureComponent) ([]string, error) {
+	if component.Req {
+		if m.related == nil {
+			return nil, fmt.Errorf("httpheader: no request for %q;req", component.Name)
+		}
+		m = signedMessage{header: m.related.Header, request: m.related}
+	}
+	if !strings.HasPrefix(component.Name, "@") {
+		value, err := m.field(component)
+		return []string{value}, err
+	}
+	if component.SF || component.BS || component.Key != "" ||
+		component.QueryParam != "" && component.Name != "@query-param" {
+		return nil, fmt.Errorf("httpheader: bad parameters for %q", component.Name)
+	}
+	if component.Name == "@status" {
+		if m.status == 0 {
+			return nil, errors.New("httpheader: @status only applies to responses")
+		}
+		return []string{strconv.Itoa(m.status)}, nil
+	}
+	if m.request == nil {
+		return nil, fmt.Errorf("httpheader: %s only applies to requests", component.Name)
+	}
+	u := absoluteURL(m.request)
+	switch component.Name {
+	case "@method":
+		return []string{m.request.Method}, nil
+	case "@target-uri":
+		return []string{u.String()}, nil
+	case "@authority":
+		authority := strings.ToLower(u.Host)
+		if port := u.Port(); port != "" && port == defaultPort(u.Scheme) {
+			authority = strings.TrimSuffix(authority, ":"+port)
+		}
+		return []string{authority}, nil
+	case "@scheme":
+		return []string{strings.ToLower(u.Scheme)}, nil
+	case "@request-target":
+		return []string{requestURI(m.request)}, nil
+	case "@path":
+		path := u.EscapedPath()
+		if path == "" {
+			path = "/"
+		}
+		return []string{path}, nil
+	case "@query":
+		return []string{"?" + u.RawQuery}, nil
+	case "@query-param":
+		return queryParam(u.RawQuery, component.QueryParam)
+	}
+	return nil, fmt.Errorf("httpheader: unknown signature component %q", component.Name)
+}
+
+func (m signedMessage) field(component SignatureComponent) (string, error) {
+	name := http.CanonicalHeaderKey(component.Name)
+	lines := m.header[name]
+	if lines == nil {
+		return "", fmt.Errorf("httpheader: no %s header to sign", name)
+	}
+	switch {
+	case component.BS:
+		if component.SF || component.Key != "" {
+			return "", fmt.Errorf("httpheader: bad parameters for %q", component.Name)
+		}
+		encoded := make([]string, 0, len(lines))
+		for _, line := range lines {
+			line = strings.Trim(line, " \t")
+			encoded = append(encoded, ":"+base64.StdEncoding.EncodeToString([]byte(line))+":")
+		}
+		return strings.Join(encoded, ", "), nil
+	case component.Key != "":
+		dict, ok := parseSFDictionary(lines)
+		if !ok {
+			return "", fmt.Errorf("httpheader: %s is not a valid Dictionary", name)
+		}
+		for _, member := range dict {
+			if member.key == component.Key {
+				b := &strings.Builder{}
+				writeSFMember(b, member.sfItem)
+				return b.String(), nil
+			}
+		}
+		return "", fmt.Errorf("httpheader: no %q in %s", component.Key, name)
+	case component.SF:
+		typ := sfFieldTypes[name]
+		if typ == 0 {
+			return "", fmt.Errorf("httpheader: %s is not a known Structured Field", name)
+		}
+		value, ok := reserializeSF(typ, lines)
+		if !ok {
+			return "", fmt.Errorf("httpheader: %s is not a valid Structured Field", name)
+		}
+		return value, nil
+	}
+	trimmed := make([]string, 0, len(lines))
+	for _, line := range lines {
+		trimmed = append(trimmed, strings.Trim(line, " \t"))
+	}
+	return strings.Join(trimmed, ", "), nil
+}
+
+// queryParam returns the values of the query parameter name, re-encoded
+// for the signature base (RFC 9421 Section 2.2.8).
+func queryParam(rawQuery, name string) ([]string, error) {
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := url.QueryUnescape(name)
+	if err != nil {
+		return nil, err
+	}
+	values := query[decoded]
+	if len(values) == 0 {
+		return nil, fmt.Errorf("httpheader: no query parameter %q to sign", name)
+	}
+	encoded := make([]string, 0, len(values))
+	for _, value := range values {
+		encoded = append(encoded, percentEncode(value))
+	}
+	return encoded, nil
+}
+
+func percentEncode(s string) string {
+	const hex = "0123456789ABCDEF"
+	b := &strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '.' || c == '_' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&0xF])
+		}
+	}
+	return b.String()
+}
+
+// absoluteURL returns the URL that r was sent to. For a server request,
+// this is reconstructed from r.Host and r.TLS.
+func absoluteURL(r *http.Request) *url.URL {
+	u := *r.URL
+	if !u.IsAbs() {
+		u.Scheme = "http"
+		if r.TLS != nil {
+			u.Scheme = "https"
+		}
+		if r.Host != "" {
+			u.Host = r.Host
+		}
+	}
+	return &u
+}
+
+func signMessage(algorithm string, key interface{}, base []byte) ([]byte, error) {
+	digest, hashID, ok := signatureDigest(algorithm, base)
+	if !ok {
+		return nil, fmt.Errorf("httpheader: unsupported signature algorithm %q", algorithm)
+	}
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		switch algorithm {
+		case "rsa-pss-sha512":
+			return rsa.SignPSS(rand.Reader, key, hashID, digest,
+				&rsa.PSSOptions{SaltLength: 64})
+		case "rsa-v1_5-sha256":
+			return rsa.SignPKCS1v15(rand.Reader, key, hashID, digest)
+		}
+	case *ecdsa.PrivateKey:
+		if curve, ok := signatureCurve(algorithm); ok && key.Curve == curve {
+			r, s, err := ecdsa.Sign(rand.Reader, key, digest)
+			if err != nil {
+				return nil, err
+			}
+			size := (curve.Params().BitSize + 7) / 8
+			return append(leftPad(r.Bytes(), size), leftPad(s.Bytes(), size)...), nil
+		}
+	case ed25519.PrivateKey:
+		if algorithm == "ed25519" && len(key) == ed25519.PrivateKeySize {
+			return ed25519.Sign(key, base), nil
+		}
+	case []byte:
+		if algorithm == "hmac-sha256" {
+			mac := hmac.New(sha256.New, key)
+			mac.Write(base)
+			return mac.Sum(nil), nil
+		}
+	}
+	return nil, fmt.Errorf("httpheader: wrong key type %T for %q", key, algorithm)
+}
+
+func verifyMessage(algorithm string, key interface{}, base, signature []byte) error {
+	digest, hashID, ok := signatureDigest(algorithm, base)
+	if !ok {
+		return fmt.Errorf("httpheader: unsupported signature algorithm %q", algorithm)
+	}
+	if signer, ok := key.(crypto.Signer); ok {
+		key = signer.Public()
+	}
+	var valid bool
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		switch algorithm {
+		case "rsa-pss-sha512":
+			valid = rsa.VerifyPSS(key, hashID, digest, signature,
+				&rsa.PSSOptions{SaltLength: 64}) == nil
+		case "rsa-v1_5-sha256":
+			valid = rsa.VerifyPKCS1v15(key, hashID, digest, signature) == nil
+		default:
+			return fmt.Errorf("httpheader: wrong key type %T for %q", key, algorithm)
+		}
+	case *ecdsa.PublicKey:
+		curve, ok := signatureCurve(algorithm)
+		if !ok || key.Curve != curve {
+			return fmt.Errorf("httpheader: wrong key type %T for %q", key, algorithm)
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		if len(signature) == 2*size {
+			r := new(big.Int).SetBytes(signature[:size])
+			s := new(big.Int).SetBytes(signature[size:])
+			valid = ecdsa.Verify(key, digest, r, s)
+		}
+	case ed25519.PublicKey:
+		if algorithm != "ed25519" || len(key) != ed25519.PublicKeySize {
+			return fmt.Errorf("httpheader: wrong key type %T for %q", key, algorithm)
+		}
+		valid = ed25519.Verify(key, base, signature)
+	case []byte:
+		if algorithm != "hmac-sha256" {
+			return fmt.Errorf("httpheader: wrong key type %T for %q", key, algorithm)
+		}
+		mac := hmac.New(sha256.New, key)
+		mac.Write(base)
+		valid = hmac.Equal(mac.Sum(nil), signature)
+	default:
+		return fmt.Errorf("httpheader: wrong key type %T for %q", key, algorithm)
+	}
+	if !valid {
+		return errors.New("httpheader: bad HTTP message signature")
+	}
+	return nil
+}
+
+func leftPad(b []byte, size int) []byte {
+	return append(make([]byte, size-len(b)), b...)
+}
+
+// signatureDigest hashes base as required by algorithm. Ed25519 signs base
+// itself (RFC 9421 Section 3.3.6), so the digest is nil.
+func signatureDigest(algorithm string, base []byte) ([]byte, crypto.Hash, bool) {
+	var newHash func() hash.Hash
+	var hashID crypto.Hash
+	switch algorithm {
+	case "rsa-pss-sha512":
+		newHash, hashID = sha512.New, crypto.SHA512
+	case "rsa-v1_5-sha256", "hmac-sha256", "ecdsa-p256-sha256":
+		newHash, hashID = sha256.New, crypto.SHA256
+	case "ecdsa-p384-sha384":
+		newHash, hashID = sha512.New384, crypto.SHA384
+	case "ed25519":
+		return nil, 0, true
+	default:
+		return nil, 0, false
+	}
+	h := newHash()
+	h.Write(base)
+	return h.Sum(nil), hashID, true
+}
+
+func signatureCurve(algorithm string) (elliptic.Curve, bool) {
+	switch algorithm {
+	case "ecdsa-p256-sha256":
+		return elliptic.P256(), true
+	case "ecdsa-p384-sha384":
+		return elliptic.P384(), true
+	}
+	return nil, false
+}
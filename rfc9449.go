@@ -0,0 +1,429 @@
+package httpheader
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// A DPoPProof is a DPoP proof JWT (RFC 9449 Section 4.2) as sent
+// in the DPoP header. Its signature is not checked until Verify is called.
+type DPoPProof struct {
+	Algorithm string           // the JWS "alg", such as "ES256"
+	Key       crypto.PublicKey // from the JWS "jwk": *ecdsa.PublicKey or *rsa.PublicKey
+
+	// Thumbprint is the JWK SHA-256 Thumbprint of Key (RFC 7638),
+	// base64url-encoded. It is what an access token bound to Key
+	// carries in its "cnf" claim as "jkt" (RFC 9449 Section 6).
+	Thumbprint string
+
+	ID              string    // "jti"
+	Method          string    // "htm"
+	URI             string    // "htu"
+	IssuedAt        time.Time // "iat"
+	AccessTokenHash string    // "ath"
+	Nonce           string    // "nonce"
+
+	signingInput string
+	signature    []byte
+}
+
+// DPoP parses the DPoP header from h (RFC 9449 Section 4.1). The header must be
+// present exactly once and hold a compact JWS with typ "dpop+jwt", a supported
+// alg (ES256 or RS256), and a public key in jwk. The claims are decoded,
+// but not checked against anything; call Verify or DPoPVerifier.Verify.
+func DPoP(h http.Header) (*DPoPProof, error) {
+	values := h["Dpop"]
+	switch {
+	case len(values) == 0:
+		return nil, errNoDPoP
+	case len(values) > 1 || strings.IndexByte(values[0], ',') != -1:
+		return nil, errors.New("httpheader: more than one DPoP proof")
+	}
+	parts := strings.Split(strings.TrimSpace(values[0]), ".")
+	if len(parts) != 3 {
+		return nil, errors.New("httpheader: DPoP proof is not a compact JWS")
+	}
+	var header struct {
+		Type      string                     `json:"typ"`
+		Algorithm string                     `json:"alg"`
+		JWK       map[string]json.RawMessage `json:"jwk"`
+	}
+	if err := decodeJOSEPart(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("httpheader: bad DPoP proof header: %v", err)
+	}
+	if !strings.EqualFold(header.Type, "dpop+jwt") {
+		return nil, fmt.Errorf("httpheader: bad DPoP proof typ %q", header.Type)
+	}
+	if header.Algorithm != "ES256" && header.Algorithm != "RS256" {
+		return nil, fmt.Errorf("httpheader: unsupported DPoP proof alg %q", header.Algorithm)
+	}
+	key, thumbprint, err := parseJWK(header.JWK)
+	if err != nil {
+		return nil, fmt.Errorf("httpheader: bad DPoP proof jwk: %v", err)
+	}
+	var claims struct {
+		ID              string  `json:"jti"`
+		Method          string  `json:"htm"`
+		URI             string  `json:"htu"`
+		IssuedAt        float64 `json:"iat"`
+		AccessTokenHash string  `json:"ath"`
+		Nonce           string  `json:"nonce"`
+	}
+	if err := decodeJOSEPart(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("httpheader: bad DPoP proof claims: %v", err)
+	}
+	if claims.ID == "" || claims.Method == "" || claims.URI == "" || claims.IssuedAt == 0 {
+		return nil, errors.New("httpheader: DPoP proof lacks jti, htm, htu or iat")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("httpheader: bad DPoP proof signature: %v", err)
+	}
+	sec, frac := math.Modf(claims.IssuedAt)
+	return &DPoPProof{
+		Algorithm:       header.Algorithm,
+		Key:             key,
+		Thumbprint:      thumbprint,
+		ID:              claims.ID,
+		Method:          claims.Method,
+		URI:             claims.URI,
+		IssuedAt:        time.Unix(int64(sec), int64(frac*1e9)),
+		AccessTokenHash: claims.AccessTokenHash,
+		Nonce:           claims.Nonce,
+		signingInput:    parts[0] + "." + parts[1],
+		signature:       signature,
+	}, nil
+}
+
+var errNoDPoP = errors.New("httpheader: no DPoP proof")
+
+func decodeJOSEPart(s string, v interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// parseJWK decodes a public JSON Web Key (RFC 7517) of type EC (P-256 only)
+// or RSA, and computes its thumbprint (RFC 7638 Section 3).
+func parseJWK(jwk map[string]json.RawMessage) (crypto.PublicKey, string, error) {
+	if jwk == nil {
+		return nil, "", errors.New("missing")
+	}
+	if _, ok := jwk["d"]; ok {
+		return nil, "", errors.New("contains a private key")
+	}
+	member := func(name string) string {
+		var s string
+		json.Unmarshal(jwk[name], &s)
+		return s
+	}
+	integer := func(name string) (*big.Int, error) {
+		raw, err := base64.RawURLEncoding.DecodeString(member(name))
+		if err != nil || len(raw) == 0 {
+			return nil, fmt.Errorf("bad %q", name)
+		}
+		return new(big.Int).SetBytes(raw), nil
+	}
+	var key crypto.PublicKey
+	var canonical string
+	switch kty := member("kty"); kty {
+	case "EC":
+		if crv := member("crv"); crv != "P-256" {
+			return nil, "", fmt.Errorf("unsupported crv %q", crv)
+		}
+		// RFC 7518 Section 6.2.1.2: coordinates are always full length.
+		x, errX := base64.RawURLEncoding.DecodeString(member("x"))
+		y, errY := base64.RawURLEncoding.DecodeString(member("y"))
+		if errX != nil || errY != nil || len(x) != 32 || len(y) != 32 {
+			return nil, "", errors.New(`bad "x" or "y"`)
+		}
+		// elliptic.Unmarshal checks that the point is on the curve.
+		point := append(append([]byte{4}, x...), y...)
+		px, py := elliptic.Unmarshal(elliptic.P256(), point)
+		if px == nil {
+			return nil, "", errors.New("point is not on the curve")
+		}
+		key = &ecdsa.PublicKey{Curve: elliptic.P256(), X: px, Y: py}
+		canonical = fmt.Sprintf(`{"crv":"P-256","kty":"EC","x":%q,"y":%q}`,
+			member("x"), member("y"))
+	case "RSA":
+		n, err := integer("n")
+		if err != nil {
+			return nil, "", err
+		}
+		e, err := integer("e")
+		if err != nil {
+			return nil, "", err
+		}
+		if n.BitLen() < 2048 || !e.IsInt64() || e.Int64() < 3 || e.Int64() > math.MaxInt32 {
+			return nil, "", errors.New("weak or malformed RSA key")
+		}
+		key = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		canonical = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, member("e"), member("n"))
+	default:
+		return nil, "", fmt.Errorf("unsupported kty %q", kty)
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return key, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// Verify checks the signature of p against its own Key.
+func (p *DPoPProof) Verify() error {
+	digest := sha256.Sum256([]byte(p.signingInput))
+	switch key := p.Key.(type) {
+	case *ecdsa.PublicKey:
+		if p.Algorithm != "ES256" || len(p.signature) != 64 {
+			break
+		}
+		r := new(big.Int).SetBytes(p.signature[:32])
+		s := new(big.Int).SetBytes(p.signature[32:])
+		if ecdsa.Verify(key, digest[:], r, s) {
+			return nil
+		}
+	case *rsa.PublicKey:
+		if p.Algorithm != "RS256" {
+			break
+		}
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], p.signature) == nil {
+			return nil
+		}
+	}
+	return errors.New("httpheader: bad DPoP proof signature")
+}
+
+// DPoPAccessTokenHash returns the value of the "ath" claim for accessToken
+// (RFC 9449 Section 4.2).
+func DPoPAccessTokenHash(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// A DPoPVerifier checks DPoP proofs received by a resource server or
+// an authorization server (RFC 9449 Section 4.3). The zero value accepts
+// ES256 and RS256 proofs issued within the last 5 minutes, bound to any key,
+// without nonces or replay detection.
+type DPoPVerifier struct {
+	// Algorithms lists the acceptable algorithms: "ES256" and/or "RS256".
+	// If empty, both are accepted.
+	Algorithms []string
+
+	// MaxAge is how far iat may be from the current time, in either
+	// direction. If zero, 5 minutes is used.
+	MaxAge time.Duration
+
+	// CheckKey, if not nil, is called with the proof's key and its
+	// thumbprint. It should return an error if the key is not acceptable,
+	// for example if it doesn't match the "jkt" of the access token.
+	CheckKey func(key crypto.PublicKey, thumbprint string) error
+
+	// CheckNonce, if not nil, is called with the proof's nonce claim
+	// (possibly empty). If it returns false, Verify fails with
+	// ErrDPoPNonce, and the server should respond with a DPoPChallenge
+	// whose Error is "use_dpop_nonce" and a fresh DPoP-Nonce header.
+	CheckNonce func(nonce string) bool
+
+	// Replayed, if not nil, is called with the jti of every proof that
+	// passes all other checks. It should return true if it has already
+	// seen that jti within MaxAge (RFC 9449 Section 11.1).
+	Replayed func(jti string) bool
+
+	// TargetURI, if not nil, returns the URI that r was sent to.
+	// By default, it is reconstructed from r.URL, r.Host and r.TLS,
+	// which is wrong behind a reverse proxy.
+	TargetURI func(r *http.Request) string
+}
+
+// ErrDPoPNonce is returned by DPoPVerifier.Verify when the proof's nonce
+// was rejected by CheckNonce.
+var ErrDPoPNonce = errors.New("httpheader: DPoP proof nonce is missing or stale")
+
+// Verify parses and checks the DPoP proof sent with r. If accessToken
+// is not empty, the proof must be bound to it via the ath claim;
+// accessToken itself is usually obtained from Authorization(r.Header).Token
+// when its Scheme is "dpop".
+func (v *DPoPVerifier) Verify(r *http.Request, accessToken string) (*DPoPProof, error) {
+	proof, err := DPoP(r.Header)
+	if err != nil {
+		return nil, err
+	}
+	if !v.allows(proof.Algorithm) {
+		return nil, fmt.Errorf("httpheader: DPoP proof alg %q not allowed", proof.Algorithm)
+	}
+	if err := proof.Verify(); err != nil {
+		return nil, err
+	}
+	if proof.Method != r.Method {
+		return nil, fmt.Errorf("httpheader: DPoP proof htm %q does not match %q", proof.Method, r.Method)
+	}
+	targetURI := v.targetURI(r)
+	if !sameDPoPURI(proof.URI, targetURI) {
+		return nil, fmt.Errorf("httpheader: DPoP proof htu %q does not match %q", proof.URI, targetURI)
+	}
+	maxAge := v.MaxAge
+	if maxAge == 0 {
+		maxAge = 5 * time.Minute
+	}
+	if age := time.Since(proof.IssuedAt); age > maxAge || age < -maxAge {
+		return nil, errors.New("httpheader: DPoP proof iat is too far from the current time")
+	}
+	if accessToken != "" {
+		expected := DPoPAccessTokenHash(accessToken)
+		if subtle.ConstantTimeCompare([]byte(proof.AccessTokenHash), []byte(expected)) != 1 {
+			return nil, errors.New("httpheader: DPoP proof ath does not match the access token")
+		}
+	}
+	if v.CheckKey != nil {
+		if err := v.CheckKey(proof.Key, proof.Thumbprint); err != nil {
+			return nil, err
+		}
+	}
+	if v.CheckNonce != nil && !v.CheckNonce(proof.Nonce) {
+		return nil, ErrDPoPNonce
+	}
+	if v.Replayed != nil && v.Replayed(proof.ID) {
+		return nil, errors.New("httpheader: DPoP proof replayed")
+	}
+	return proof, nil
+}
+
+func (v *DPoPVerifier) allows(algorithm string) bool {
+	if len(v.Algorithms) == 0 {
+		return true
+	}
+	for _, allowed := range v.Algorithms {
+		if allowed == algorithm {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *DPoPVerifier) targetURI(r *http.Request) string {
+	if v.TargetURI != nil {
+		return v.TargetURI(r)
+	}
+	return absoluteURL(r).String()
+}
+
+// sameDPoPURI compares an htu claim to the target URI, ignoring query
+// and fragment, after syntax- and scheme-based normalization
+// (RFC 9449 Section 4.3, item 9).
+func sameDPoPURI(htu, target string) bool {
+	a, okA := normalizeDPoPURI(htu)
+	b, okB := normalizeDPoPURI(target)
+	return okA && okB && a == b
+}
+
+func normalizeDPoPURI(s string) (string, bool) {
+	origin, ok := serializeOrigin(s)
+	if !ok {
+		return "", false
+	}
+	u, _ := url.Parse(s)
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	return origin + path, true
+}
+
+// A DPoPChallenge represents a challenge for the DPoP scheme
+// (RFC 9449 Section 7.1). Algorithms lists the JWS algorithms that
+// the server accepts for proofs. Error is an error code such as
+// "invalid_token", "invalid_dpop_proof" or "use_dpop_nonce".
+type DPoPChallenge struct {
+	Realm            string
+	Scope            []string
+	Algorithms       []string
+	Error            string
+	ErrorDescription string
+}
+
+// ParseDPoPChallenge interprets challenge, such as returned by
+// WWWAuthenticate, as a DPoP challenge. It doesn't check the scheme.
+func ParseDPoPChallenge(challenge Auth) DPoPChallenge {
+	params := challenge.Params
+	return DPoPChallenge{
+		Realm:            challenge.Realm,
+		Scope:            bearerFields(params["scope"]),
+		Algorithms:       bearerFields(params["algs"]),
+		Error:            params["error"],
+		ErrorDescription: params["error_description"],
+	}
+}
+
+// Auth returns c as a challenge to be sent with SetWWWAuthenticate.
+// An error is returned if any parameter contains characters that are not
+// allowed by RFC 9449 Section 7.1, which are the same as for Bearer.
+func (c DPoPChallenge) Auth() (Auth, error) {
+	challenge := Auth{Scheme: "dpop", Realm: c.Realm}
+	set := func(name, value string) {
+		if value == "" {
+			return
+		}
+		if challenge.Params == nil {
+			challenge.Params = make(map[string]string)
+		}
+		challenge.Params[name] = value
+	}
+	for _, scope := range c.Scope {
+		if !isBearerText(scope, false) {
+			return Auth{}, fmt.Errorf("httpheader: bad DPoP scope token %q", scope)
+		}
+	}
+	set("scope", strings.Join(c.Scope, " "))
+	for _, alg := range c.Algorithms {
+		if !isBearerText(alg, false) {
+			return Auth{}, fmt.Errorf("httpheader: bad DPoP algs token %q", alg)
+		}
+	}
+	set("algs", strings.Join(c.Algorithms, " "))
+	if !isBearerText(c.Error, true) {
+		return Auth{}, fmt.Errorf("httpheader: bad DPoP error %q", c.Error)
+	}
+	set("error", c.Error)
+	if !isBearerText(c.ErrorDescription, true) {
+		return Auth{}, fmt.Errorf("httpheader: bad DPoP error_description %q", c.ErrorDescription)
+	}
+	set("error_description", c.ErrorDescription)
+	return challenge, nil
+}
+
+// StatusCode returns the HTTP status code that should accompany c,
+// according to its Error: 400 (Bad Request) for invalid_request and
+// 403 (Forbidden) for insufficient_scope, as with Bearer, and
+// 401 (Unauthorized) otherwise.
+func (c DPoPChallenge) StatusCode() int {
+	return BearerChallenge{Error: c.Error}.StatusCode()
+}
+
+// DPoPNonce parses the DPoP-Nonce header from h (RFC 9449 Section 8.1).
+func DPoPNonce(h http.Header) string {
+	return strings.TrimSpace(h.Get("Dpop-Nonce"))
+}
+
+// SetDPoPNonce replaces the DPoP-Nonce header in h (RFC 9449 Section 8.1).
+// If nonce is empty, the header is deleted.
+func SetDPoPNonce(h http.Header, nonce string) {
+	if nonce == "" {
+		h.Del("Dpop-Nonce")
+		return
+	}
+	h.Set("Dpop-Nonce", nonce)
+}
@@ -0,0 +1,383 @@
+package httpheader
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func ExampleDPoPChallenge() {
+	challenge, _ := DPoPChallenge{
+		Algorithms: []string{"ES256", "RS256"},
+	}.Auth()
+	header := http.Header{}
+	SetWWWAuthenticate(header, []Auth{challenge})
+	header.Write(os.Stdout)
+	// Output: Www-Authenticate: DPoP algs="ES256 RS256"
+}
+
+func ExampleDPoPVerifier() {
+	verifier := &DPoPVerifier{
+		CheckKey: func(key crypto.PublicKey, thumbprint string) error {
+			// Compare thumbprint to the cnf.jkt claim of the access token.
+			return nil
+		},
+	}
+	http.HandleFunc("/resource", func(w http.ResponseWriter, r *http.Request) {
+		credentials := Authorization(r.Header)
+		if credentials.Scheme == "dpop" {
+			_, err := verifier.Verify(r, credentials.Token)
+			if err == nil {
+				fmt.Fprintln(w, "hello")
+				return
+			}
+		}
+		challenge, _ := DPoPChallenge{
+			Algorithms: []string{"ES256"},
+			Error:      "invalid_dpop_proof",
+		}.Auth()
+		SetWWWAuthenticate(w.Header(), []Auth{challenge})
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+}
+
+func TestDPoPThumbprint(t *testing.T) {
+	// RFC 7638 Section 3.1.
+	jwk := map[string]json.RawMessage{
+		"kty": json.RawMessage(`"RSA"`),
+		"n": json.RawMessage(`"0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAt` +
+			`VT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn6` +
+			`4tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FD` +
+			`W2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n9` +
+			`1CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINH` +
+			`aQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw"`),
+		"e":   json.RawMessage(`"AQAB"`),
+		"alg": json.RawMessage(`"RS256"`),
+		"kid": json.RawMessage(`"2011-04-29"`),
+	}
+	_, thumbprint, err := parseJWK(jwk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"; thumbprint != expected {
+		t.Errorf("expected %s, got %s", expected, thumbprint)
+	}
+}
+
+func TestDPoPBadECKey(t *testing.T) {
+	full := base64.RawURLEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	short := base64.RawURLEncoding.EncodeToString(bytes.Repeat([]byte{1}, 31))
+	for _, xy := range [][2]string{{full, full}, {full, short}, {short, full}} {
+		jwk := map[string]json.RawMessage{
+			"kty": json.RawMessage(`"EC"`),
+			"crv": json.RawMessage(`"P-256"`),
+			"x":   json.RawMessage(`"` + xy[0] + `"`),
+			"y":   json.RawMessage(`"` + xy[1] + `"`),
+		}
+		if _, _, err := parseJWK(jwk); err == nil {
+			t.Errorf("accepted %v", xy)
+		}
+	}
+}
+
+func TestDPoPAccessTokenHash(t *testing.T) {
+	// RFC 9449 Section 7.1.
+	const token = "Kz~8mXK1EalYznwH-LC-1fBAo.4Ljp~zsPE_NeO.gxU"
+	if actual := DPoPAccessTokenHash(token); actual != "fUHyO2r2Z3DZ53EsNrWBb0xWXoaNy59IiKCAqksmQEo" {
+		t.Errorf("got %s", actual)
+	}
+}
+
+type dpopKey struct {
+	alg string
+	jwk map[string]string
+	key crypto.Signer
+}
+
+func newDPoPKeyES256(t *testing.T) dpopKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dpopKey{"ES256", map[string]string{
+		"kty": "EC",
+		"crv": "P-256",
+		"x":   base64.RawURLEncoding.EncodeToString(padBytes(key.X.Bytes(), 32)),
+		"y":   base64.RawURLEncoding.EncodeToString(padBytes(key.Y.Bytes(), 32)),
+	}, key}
+}
+
+func newDPoPKeyRS256(t *testing.T, bits int) dpopKey {
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dpopKey{"RS256", map[string]string{
+		"kty": "RSA",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}, key}
+}
+
+func padBytes(b []byte, n int) []byte {
+	return append(make([]byte, n-len(b)), b...)
+}
+
+func (k dpopKey) sign(t *testing.T, header, claims map[string]interface{}) string {
+	if header == nil {
+		header = map[string]interface{}{"typ": "dpop+jwt", "alg": k.alg, "jwk": k.jwk}
+	}
+	encode := func(v interface{}) string {
+		raw, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(raw)
+	}
+	input := encode(header) + "." + encode(claims)
+	digest := sha256.Sum256([]byte(input))
+	var signature []byte
+	switch key := k.key.(type) {
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = append(padBytes(r.Bytes(), 32), padBytes(s.Bytes(), 32)...)
+	case *rsa.PrivateKey:
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func dpopClaims(method, uri, accessToken string) map[string]interface{} {
+	claims := map[string]interface{}{
+		"jti": "e1j3V_bKic8-LAEB",
+		"htm": method,
+		"htu": uri,
+		"iat": time.Now().Unix(),
+	}
+	if accessToken != "" {
+		claims["ath"] = DPoPAccessTokenHash(accessToken)
+	}
+	return claims
+}
+
+func newDPoPRequest(method, uri, proof string) *http.Request {
+	r, _ := http.NewRequest(method, uri, nil)
+	// Simulate a server-side request.
+	r.Host = r.URL.Host
+	r.URL.Scheme, r.URL.Host = "", ""
+	r.Header.Set("Authorization", "DPoP Kz~8mXK1EalYznwH-LC-1fBAo.4Ljp~zsPE_NeO.gxU")
+	r.Header.Set("DPoP", proof)
+	return r
+}
+
+func TestDPoPVerify(t *testing.T) {
+	const token = "Kz~8mXK1EalYznwH-LC-1fBAo.4Ljp~zsPE_NeO.gxU"
+	for _, key := range []dpopKey{newDPoPKeyES256(t), newDPoPKeyRS256(t, 2048)} {
+		t.Run(key.alg, func(t *testing.T) {
+			proof := key.sign(t, nil, dpopClaims("GET", "http://resource.example.org/protectedresource", token))
+			r := newDPoPRequest("GET", "http://resource.example.org/protectedresource?x=1", proof)
+			var gotThumbprint string
+			verifier := &DPoPVerifier{
+				CheckKey: func(_ crypto.PublicKey, thumbprint string) error {
+					gotThumbprint = thumbprint
+					return nil
+				},
+			}
+			credentials := Authorization(r.Header)
+			if credentials.Scheme != "dpop" || credentials.Token != token {
+				t.Fatalf("bad credentials: %v", credentials)
+			}
+			result, err := verifier.Verify(r, credentials.Token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Thumbprint == "" || result.Thumbprint != gotThumbprint {
+				t.Errorf("bad thumbprint %q, %q", result.Thumbprint, gotThumbprint)
+			}
+			if result.Algorithm != key.alg || result.ID != "e1j3V_bKic8-LAEB" {
+				t.Errorf("bad proof: %+v", result)
+			}
+		})
+	}
+}
+
+func TestDPoPVerifyInvalid(t *testing.T) {
+	const token = "Kz~8mXK1EalYznwH-LC-1fBAo.4Ljp~zsPE_NeO.gxU"
+	const uri = "https://resource.example.org/protectedresource"
+	key := newDPoPKeyES256(t)
+	other := newDPoPKeyES256(t)
+	claims := func(edit func(map[string]interface{})) map[string]interface{} {
+		c := dpopClaims("POST", uri, token)
+		edit(c)
+		return c
+	}
+	tests := []struct {
+		proof    string
+		verifier DPoPVerifier
+	}{
+		{"", DPoPVerifier{}},
+		{"abc.def", DPoPVerifier{}},
+		{key.sign(t, nil, dpopClaims("POST", uri, token)) + ", " +
+			key.sign(t, nil, dpopClaims("POST", uri, token)), DPoPVerifier{}},
+		{key.sign(t, map[string]interface{}{"typ": "JWT", "alg": "ES256", "jwk": key.jwk},
+			dpopClaims("POST", uri, token)), DPoPVerifier{}},
+		{key.sign(t, map[string]interface{}{"typ": "dpop+jwt", "alg": "none", "jwk": key.jwk},
+			dpopClaims("POST", uri, token)), DPoPVerifier{}},
+		{key.sign(t, map[string]interface{}{"typ": "dpop+jwt", "alg": "ES256"},
+			dpopClaims("POST", uri, token)), DPoPVerifier{}},
+		{key.sign(t, map[string]interface{}{"typ": "dpop+jwt", "alg": "ES256", "jwk": other.jwk},
+			dpopClaims("POST", uri, token)), DPoPVerifier{}},
+		{key.sign(t, nil, dpopClaims("POST", uri, token)), DPoPVerifier{Algorithms: []string{"RS256"}}},
+		{key.sign(t, nil, dpopClaims("GET", uri, token)), DPoPVerifier{}},
+		{key.sign(t, nil, dpopClaims("POST", "https://resource.example.org/other", token)), DPoPVerifier{}},
+		{key.sign(t, nil, dpopClaims("POST", "http://resource.example.org/protectedresource", token)), DPoPVerifier{}},
+		{key.sign(t, nil, dpopClaims("POST", uri, "")), DPoPVerifier{}},
+		{key.sign(t, nil, dpopClaims("POST", uri, "other token")), DPoPVerifier{}},
+		{key.sign(t, nil, claims(func(c map[string]interface{}) { delete(c, "jti") })), DPoPVerifier{}},
+		{key.sign(t, nil, claims(func(c map[string]interface{}) {
+			c["iat"] = time.Now().Add(-time.Hour).Unix()
+		})), DPoPVerifier{}},
+		{key.sign(t, nil, claims(func(c map[string]interface{}) {
+			c["iat"] = time.Now().Add(time.Hour).Unix()
+		})), DPoPVerifier{}},
+		{key.sign(t, nil, dpopClaims("POST", uri, token)), DPoPVerifier{
+			CheckKey: func(crypto.PublicKey, string) error { return errors.New("unknown key") },
+		}},
+		{key.sign(t, nil, dpopClaims("POST", uri, token)), DPoPVerifier{
+			Replayed: func(string) bool { return true },
+		}},
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			r := newDPoPRequest("POST", uri, test.proof)
+			test.verifier.TargetURI = func(*http.Request) string { return uri }
+			if proof, err := test.verifier.Verify(r, token); err == nil {
+				t.Errorf("accepted %q: %+v", test.proof, proof)
+			}
+		})
+	}
+}
+
+func TestDPoPVerifyRSAWeak(t *testing.T) {
+	key := newDPoPKeyRS256(t, 1024)
+	const uri = "https://resource.example.org/"
+	r := newDPoPRequest("GET", uri, key.sign(t, nil, dpopClaims("GET", uri, "")))
+	verifier := &DPoPVerifier{TargetURI: func(*http.Request) string { return uri }}
+	if _, err := verifier.Verify(r, ""); err == nil {
+		t.Error("accepted 1024-bit RSA key")
+	}
+}
+
+func TestDPoPVerifyNonce(t *testing.T) {
+	const uri = "https://server.example.com/token"
+	key := newDPoPKeyES256(t)
+	verifier := &DPoPVerifier{
+		CheckNonce: func(nonce string) bool { return nonce == "eyJ7S_zG.eyJH0-Z.HX4w-7v" },
+		TargetURI:  func(*http.Request) string { return "https://SERVER.example.com:443/token" },
+	}
+	r := newDPoPRequest("POST", uri, key.sign(t, nil, dpopClaims("POST", uri, "")))
+	if _, err := verifier.Verify(r, ""); err != ErrDPoPNonce {
+		t.Errorf("expected ErrDPoPNonce, got %v", err)
+	}
+	claims := dpopClaims("POST", uri, "")
+	claims["nonce"] = "eyJ7S_zG.eyJH0-Z.HX4w-7v"
+	r = newDPoPRequest("POST", uri, key.sign(t, nil, claims))
+	proof, err := verifier.Verify(r, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proof.Nonce != "eyJ7S_zG.eyJH0-Z.HX4w-7v" {
+		t.Errorf("bad nonce %q", proof.Nonce)
+	}
+}
+
+func TestDPoPChallenge(t *testing.T) {
+	tests := []struct {
+		input  DPoPChallenge
+		result http.Header
+	}{
+		{
+			DPoPChallenge{Algorithms: []string{"ES256", "PS256"}},
+			http.Header{"Www-Authenticate": {`DPoP algs="ES256 PS256"`}},
+		},
+		{
+			DPoPChallenge{Error: "use_dpop_nonce"},
+			http.Header{"Www-Authenticate": {`DPoP error=use_dpop_nonce`}},
+		},
+		{
+			DPoPChallenge{Realm: "WallyWorld", ErrorDescription: "Resource server requires nonce in DPoP proof"},
+			http.Header{"Www-Authenticate": {`DPoP realm="WallyWorld", error_description="Resource server requires nonce in DPoP proof"`}},
+		},
+		{
+			DPoPChallenge{Scope: []string{"openid"}},
+			http.Header{"Www-Authenticate": {`DPoP scope=openid`}},
+		},
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			challenge, err := test.input.Auth()
+			if err != nil {
+				t.Fatal(err)
+			}
+			header := http.Header{}
+			SetWWWAuthenticate(header, []Auth{challenge})
+			checkGenerate(t, test.input, test.result, header)
+			checkParse(t, header, test.input, ParseDPoPChallenge(WWWAuthenticate(header)[0]))
+		})
+	}
+}
+
+func TestParseDPoPChallenge(t *testing.T) {
+	// RFC 9449 Section 7.1.
+	header := http.Header{"Www-Authenticate": {`DPoP error="invalid_token", ` +
+		`error_description="Invalid DPoP key binding", algs="ES256"`}}
+	challenges := WWWAuthenticate(header)
+	checkParse(t, header, "dpop", challenges[0].Scheme, DPoPChallenge{
+		Algorithms:       []string{"ES256"},
+		Error:            "invalid_token",
+		ErrorDescription: "Invalid DPoP key binding",
+	}, ParseDPoPChallenge(challenges[0]))
+}
+
+func TestDPoPChallengeInvalid(t *testing.T) {
+	tests := []DPoPChallenge{
+		{Algorithms: []string{"ES 256"}},
+		{Error: `use"dpop"nonce`},
+		{ErrorDescription: "Nonce\\required"},
+	}
+	for _, test := range tests {
+		if challenge, err := test.Auth(); err == nil {
+			t.Errorf("accepted %+v: %v", test, challenge)
+		}
+	}
+}
+
+func TestDPoPNonce(t *testing.T) {
+	header := http.Header{}
+	SetDPoPNonce(header, "eyJ7S_zG.eyJH0-Z.HX4w-7v")
+	checkGenerate(t, "eyJ7S_zG.eyJH0-Z.HX4w-7v",
+		http.Header{"Dpop-Nonce": {"eyJ7S_zG.eyJH0-Z.HX4w-7v"}}, header)
+	checkParse(t, header, "eyJ7S_zG.eyJH0-Z.HX4w-7v", DPoPNonce(header))
+	SetDPoPNonce(header, "")
+	checkGenerate(t, "", http.Header{}, header)
+}
@@ -0,0 +1,455 @@
+package httpheader
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/adler32"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A DigestAlgorithm describes an entry in the Hash Algorithms for HTTP
+// Digest Fields registry (RFC 9530 Section 5), such as "sha-256". New is nil
+// for algorithms that this package cannot compute. Deprecated algorithms
+// are not collision-resistant and must not be relied upon for integrity.
+type DigestAlgorithm struct {
+	Name       string
+	New        func() hash.Hash
+	Deprecated bool
+}
+
+// RegisterDigestAlgorithm teaches this package about a digest algorithm,
+// replacing any previous information about an algorithm with the same name
+// (compared case-insensitively). The registry initially contains all
+// algorithms from RFC 9530 Section 5.
+//
+// RegisterDigestAlgorithm is not safe to call concurrently with other
+// functions in this package. Call it from an init function.
+func RegisterDigestAlgorithm(algorithm DigestAlgorithm) {
+	algorithm.Name = strings.ToLower(algorithm.Name)
+	digestAlgorithms[algorithm.Name] = algorithm
+}
+
+// LookupDigestAlgorithm returns the registered algorithm with the given name
+// (compared case-insensitively), or false if there is none.
+func LookupDigestAlgorithm(name string) (DigestAlgorithm, bool) {
+	algorithm, ok := digestAlgorithms[strings.ToLower(name)]
+	return algorithm, ok
+}
+
+var digestAlgorithms = make(map[string]DigestAlgorithm)
+
+func init() {
+	// https://www.iana.org/assignments/http-digest-hash-alg/
+	for _, algorithm := range []DigestAlgorithm{
+		{Name: "sha-256", New: sha256.New},
+		{Name: "sha-512", New: sha512.New},
+		{Name: "md5", New: md5.New, Deprecated: true},
+		{Name: "sha", New: sha1.New, Deprecated: true},
+		{Name: "adler", New: func() hash.Hash { return adler32.New() }, Deprecated: true},
+		{
+			Name:       "crc32c",
+			New:        func() hash.Hash { return crc32.New(crc32.MakeTable(crc32.Castagnoli)) },
+			Deprecated: true,
+		},
+		{Name: "unixsum", Deprecated: true},
+		{Name: "unixcksum", Deprecated: true},
+	} {
+		RegisterDigestAlgorithm(algorithm)
+	}
+}
+
+// ErrDigestMismatch is returned by a reader from VerifyDigest when
+// the data doesn't match the expected digest.
+var ErrDigestMismatch = errors.New("httpheader: digest mismatch")
+
+// ContentDigest parses the Content-Digest header from h (RFC 9530
+// Section 2), which maps algorithm names to digests of the message content.
+// The header is a Structured Fields Dictionary (RFC 8941); if it is invalid,
+// the entire header is ignored and nil is returned. Members that are not
+// byte sequences are skipped.
+func ContentDigest(h http.Header) map[string][]byte {
+	return parseDigestFields(h["Content-Digest"])
+}
+
+// SetContentDigest replaces the Content-Digest header in h (RFC 9530
+// Section 2). Members are written in order of their algorithm names.
+func SetContentDigest(h http.Header, digests map[string][]byte) {
+	setDigestFields(h, "Content-Digest", digests)
+}
+
+// ReprDigest parses the Repr-Digest header from h (RFC 9530 Section 3),
+// which maps algorithm names to digests of the selected representation.
+// See ContentDigest for details.
+func ReprDigest(h http.Header) map[string][]byte {
+	return parseDigestFields(h["Repr-Digest"])
+}
+
+// SetReprDigest replaces the Repr-Digest header in h (RFC 9530 Section 3).
+// Members are written in order of their algorithm names.
+func SetReprDigest(h http.Header, digests map[string][]byte) {
+	setDigestFields(h, "Repr-Digest", digests)
+}
+
+func parseDigestFields(values []string) map[string][]byte {
+	if values == nil {
+		return nil
+	}
+	dict, ok := parseSFDictionary(values)
+	if !ok {
+		return nil
+	}
+	digests := make(map[string][]byte, len(dict))
+	for _, member := range dict {
+		if digest, ok := member.value.([]byte); ok {
+			digests[member.key] = digest
+		}
+	}
+	return digests
+}
+
+func setDigestFields(h http.Header, name string, digests map[string][]byte) {
+	if len(digests) == 0 {
+		h.Del(name)
+		return
+	}
+	dict := make([]sfMember, 0, len(digests))
+	for _, algorithm := range sortedDigestKeys(digests) {
+		dict = append(dict, sfMember{
+			key:    strings.ToLower(algorithm),
+			sfItem: sfItem{value: digests[algorithm]},
+		})
+	}
+	b := &strings.Builder{}
+	writeSFDictionary(b, dict)
+	h.Set(name, b.String())
+}
+
+func sortedDigestKeys(digests map[string][]byte) []string {
+	keys := make([]string, 0, len(digests))
+	for key := range digests {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// WantContentDigest parses the Want-Content-Digest header from h
+// (RFC 9530 Section 4), which maps algorithm names to preferences
+// from 0 (not acceptable) to 10 (most preferred). The header is
+// a Structured Fields Dictionary (RFC 8941); if it is invalid, the entire
+// header is ignored and nil is returned. Members with preferences that
+// are not integers from 0 to 10 are skipped.
+func WantContentDigest(h http.Header) map[string]int {
+	return parseWantDigestFields(h["Want-Content-Digest"])
+}
+
+// SetWantContentDigest replaces the Want-Content-Digest header in h
+// (RFC 9530 Section 4).
+func SetWantContentDigest(h http.Header, prefs map[string]int) {
+	setWantDigestFields(h, "Want-Content-Digest", prefs)
+}
+
+// WantReprDigest parses the Want-Repr-Digest header from h
+// (RFC 9530 Section 4). See WantContentDigest for details.
+func WantReprDigest(h http.Header) map[string]int {
+	return parseWantDigestFields(h["Want-Repr-Digest"])
+}
+
+// SetWantReprDigest replaces the Want-Repr-Digest header in h
+// (RFC 9530 Section 4).
+func SetWantReprDigest(h http.Header, prefs map[string]int) {
+	setWantDigestFields(h, "Want-Repr-Digest", prefs)
+}
+
+func parseWantDigestFields(values []string) map[string]int {
+	if values == nil {
+		return nil
+	}
+	dict, ok := parseSFDictionary(values)
+	if !ok {
+		return nil
+	}
+	prefs := make(map[string]int, len(dict))
+	for _, member := range dict {
+		if pref, ok := member.value.(int64); ok && 0 <= pref && pref <= 10 {
+			prefs[member.key] = int(pref)
+		}
+	}
+	return prefs
+}
+
+func setWantDigestFields(h http.Header, name string, prefs map[string]int) {
+	if len(prefs) == 0 {
+		h.Del(name)
+		return
+	}
+	algorithms := make([]string, 0, len(prefs))
+	for algorithm := range prefs {
+		algorithms = append(algorithms, algorithm)
+	}
+	sort.Strings(algorithms)
+	dict := make([]sfMember, 0, len(algorithms))
+	for _, algorithm := range algorithms {
+		dict = append(dict, sfMember{
+			key:    strings.ToLower(algorithm),
+			sfItem: sfItem{value: int64(prefs[algorithm])},
+		})
+	}
+	b := &strings.Builder{}
+	writeSFDictionary(b, dict)
+	h.Set(name, b.String())
+}
+
+// ChooseDigestAlgorithm returns the algorithm from prefs, such as returned by
+// WantContentDigest, with the highest non-zero preference among those that
+// are registered (see RegisterDigestAlgorithm), can be computed, and are not
+// deprecated. Ties are broken in favor of sha-256. If nothing is acceptable,
+// it returns "".
+func ChooseDigestAlgorithm(prefs map[string]int) string {
+	var best string
+	for algorithm, pref := range prefs {
+		info := digestAlgorithms[algorithm]
+		if pref == 0 || info.New == nil || info.Deprecated {
+			continue
+		}
+		if best == "" || pref > prefs[best] ||
+			pref == prefs[best] && (algorithm == "sha-256" || best != "sha-256" && algorithm < best) {
+			best = algorithm
+		}
+	}
+	return best
+}
+
+// A DigestReader computes digests of everything read through it.
+type DigestReader struct {
+	r      io.Reader
+	hashes map[string]hash.Hash
+}
+
+// NewDigestReader returns a DigestReader that reads from r and computes
+// digests with the given registered algorithms.
+func NewDigestReader(r io.Reader, algorithms ...string) (*DigestReader, error) {
+	hashes, err := newDigestHashes(algorithms)
+	if err != nil {
+		return nil, err
+	}
+	return &DigestReader{r: r, hashes: hashes}, nil
+}
+
+func (d *DigestReader) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	for _, h := range d.hashes {
+		h.Write(p[:n])
+	}
+	return n, err
+}
+
+// Sum returns the digests of the data read so far, suitable for
+// SetContentDigest or SetReprDigest.
+func (d *DigestReader) Sum() map[string][]byte {
+	return sumDigestHashes(d.hashes)
+}
+
+// A DigestWriter computes digests of everything written through it.
+type DigestWriter struct {
+	w      io.Writer
+	hashes map[string]hash.Hash
+}
+
+// NewDigestWriter returns a DigestWriter that writes to w and computes
+// digests with the given registered algorithms.
+//
+// To send a digest of a streamed response, declare it in the Trailer header
+// before writing the body, then call SetContentDigest with Sum afterwards.
+func NewDigestWriter(w io.Writer, algorithms ...string) (*DigestWriter, error) {
+	hashes, err := newDigestHashes(algorithms)
+	if err != nil {
+		return nil, err
+	}
+	return &DigestWriter{w: w, hashes: hashes}, nil
+}
+
+func (d *DigestWriter) Write(p []byte) (int, error) {
+	n, err := d.w.Write(p)
+	for _, h := range d.hashes {
+		h.Write(p[:n])
+	}
+	return n, err
+}
+
+// Sum returns the digests of the data written so far, suitable for
+// SetContentDigest or SetReprDigest.
+func (d *DigestWriter) Sum() map[string][]byte {
+	return sumDigestHashes(d.hashes)
+}
+
+func newDigestHashes(algorithms []string) (map[string]hash.Hash, error) {
+	if len(algorithms) == 0 {
+		return nil, errors.New("httpheader: no digest algorithms")
+	}
+	hashes := make(map[string]hash.Hash, len(algorithms))
+	for _, algorithm := range algorithms {
+		algorithm = strings.ToLower(algorithm)
+		info := digestAlgorithms[algorithm]
+		if info.New == nil {
+			return nil, fmt.Errorf("httpheader: unsupported digest algorithm %q", algorithm)
+		}
+		hashes[algorithm] = info.New()
+	}
+	return hashes, nil
+}
+
+func sumDigestHashes(hashes map[string]hash.Hash) map[string][]byte {
+	digests := make(map[string][]byte, len(hashes))
+	for algorithm, h := range hashes {
+		digests[algorithm] = h.Sum(nil)
+	}
+	return digests
+}
+
+// VerifyDigest returns a reader that reads body and checks it against
+// digests, such as returned by ContentDigest. At the end of body, the reader
+// returns ErrDigestMismatch instead of io.EOF if any digest doesn't match.
+// The caller must not act on the data before seeing io.EOF.
+//
+// Only algorithms that can be computed and are not deprecated are checked.
+// If there are no such algorithms in digests, an error is returned.
+//
+// For Repr-Digest, body must be the complete selected representation,
+// including any content coding, which is not the case in 206 (Partial
+// Content) responses, or in responses to HEAD.
+func VerifyDigest(body io.ReadCloser, digests map[string][]byte) (io.ReadCloser, error) {
+	var algorithms []string
+	for _, algorithm := range sortedDigestKeys(digests) {
+		info := digestAlgorithms[algorithm]
+		if info.New != nil && !info.Deprecated {
+			algorithms = append(algorithms, algorithm)
+		}
+	}
+	if len(algorithms) == 0 {
+		return nil, errors.New("httpheader: no supported digest algorithms")
+	}
+	r, err := NewDigestReader(body, algorithms...)
+	if err != nil {
+		return nil, err
+	}
+	return &digestVerifier{DigestReader: r, body: body, expected: digests}, nil
+}
+
+type digestVerifier struct {
+	*DigestReader
+	body     io.Closer
+	expected map[string][]byte
+}
+
+func (v *digestVerifier) Read(p []byte) (int, error) {
+	n, err := v.DigestReader.Read(p)
+	if err == io.EOF {
+		for algorithm, h := range v.hashes {
+			if !bytes.Equal(h.Sum(nil), v.expected[algorithm]) {
+				return n, ErrDigestMismatch
+			}
+		}
+	}
+	return n, err
+}
+
+func (v *digestVerifier) Close() error {
+	return v.body.Close()
+}
+
+// Digest parses the obsolete Digest header from h (RFC 3230 Section 4.3.2),
+// which was replaced by Repr-Digest. Algorithm names are converted to their
+// RFC 9530 equivalents, and digests are decoded from base64 or hex
+// as appropriate for each, so the result can be compared with ReprDigest.
+// Unknown algorithms and undecodable values are skipped, as are unixsum
+// and unixcksum, whose decimal values have no byte form defined by RFC 9530.
+func Digest(h http.Header) map[string][]byte {
+	values := h["Digest"]
+	if values == nil {
+		return nil
+	}
+	digests := make(map[string][]byte)
+	for v, vs := iterElems("", values); v != ""; v, vs = iterElems(v, vs) {
+		var algorithm, value string
+		algorithm, v = consumeItem(v)
+		v = skipWS(v)
+		if peek(v) != '=' {
+			continue
+		}
+		// Base64 values may end with equal signs, so consumeItem won't do.
+		v = v[1:]
+		end := strings.IndexByte(v, ',')
+		if end == -1 {
+			end = len(v)
+		}
+		value, v = strings.TrimSpace(v[:end]), v[end:]
+		algorithm = legacyDigestAlgorithm(algorithm)
+		if digest, ok := decodeLegacyDigest(algorithm, value); ok {
+			digests[algorithm] = digest
+		}
+	}
+	return digests
+}
+
+func legacyDigestAlgorithm(algorithm string) string {
+	algorithm = strings.ToLower(algorithm)
+	if algorithm == "adler32" {
+		return "adler"
+	}
+	return algorithm
+}
+
+func decodeLegacyDigest(algorithm, value string) ([]byte, bool) {
+	switch algorithm {
+	case "sha-256", "sha-512", "md5", "sha":
+		digest, err := base64.StdEncoding.DecodeString(value)
+		return digest, err == nil
+	case "adler", "crc32c":
+		digest, err := hex.DecodeString(value)
+		return digest, err == nil && len(digest) == 4
+	}
+	return nil, false
+}
+
+// WantDigest parses the obsolete Want-Digest header from h (RFC 3230
+// Section 4.3.1), which was replaced by Want-Repr-Digest. It maps algorithm
+// names, converted to their RFC 9530 equivalents, to quality values.
+func WantDigest(h http.Header) map[string]float32 {
+	values := h["Want-Digest"]
+	if values == nil {
+		return nil
+	}
+	prefs := make(map[string]float32)
+	for v, vs := iterElems("", values); v != ""; v, vs = iterElems(v, vs) {
+		var algorithm string
+		algorithm, v = consumeItem(v)
+		q := float32(1)
+		for {
+			var name, value string
+			name, value, v = consumeParam(v)
+			if name == "" {
+				break
+			}
+			if name == "q" {
+				qvalue, _ := strconv.ParseFloat(value, 32)
+				q = float32(qvalue)
+			}
+		}
+		prefs[legacyDigestAlgorithm(algorithm)] = q
+	}
+	return prefs
+}
@@ -0,0 +1,363 @@
+package httpheader
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func ExampleContentDigest() {
+	// On the server.
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		body, err := VerifyDigest(r.Body, ContentDigest(r.Header))
+		if err != nil {
+			http.Error(w, "Content-Digest required", http.StatusBadRequest)
+			return
+		}
+		if _, err := ioutil.ReadAll(body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Trailer", "Content-Digest")
+		dw, _ := NewDigestWriter(w, ChooseDigestAlgorithm(WantContentDigest(r.Header)))
+		io.WriteString(dw, `{"hello": "world"}`)
+		SetContentDigest(w.Header(), dw.Sum())
+	}
+
+	// On the client.
+	r := httptest.NewRequest("POST", "/", strings.NewReader(`{"hello": "world"}`))
+	SetContentDigest(r.Header, map[string][]byte{"sha-256": decodeBase64("X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=")})
+	SetWantContentDigest(r.Header, map[string]int{"sha-512": 3, "sha-256": 10})
+	w := httptest.NewRecorder()
+	handler(w, r)
+	fmt.Println(w.Result().Trailer.Get("Content-Digest"))
+	// Output: sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:
+}
+
+func decodeBase64(s string) []byte {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestContentDigest(t *testing.T) {
+	tests := []struct {
+		header http.Header
+		result map[string][]byte
+	}{
+		// Valid headers.
+		{
+			http.Header{"Content-Digest": {"sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:"}},
+			map[string][]byte{"sha-256": decodeBase64("X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=")},
+		},
+		{
+			http.Header{"Content-Digest": {
+				"sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:",
+				"sha-512=:WZDPaVn/7XgHaAy8pmojAkGWoRx2UFChF41A2svX+TaPm+AbwAgBWnrIiYllu7BNNyealdVLvRwEmTHWXvJwew==:",
+			}},
+			map[string][]byte{
+				"sha-256": decodeBase64("X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE="),
+				"sha-512": decodeBase64("WZDPaVn/7XgHaAy8pmojAkGWoRx2UFChF41A2svX+TaPm+AbwAgBWnrIiYllu7BNNyealdVLvRwEmTHWXvJwew=="),
+			},
+		},
+		{
+			http.Header{"Content-Digest": {""}},
+			map[string][]byte{},
+		},
+
+		// Invalid headers.
+		// Precise outputs on them are not a guaranteed part of the API.
+		// They may change as convenient for the parsing code.
+		{
+			http.Header{"Content-Digest": {`sha-256="X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=", md5=:AQI=:`}},
+			map[string][]byte{"md5": {1, 2}},
+		},
+		{
+			http.Header{"Content-Digest": {"SHA-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:"}},
+			nil,
+		},
+		{
+			http.Header{"Content-Digest": {"sha-256=X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE="}},
+			nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			checkParse(t, test.header, test.result, ContentDigest(test.header))
+		})
+	}
+}
+
+func TestSetDigestFields(t *testing.T) {
+	digests := map[string][]byte{
+		"sha-512": decodeBase64("WZDPaVn/7XgHaAy8pmojAkGWoRx2UFChF41A2svX+TaPm+AbwAgBWnrIiYllu7BNNyealdVLvRwEmTHWXvJwew=="),
+		"sha-256": decodeBase64("X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE="),
+	}
+	header := http.Header{}
+	SetContentDigest(header, digests)
+	SetReprDigest(header, map[string][]byte{"SHA-256": {1, 2, 3}})
+	checkGenerate(t, digests, http.Header{
+		"Content-Digest": {"sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:, " +
+			"sha-512=:WZDPaVn/7XgHaAy8pmojAkGWoRx2UFChF41A2svX+TaPm+AbwAgBWnrIiYllu7BNNyealdVLvRwEmTHWXvJwew==:"},
+		"Repr-Digest": {"sha-256=:AQID:"},
+	}, header)
+	checkParse(t, header, digests, ContentDigest(header),
+		map[string][]byte{"sha-256": {1, 2, 3}}, ReprDigest(header))
+	SetContentDigest(header, nil)
+	SetReprDigest(header, map[string][]byte{})
+	checkGenerate(t, nil, http.Header{}, header)
+}
+
+func TestWantDigestFields(t *testing.T) {
+	tests := []struct {
+		header http.Header
+		result map[string]int
+	}{
+		// Valid headers.
+		{
+			http.Header{"Want-Content-Digest": {"sha-256=1"}},
+			map[string]int{"sha-256": 1},
+		},
+		{
+			http.Header{"Want-Content-Digest": {"sha-512=3, sha-256=10, unixsum=0"}},
+			map[string]int{"sha-512": 3, "sha-256": 10, "unixsum": 0},
+		},
+
+		// Invalid headers.
+		// Precise outputs on them are not a guaranteed part of the API.
+		// They may change as convenient for the parsing code.
+		{
+			http.Header{"Want-Content-Digest": {"sha-512=11, sha-256=-1, md5=0.5, sha=?1, adler=3"}},
+			map[string]int{"adler": 3},
+		},
+		{
+			http.Header{"Want-Content-Digest": {"sha-256=1;"}},
+			nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			checkParse(t, test.header, test.result, WantContentDigest(test.header))
+		})
+	}
+}
+
+func TestSetWantDigestFields(t *testing.T) {
+	header := http.Header{}
+	SetWantContentDigest(header, map[string]int{"sha-512": 3, "sha-256": 10, "unixsum": 0})
+	SetWantReprDigest(header, map[string]int{"sha-256": 1})
+	checkGenerate(t, nil, http.Header{
+		"Want-Content-Digest": {"sha-256=10, sha-512=3, unixsum=0"},
+		"Want-Repr-Digest":    {"sha-256=1"},
+	}, header)
+	checkParse(t, header, map[string]int{"sha-256": 1}, WantReprDigest(header))
+	SetWantContentDigest(header, nil)
+	SetWantReprDigest(header, nil)
+	checkGenerate(t, nil, http.Header{}, header)
+}
+
+func TestChooseDigestAlgorithm(t *testing.T) {
+	tests := []struct {
+		prefs  map[string]int
+		result string
+	}{
+		{nil, ""},
+		{map[string]int{"sha-256": 1}, "sha-256"},
+		{map[string]int{"sha-512": 3, "sha-256": 10}, "sha-256"},
+		{map[string]int{"sha-512": 10, "sha-256": 3}, "sha-512"},
+		{map[string]int{"sha-512": 5, "sha-256": 5}, "sha-256"},
+		{map[string]int{"sha-512": 0, "md5": 10}, ""},
+		{map[string]int{"unixsum": 10, "foo": 10, "sha-512": 1}, "sha-512"},
+	}
+	for _, test := range tests {
+		if actual := ChooseDigestAlgorithm(test.prefs); actual != test.result {
+			t.Errorf("%v: expected %q, got %q", test.prefs, test.result, actual)
+		}
+	}
+}
+
+func TestRegisterDigestAlgorithm(t *testing.T) {
+	saved := make(map[string]DigestAlgorithm, len(digestAlgorithms))
+	for name, algorithm := range digestAlgorithms {
+		saved[name] = algorithm
+	}
+	defer func() { digestAlgorithms = saved }()
+
+	if algorithm, ok := LookupDigestAlgorithm("MD5"); !ok || !algorithm.Deprecated {
+		t.Errorf("md5: got %+v, %v", algorithm, ok)
+	}
+	if _, ok := LookupDigestAlgorithm("sha-384"); ok {
+		t.Error("sha-384 is not registered")
+	}
+	prefs := map[string]int{"sha-384": 10, "sha-256": 1}
+	checkParse(t, nil, "sha-256", ChooseDigestAlgorithm(prefs))
+
+	RegisterDigestAlgorithm(DigestAlgorithm{Name: "SHA-384", New: sha512.New384})
+	algorithm, ok := LookupDigestAlgorithm("sha-384")
+	checkParse(t, nil,
+		true, ok,
+		"sha-384", algorithm.Name,
+		"sha-384", ChooseDigestAlgorithm(prefs),
+	)
+	w, err := NewDigestWriter(ioutil.Discard, "sha-384")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, "hello")
+	if digest := w.Sum()["sha-384"]; len(digest) != sha512.Size384 {
+		t.Errorf("bad sha-384 digest %x", digest)
+	}
+}
+
+func TestDigestReaderWriter(t *testing.T) {
+	const data = `{"hello": "world"}`
+	expected := map[string][]byte{
+		"sha-256": decodeBase64("X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE="),
+		"sha-512": decodeBase64("WZDPaVn/7XgHaAy8pmojAkGWoRx2UFChF41A2svX+TaPm+AbwAgBWnrIiYllu7BNNyealdVLvRwEmTHWXvJwew=="),
+		"md5":     decodeBase64("Sd/dVLAcvNLSq16eXua5uQ=="),
+		"adler":   {0x39, 0x99, 0x06, 0x17},
+	}
+	r, err := NewDigestReader(strings.NewReader(data), "sha-256", "SHA-512", "md5", "adler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(r); err != nil {
+		t.Fatal(err)
+	}
+	checkParse(t, nil, expected, r.Sum())
+
+	buf := &bytes.Buffer{}
+	w, err := NewDigestWriter(buf, "sha-256", "sha-512", "md5", "adler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, data[:5])
+	io.WriteString(w, data[5:])
+	checkParse(t, nil, expected, w.Sum(), data, buf.String())
+
+	for _, algorithms := range [][]string{nil, {"unixsum"}, {"sha-256", "foo"}} {
+		if _, err := NewDigestReader(strings.NewReader(data), algorithms...); err == nil {
+			t.Errorf("%q: no error", algorithms)
+		}
+	}
+}
+
+func TestVerifyDigest(t *testing.T) {
+	const data = `{"hello": "world"}`
+	tests := []struct {
+		digests map[string][]byte
+		err     error
+	}{
+		{map[string][]byte{"sha-256": decodeBase64("X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=")}, nil},
+		{map[string][]byte{
+			"sha-256": decodeBase64("X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE="),
+			"md5":     {1, 2, 3},
+			"foo":     {4, 5, 6},
+		}, nil},
+		{map[string][]byte{"sha-256": {1, 2, 3}}, ErrDigestMismatch},
+		{map[string][]byte{
+			"sha-256": decodeBase64("X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE="),
+			"sha-512": decodeBase64("X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE="),
+		}, ErrDigestMismatch},
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			body, err := VerifyDigest(ioutil.NopCloser(strings.NewReader(data)), test.digests)
+			if err != nil {
+				t.Fatal(err)
+			}
+			read, err := ioutil.ReadAll(body)
+			if err != test.err {
+				t.Errorf("expected %v, got %v", test.err, err)
+			}
+			if string(read) != data {
+				t.Errorf("read %q", read)
+			}
+			if err := body.Close(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	for _, digests := range []map[string][]byte{nil, {"md5": decodeBase64("Sd/dVLAcvNLSq16eXua5uQ==")}} {
+		if _, err := VerifyDigest(ioutil.NopCloser(strings.NewReader(data)), digests); err == nil {
+			t.Errorf("%v: no error", digests)
+		}
+	}
+}
+
+func TestDigest(t *testing.T) {
+	tests := []struct {
+		header http.Header
+		result map[string][]byte
+	}{
+		// Valid headers.
+		{
+			http.Header{"Digest": {"SHA-256=X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE="}},
+			map[string][]byte{"sha-256": decodeBase64("X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=")},
+		},
+		{
+			// RFC 3230 Section 4.3.2.
+			http.Header{"Digest": {"md5=HUXZLQLMuI/KZ5KDcJPcOA==, sha=thvDyvhfIqlvFe+A9MYgxAfm1q5=,unixsum=30637"}},
+			map[string][]byte{
+				"md5": decodeBase64("HUXZLQLMuI/KZ5KDcJPcOA=="),
+				"sha": decodeBase64("thvDyvhfIqlvFe+A9MYgxAfm1q5="),
+			},
+		},
+		{
+			http.Header{"Digest": {"Adler32=39990617", "CRC32c = 0000ffff"}},
+			map[string][]byte{
+				"adler":  {0x39, 0x99, 0x06, 0x17},
+				"crc32c": {0x00, 0x00, 0xff, 0xff},
+			},
+		},
+
+		// Invalid headers.
+		// Precise outputs on them are not a guaranteed part of the API.
+		// They may change as convenient for the parsing code.
+		{
+			http.Header{"Digest": {"SHA-256, md5=not base64, adler32=123, foo=bar, sha-512=AQI="}},
+			map[string][]byte{"sha-512": {1, 2}},
+		},
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			checkParse(t, test.header, test.result, Digest(test.header))
+		})
+	}
+}
+
+func TestWantDigest(t *testing.T) {
+	tests := []struct {
+		header http.Header
+		result map[string]float32
+	}{
+		// Valid headers.
+		{
+			http.Header{"Want-Digest": {"SHA-256"}},
+			map[string]float32{"sha-256": 1},
+		},
+		{
+			// RFC 3230 Section 4.3.1.
+			http.Header{"Want-Digest": {"SHA-512;q=0.3, sha-256;q=1, md5;q=0"}},
+			map[string]float32{"sha-512": 0.3, "sha-256": 1, "md5": 0},
+		},
+		{
+			http.Header{"Want-Digest": {"adler32", "unixsum;q=0.5"}},
+			map[string]float32{"adler": 1, "unixsum": 0.5},
+		},
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			checkParse(t, test.header, test.result, WantDigest(test.header))
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package httpheader
+
+// defaultUARules is the database behind DefaultUARules, in the format
+// of ParseUARules. Order matters: crawlers come first because many of them
+// imitate browsers, and browsers built on Chrome come before Chrome because
+// they also send its product.
+const defaultUARules = `{
+	"clients": [
+		{"type": "crawler", "name": "Googlebot", "match": "Googlebot(?:-[a-z]+)?/(?P<version>[\\d.]+)"},
+		{"type": "crawler", "name": "Google-InspectionTool", "match": "Google-InspectionTool/(?P<version>[\\d.]+)"},
+		{"type": "crawler", "name": "AdsBot-Google", "match": "AdsBot-Google"},
+		{"type": "crawler", "name": "Bingbot", "match": "bingbot/(?P<version>[\\d.]+)"},
+		{"type": "crawler", "name": "Yahoo! Slurp", "match": "Yahoo! Slurp"},
+		{"type": "crawler", "name": "DuckDuckBot", "match": "DuckDuckBot(?:-Https)?/(?P<version>[\\d.]+)"},
+		{"type": "crawler", "name": "Baiduspider", "match": "Baiduspider(?:-[a-z]+)?/(?P<version>[\\d.]+)"},
+		{"type": "crawler", "name": "YandexBot", "match": "Yandex[a-z]*/(?P<version>[\\d.]+)"},
+		{"type": "crawler", "name": "Applebot", "match": "Applebot/(?P<version>[\\d.]+)"},
+		{"type": "crawler", "name": "PetalBot", "match": "PetalBot"},
+		{"type": "crawler", "name": "facebookexternalhit", "product": "facebookexternalhit"},
+		{"type": "crawler", "name": "Twitterbot", "product": "Twitterbot"},
+		{"type": "crawler", "name": "LinkedInBot", "product": "LinkedInBot"},
+		{"type": "crawler", "name": "Slackbot", "match": "Slackbot(?:-LinkExpanding)?(?: (?P<version>[\\d.]+))?"},
+		{"type": "crawler", "name": "AhrefsBot", "match": "AhrefsBot/(?P<version>[\\d.]+)"},
+		{"type": "crawler", "name": "SemrushBot", "match": "SemrushBot(?:-[a-z]+)?/(?P<version>[\\d.~a-z]+)"},
+		{"type": "crawler", "name": "MJ12bot", "match": "MJ12bot/v?(?P<version>[\\d.]+)"},
+		{"type": "crawler", "name": "CCBot", "product": "CCBot"},
+		{"type": "crawler", "name": "GPTBot", "match": "GPTBot/(?P<version>[\\d.]+)"},
+		{"type": "crawler", "name": "ia_archiver", "match": "ia_archiver"},
+		{"type": "crawler", "match": "(?:^|[\\s;(])(?P<name>[\\w.-]*(?:bot|crawler|spider))/v?(?P<version>[\\d.]*)"},
+
+		{"type": "library", "name": "curl", "product": "curl"},
+		{"type": "library", "name": "Wget", "product": "Wget"},
+		{"type": "library", "name": "aiohttp", "product": "aiohttp"},
+		{"type": "library", "name": "python-requests", "product": "python-requests"},
+		{"type": "library", "name": "python-httpx", "product": "python-httpx"},
+		{"type": "library", "name": "Python-urllib", "product": "Python-urllib"},
+		{"type": "library", "name": "Go-http-client", "product": "Go-http-client"},
+		{"type": "library", "name": "okhttp", "product": "okhttp"},
+		{"type": "library", "name": "Apache-HttpClient", "product": "Apache-HttpClient"},
+		{"type": "library", "name": "Java", "product": "Java"},
+		{"type": "library", "name": "axios", "product": "axios"},
+		{"type": "library", "name": "node-fetch", "product": "node-fetch"},
+		{"type": "library", "name": "undici", "product": "undici"},
+		{"type": "library", "name": "libwww-perl", "product": "libwww-perl"},
+		{"type": "library", "name": "PostmanRuntime", "product": "PostmanRuntime"},
+		{"type": "library", "name": "HTTPie", "product": "HTTPie"},
+		{"type": "library", "name": "Dart", "product": "Dart"},
+
+		{"type": "browser", "name": "Edge", "product": "Edg"},
+		{"type": "browser", "name": "Edge", "product": "EdgA"},
+		{"type": "browser", "name": "Edge", "product": "EdgiOS"},
+		{"type": "browser", "name": "Edge", "product": "Edge"},
+		{"type": "browser", "name": "Opera", "product": "OPR"},
+		{"type": "browser", "name": "Opera", "product": "OPiOS"},
+		{"type": "browser", "name": "Opera Mini", "match": "Opera Mini/(?P<version>[\\d.]+)"},
+		{"type": "browser", "name": "Opera", "product": "Opera", "versionFrom": "Version"},
+		{"type": "browser", "name": "Samsung Internet", "product": "SamsungBrowser"},
+		{"type": "browser", "name": "Yandex Browser", "product": "YaBrowser"},
+		{"type": "browser", "name": "Vivaldi", "product": "Vivaldi"},
+		{"type": "browser", "name": "UC Browser", "product": "UCBrowser"},
+		{"type": "browser", "name": "Firefox", "product": "FxiOS"},
+		{"type": "browser", "name": "Chrome", "product": "CriOS"},
+		{"type": "browser", "name": "Headless Chrome", "product": "HeadlessChrome"},
+		{"type": "browser", "name": "Chromium", "product": "Chromium"},
+		{"type": "browser", "name": "Chrome", "product": "Chrome"},
+		{"type": "browser", "name": "Firefox", "product": "Firefox"},
+		{"type": "browser", "name": "Internet Explorer", "match": "MSIE (?P<version>[\\d.]+)"},
+		{"type": "browser", "name": "Internet Explorer", "match": "Trident/.*rv:(?P<version>[\\d.]+)"},
+		{"type": "browser", "name": "Safari", "product": "Safari", "versionFrom": "Version"}
+	],
+	"engines": [
+		{"name": "EdgeHTML", "product": "Edge"},
+		{"name": "Blink", "product": "Chrome"},
+		{"name": "Blink", "product": "Chromium"},
+		{"name": "Blink", "product": "HeadlessChrome"},
+		{"name": "Presto", "product": "Presto"},
+		{"name": "WebKit", "product": "AppleWebKit"},
+		{"name": "Trident", "match": "Trident/(?P<version>[\\d.]+)"},
+		{"name": "Gecko", "product": "Gecko", "match": "rv:(?P<version>[\\d.]+)"}
+	],
+	"os": [
+		{"name": "Windows Phone", "match": "Windows Phone(?: OS)? (?P<version>[\\d.]+)"},
+		{"name": "Windows", "match": "Windows NT (?P<version>[\\d.]+)"},
+		{"name": "Windows", "match": "Windows"},
+		{"name": "iOS", "match": "(?:iPhone|CPU)(?: iPhone)? OS (?P<version>[\\d_]+)"},
+		{"name": "iOS", "match": "iPhone|iPad|iPod"},
+		{"name": "Android", "match": "Android(?: (?P<version>[\\d.]+))?"},
+		{"name": "Chrome OS", "match": "CrOS \\S+ (?P<version>[\\d.]+)"},
+		{"name": "macOS", "match": "Mac OS X(?: (?P<version>[\\d_.]+))?"},
+		{"name": "Linux", "match": "Linux|X11"}
+	],
+	"devices": [
+		{"name": "console", "match": "PlayStation|Xbox|Nintendo"},
+		{"name": "tv", "match": "Smart-?TV|CrKey|AppleTV|\\bTV\\b"},
+		{"name": "tablet", "match": "iPad|Tablet"},
+		{"name": "mobile", "match": "iPhone|iPod|Mobile|Windows Phone|Opera Mini"},
+		{"name": "tablet", "match": "Android"},
+		{"name": "desktop", "match": "Windows NT|Macintosh|X11|CrOS"}
+	]
+}`
@@ -0,0 +1,231 @@
+package httpheader
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// A UserAgentInfo describes the client behind a User-Agent header,
+// as determined by UARules.Classify.
+//
+// Type is "browser", "crawler" (including other bots), "library" (HTTP
+// libraries and command-line tools), or empty if the client is unknown.
+// Name is the client's name, such as "Chrome", "Googlebot" or "curl".
+// Device is "desktop", "mobile", "tablet", "tv", "console", or empty
+// if unknown. Any field is empty if no rule matched it.
+type UserAgentInfo struct {
+	Type          string
+	Name          string
+	Version       string
+	Engine        string
+	EngineVersion string
+	OS            string
+	OSVersion     string
+	Device        string
+}
+
+// UARules is a database of rules for classifying user agents.
+// Use ParseUARules to load one, or DefaultUARules.
+//
+// User-Agent strings are notoriously messy, and any such classification is
+// heuristic. It should not be used for anything security-sensitive, since
+// clients can send whatever they like.
+type UARules struct {
+	clients []uaRule
+	engines []uaRule
+	oses    []uaRule
+	devices []uaRule
+}
+
+type uaRule struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Product     string `json:"product"`
+	Match       string `json:"match"`
+	VersionFrom string `json:"versionFrom"`
+
+	re *regexp.Regexp
+}
+
+// ParseUARules reads a rules database in JSON format from r. This allows
+// updating the rules without changing code, for example, by embedding
+// a file in the program or downloading it at runtime. The format is that of
+// the default database in uarules.go:
+//
+//	{
+//		"clients": [
+//			{"type": "crawler", "name": "Googlebot", "match": "Googlebot/(?P<version>[\\d.]+)"},
+//			{"type": "browser", "name": "Edge", "product": "Edg"},
+//			...
+//		],
+//		"engines": [...],
+//		"os": [...],
+//		"devices": [...]
+//	}
+//
+// In each list, rules are tried in order, and the first one that matches
+// determines the corresponding fields of UserAgentInfo. A rule matches if all
+// of its conditions hold:
+//
+// "product" requires a product with this name, ignoring case.
+//
+// "match" is a regular expression (RE2, case-insensitive) that must match
+// some product, written as "name/version", or some product's Comment.
+// Its "version" named group, if any, gives the version, with underscores
+// replaced by dots (as in "iPhone OS 17_4"). Its "name" named group,
+// if any, gives the name when the rule has no "name" of its own.
+//
+// If the version is not captured by "match", it is taken from the product
+// named by "versionFrom", or else from the product matched by "product".
+//
+// For device rules, "name" is the device class.
+func ParseUARules(r io.Reader) (*UARules, error) {
+	var raw struct {
+		Clients []uaRule `json:"clients"`
+		Engines []uaRule `json:"engines"`
+		OS      []uaRule `json:"os"`
+		Devices []uaRule `json:"devices"`
+	}
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, err
+	}
+	for _, rules := range [][]uaRule{raw.Clients, raw.Engines, raw.OS, raw.Devices} {
+		for i := range rules {
+			rule := &rules[i]
+			if rule.Product == "" && rule.Match == "" {
+				return nil, fmt.Errorf("httpheader: UA rule %q has no conditions", rule.Name)
+			}
+			if rule.Match == "" {
+				continue
+			}
+			re, err := regexp.Compile("(?i)" + rule.Match)
+			if err != nil {
+				return nil, fmt.Errorf("httpheader: UA rule %q: %v", rule.Name, err)
+			}
+			rule.re = re
+		}
+	}
+	return &UARules{
+		clients: raw.Clients,
+		engines: raw.Engines,
+		oses:    raw.OS,
+		devices: raw.Devices,
+	}, nil
+}
+
+// DefaultUARules returns the built-in rules database. It knows the major
+// browsers, engines and operating systems, popular HTTP libraries, and
+// well-known crawlers, plus a generic rule for anything that calls itself
+// a bot, crawler or spider. The database is loaded on first use, so programs
+// that never classify user agents don't pay for compiling its rules.
+func DefaultUARules() *UARules {
+	defaultUARulesOnce.Do(func() {
+		rules, err := ParseUARules(strings.NewReader(defaultUARules))
+		if err != nil {
+			panic(err)
+		}
+		defaultUARulesLoaded = rules
+	})
+	return defaultUARulesLoaded
+}
+
+var (
+	defaultUARulesOnce   sync.Once
+	defaultUARulesLoaded *UARules
+)
+
+// ClassifyUserAgent classifies products, such as returned by UserAgent,
+// with DefaultUARules.
+func ClassifyUserAgent(products []Product) UserAgentInfo {
+	return DefaultUARules().Classify(products)
+}
+
+// Classify interprets products, such as returned by UserAgent, according to
+// the rules.
+func (rules *UARules) Classify(products []Product) UserAgentInfo {
+	var info UserAgentInfo
+	if rule, name, version := matchUARules(rules.clients, products); rule != nil {
+		info.Type, info.Name, info.Version = rule.Type, name, version
+	}
+	_, info.Engine, info.EngineVersion = matchUARules(rules.engines, products)
+	_, info.OS, info.OSVersion = matchUARules(rules.oses, products)
+	_, info.Device, _ = matchUARules(rules.devices, products)
+	return info
+}
+
+// matchUARules returns the first rule that matches products, with the name
+// and version it determines.
+func matchUARules(rules []uaRule, products []Product) (*uaRule, string, string) {
+	for i := range rules {
+		if name, version, ok := rules[i].apply(products); ok {
+			return &rules[i], name, version
+		}
+	}
+	return nil, "", ""
+}
+
+func (rule *uaRule) apply(products []Product) (name, version string, ok bool) {
+	name = rule.Name
+	if rule.Product != "" {
+		product := findProduct(products, rule.Product)
+		if product == nil {
+			return "", "", false
+		}
+		version = product.Version
+	}
+	if rule.VersionFrom != "" {
+		version = ""
+		if product := findProduct(products, rule.VersionFrom); product != nil {
+			version = product.Version
+		}
+	}
+	if rule.re != nil {
+		groups := matchProducts(rule.re, products)
+		if groups == nil {
+			return "", "", false
+		}
+		for i, group := range rule.re.SubexpNames() {
+			switch {
+			case group == "version" && groups[i] != "":
+				version = strings.Replace(groups[i], "_", ".", -1)
+			case group == "name" && name == "":
+				name = groups[i]
+			}
+		}
+	}
+	return name, version, true
+}
+
+func findProduct(products []Product, name string) *Product {
+	for i := range products {
+		if strings.EqualFold(products[i].Name, name) {
+			return &products[i]
+		}
+	}
+	return nil
+}
+
+// matchProducts returns the submatches of re against the first product
+// or comment that it matches, or nil if there is none.
+func matchProducts(re *regexp.Regexp, products []Product) []string {
+	for _, product := range products {
+		token := product.Name
+		if product.Version != "" {
+			token += "/" + product.Version
+		}
+		if groups := re.FindStringSubmatch(token); groups != nil {
+			return groups
+		}
+		if product.Comment == "" {
+			continue
+		}
+		if groups := re.FindStringSubmatch(product.Comment); groups != nil {
+			return groups
+		}
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package httpheader
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func ExampleClassifyUserAgent() {
+	header := http.Header{"User-Agent": {"Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1"}}
+	info := ClassifyUserAgent(UserAgent(header))
+	fmt.Println(info.Name, info.Version, "on", info.OS, info.OSVersion, info.Device)
+	// Output: Safari 17.4 on iOS 17.4 mobile
+}
+
+func ExampleParseUARules() {
+	rules, err := ParseUARules(strings.NewReader(`{
+		"clients": [
+			{"type": "library", "name": "Acme SDK", "product": "AcmeSDK"}
+		]
+	}`))
+	if err != nil {
+		panic(err)
+	}
+	header := http.Header{"User-Agent": {"AcmeSDK/3.1 Go-http-client/1.1"}}
+	info := rules.Classify(UserAgent(header))
+	fmt.Println(info.Type, info.Name, info.Version)
+	// Output: library Acme SDK 3.1
+}
+
+func TestClassifyUserAgent(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		result    UserAgentInfo
+	}{
+		{
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+			UserAgentInfo{"browser", "Chrome", "124.0.0.0", "Blink", "124.0.0.0", "Windows", "10.0", "desktop"},
+		},
+		{
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36 Edg/124.0.2478.51",
+			UserAgentInfo{"browser", "Edge", "124.0.2478.51", "Blink", "124.0.0.0", "Windows", "10.0", "desktop"},
+		},
+		{
+			"Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:125.0) Gecko/20100101 Firefox/125.0",
+			UserAgentInfo{"browser", "Firefox", "125.0", "Gecko", "125.0", "macOS", "10.15", "desktop"},
+		},
+		{
+			"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4.1 Safari/605.1.15",
+			UserAgentInfo{"browser", "Safari", "17.4.1", "WebKit", "605.1.15", "macOS", "10.15.7", "desktop"},
+		},
+		{
+			"Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36",
+			UserAgentInfo{"browser", "Chrome", "124.0.0.0", "Blink", "124.0.0.0", "Android", "10", "mobile"},
+		},
+		{
+			"Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/24.0 Chrome/117.0.0.0 Safari/537.36",
+			UserAgentInfo{"browser", "Samsung Internet", "24.0", "Blink", "117.0.0.0", "Android", "13", "tablet"},
+		},
+		{
+			"Mozilla/5.0 (Android 14; Mobile; rv:125.0) Gecko/125.0 Firefox/125.0",
+			UserAgentInfo{"browser", "Firefox", "125.0", "Gecko", "125.0", "Android", "14", "mobile"},
+		},
+		{
+			"Mozilla/5.0 (iPad; CPU OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/124.0.6367.88 Mobile/15E148 Safari/604.1",
+			UserAgentInfo{"browser", "Chrome", "124.0.6367.88", "WebKit", "605.1.15", "iOS", "17.4", "tablet"},
+		},
+		{
+			"Mozilla/5.0 (Windows NT 10.0; WOW64; Trident/7.0; rv:11.0) like Gecko",
+			UserAgentInfo{"browser", "Internet Explorer", "11.0", "Trident", "7.0", "Windows", "10.0", "desktop"},
+		},
+		{
+			"Mozilla/5.0 (X11; CrOS x86_64 14541.0.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+			UserAgentInfo{"browser", "Chrome", "124.0.0.0", "Blink", "124.0.0.0", "Chrome OS", "14541.0.0", "desktop"},
+		},
+		{
+			"Mozilla/5.0 (Linux; Android 6.0.1; Nexus 5X Build/MMB29P) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.6367.118 Mobile Safari/537.36 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			UserAgentInfo{"crawler", "Googlebot", "2.1", "Blink", "124.0.6367.118", "Android", "6.0.1", "mobile"},
+		},
+		{
+			"Mozilla/5.0 (compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm)",
+			UserAgentInfo{Type: "crawler", Name: "Bingbot", Version: "2.0"},
+		},
+		{
+			"facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)",
+			UserAgentInfo{Type: "crawler", Name: "facebookexternalhit", Version: "1.1"},
+		},
+		{
+			"Mozilla/5.0 (compatible; FooBot/0.9; +https://example.com/foobot)",
+			UserAgentInfo{Type: "crawler", Name: "FooBot", Version: "0.9"},
+		},
+		{
+			"curl/8.5.0",
+			UserAgentInfo{Type: "library", Name: "curl", Version: "8.5.0"},
+		},
+		{
+			"python-requests/2.31.0",
+			UserAgentInfo{Type: "library", Name: "python-requests", Version: "2.31.0"},
+		},
+		{
+			"Go-http-client/2.0",
+			UserAgentInfo{Type: "library", Name: "Go-http-client", Version: "2.0"},
+		},
+		{
+			"Mozilla/5.0 (Linux; Android 12; Cubot X30) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36",
+			UserAgentInfo{"browser", "Chrome", "120.0.0.0", "Blink", "120.0.0.0", "Android", "12", "mobile"},
+		},
+		{
+			"",
+			UserAgentInfo{},
+		},
+		{
+			"MyApp/1.0",
+			UserAgentInfo{},
+		},
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			header := http.Header{"User-Agent": {test.userAgent}}
+			checkParse(t, header, test.result, ClassifyUserAgent(UserAgent(header)))
+		})
+	}
+}
+
+func TestParseUARulesInvalid(t *testing.T) {
+	tests := []string{
+		`{"clients": [{"type": "browser", "name": "Foo"}]}`,
+		`{"os": [{"name": "Foo", "match": "(foo"}]}`,
+		`{"clients": `,
+	}
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			if _, err := ParseUARules(strings.NewReader(test)); err == nil {
+				t.Errorf("parsing %q: no error", test)
+			}
+		})
+	}
+}